@@ -0,0 +1,160 @@
+// Command jsonfmt validates and reformats json documents.
+//
+// Usage:
+//
+//	jsonfmt [flags] [file ...]
+//
+// With no file, or with "-", the document is read from stdin and written to stdout.
+// Invalid input makes it exit with status 1 and an error of the form `file:line:column: message`.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lnshi/json-lookup/tool/json"
+)
+
+const (
+	exitOK = iota
+	exitFailure
+	exitUsage
+)
+
+// options are the flags which decide how the documents are formatted.
+type options struct {
+	compact bool
+	write   bool
+	sortKey bool
+	indent  int
+	tabs    bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("jsonfmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var opts options
+	flags.BoolVar(&opts.compact, "c", false, "compact the output instead of indenting it")
+	flags.BoolVar(&opts.write, "w", false, "write the result back to the file instead of stdout")
+	flags.BoolVar(&opts.sortKey, "s", false, "sort object members by key")
+	flags.IntVar(&opts.indent, "indent", 2, "number of spaces per indentation level")
+	flags.BoolVar(&opts.tabs, "tabs", false, "indent with tabs instead of spaces")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: jsonfmt [flags] [file ...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if opts.indent < 0 {
+		fmt.Fprintf(stderr, "jsonfmt: -indent must not be negative\n")
+		return exitUsage
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	exitCode := exitOK
+	for _, file := range files {
+		if err := processFile(file, opts, stdin, stdout); err != nil {
+			fmt.Fprintf(stderr, "jsonfmt: %s\n", err)
+			exitCode = exitFailure
+		}
+	}
+	return exitCode
+}
+
+func processFile(file string, opts options, stdin io.Reader, stdout io.Writer) error {
+	var (
+		in  []byte
+		err error
+	)
+
+	if file == "-" {
+		if opts.write {
+			return errors.New("cannot use -w with stdin")
+		}
+		file = "<stdin>"
+		in, err = ioutil.ReadAll(stdin)
+	} else {
+		in, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	out, err := format(in, opts)
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return fmt.Errorf("%s:%d:%d: %s", file, syntaxErr.Line, syntaxErr.Column, syntaxErr.Msg)
+		}
+		return fmt.Errorf("%s: %s", file, err)
+	}
+	out = append(out, '\n')
+
+	if opts.write {
+		return writeFile(file, out)
+	}
+
+	_, err = stdout.Write(out)
+	return err
+}
+
+// writeFile replaces the content of `path` with `data` through a temporary file, so that the file is never left
+// half written, and keeps its permissions.
+func writeFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func format(in []byte, opts options) ([]byte, error) {
+	var fmtOpts []json.FormatOption
+	if opts.sortKey {
+		fmtOpts = append(fmtOpts, json.SortKeys())
+	}
+
+	if opts.compact {
+		return json.Compact(in, fmtOpts...)
+	}
+
+	unit := strings.Repeat(" ", opts.indent)
+	if opts.tabs {
+		unit = "\t"
+	}
+	return json.Indent(in, "", unit, fmtOpts...)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var RunTests = []struct {
+	desc         string
+	args         []string
+	stdin        string
+	expectCode   int
+	expectOut    string
+	expectStderr string
+}{
+	{
+		desc:       "Indented with two spaces",
+		stdin:      `{"b":[1,2],"a":"x"}`,
+		expectCode: exitOK,
+		expectOut:  "{\n  \"b\": [\n    1,\n    2\n  ],\n  \"a\": \"x\"\n}\n",
+	}, {
+		desc:       "Compacted with sorted keys",
+		args:       []string{"-c", "-s"},
+		stdin:      "{\"b\": [1, 2],\n \"a\": \"x\"}",
+		expectCode: exitOK,
+		expectOut:  "{\"a\":\"x\",\"b\":[1,2]}\n",
+	}, {
+		desc:       "Indented with tabs",
+		args:       []string{"-tabs"},
+		stdin:      `{"a":1}`,
+		expectCode: exitOK,
+		expectOut:  "{\n\t\"a\": 1\n}\n",
+	}, {
+		desc:         "Invalid input",
+		args:         []string{"-"},
+		stdin:        "{\"a\":\n 1,}",
+		expectCode:   exitFailure,
+		expectStderr: "jsonfmt: <stdin>:2:",
+	}, {
+		desc:         "Writing back stdin",
+		args:         []string{"-w"},
+		stdin:        `{"a":1}`,
+		expectCode:   exitFailure,
+		expectStderr: "jsonfmt: cannot use -w with stdin\n",
+	}, {
+		desc:         "Negative indentation",
+		args:         []string{"-indent", "-1"},
+		expectCode:   exitUsage,
+		expectStderr: "jsonfmt: -indent must not be negative\n",
+	}, {
+		desc:       "Unknown flag",
+		args:       []string{"-x"},
+		expectCode: exitUsage,
+	},
+}
+
+func TestRun(t *testing.T) {
+	for _, test := range RunTests {
+		var stdout, stderr bytes.Buffer
+		code := run(test.args, strings.NewReader(test.stdin), &stdout, &stderr)
+		if code != test.expectCode {
+			t.Errorf("%s: exited with %d, expected %d, stderr: %s", test.desc, code, test.expectCode, stderr.String())
+		}
+		if res := stdout.String(); res != test.expectOut {
+			t.Errorf("%s: printed %q, expected %q", test.desc, res, test.expectOut)
+		}
+		if !strings.HasPrefix(stderr.String(), test.expectStderr) {
+			t.Errorf("%s: printed %q to stderr, expected it to start with %q", test.desc, stderr.String(), test.expectStderr)
+		}
+	}
+}
+
+func TestRunWrite(t *testing.T) {
+	dir := t.TempDir()
+	valid, invalid := filepath.Join(dir, "valid.json"), filepath.Join(dir, "invalid.json")
+	if err := ioutil.WriteFile(valid, []byte(`{"a":1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(invalid, []byte(`{"a":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-w", "-c", valid, invalid}, strings.NewReader(""), &stdout, &stderr); code != exitFailure {
+		t.Errorf("run exited with %d, expected %d", code, exitFailure)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("run printed %q, expected nothing with -w", stdout.String())
+	}
+
+	// The valid file is rewritten and keeps its permissions, the invalid one is left as it is.
+	if res, err := ioutil.ReadFile(valid); err != nil || string(res) != "{\"a\":1}\n" {
+		t.Errorf("the valid file holds %q and %v, expected %q", res, err, "{\"a\":1}\n")
+	}
+	info, err := os.Stat(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("the valid file has mode %v, expected %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+	if res, err := ioutil.ReadFile(invalid); err != nil || string(res) != `{"a":` {
+		t.Errorf("the invalid file holds %q and %v, expected it unchanged", res, err)
+	}
+
+	// No temporary file left behind.
+	if entries, err := ioutil.ReadDir(dir); err != nil || len(entries) != 2 {
+		t.Errorf("the directory holds %d files and %v, expected 2", len(entries), err)
+	}
+}
@@ -0,0 +1,216 @@
+// Command jsonlookup prints the value found at a key path in a json document.
+//
+// Usage:
+//
+//	jsonlookup [flags] [key ...]
+//
+// The keys are object keys from the outermost object inwards, the same as for `json.GetByKeyPath`;
+// with no key the whole document is used. String values are printed decoded unless -raw is given.
+// With -iterate, every element of the array, or every member of the object, found at the key path
+// is printed on its own line, members as `key<TAB>value`, nested arrays and objects compacted.
+//
+// Exit status:
+//
+//	0  the value was found
+//	1  the key path was not found
+//	2  bad usage or the input could not be read
+//	3  the input is not valid json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/lnshi/json-lookup/tool/json"
+)
+
+const (
+	exitOK = iota
+	exitNotFound
+	exitUsage
+	exitInvalidJson
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("jsonlookup", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	file := flags.String("f", "-", "json file to read, \"-\" for stdin")
+	iterate := flags.Bool("iterate", false, "print each array element or object member on its own line")
+	raw := flags.Bool("raw", false, "print string values as they are written in the json, escapes not decoded")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: jsonlookup [flags] [key ...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	keys := flags.Args()
+
+	var (
+		data []byte
+		err  error
+	)
+	if *file == "-" {
+		data, err = ioutil.ReadAll(stdin)
+	} else {
+		data, err = ioutil.ReadFile(*file)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "jsonlookup: %s\n", err)
+		return exitUsage
+	}
+
+	// `GetByKeyPath` only checks what it walks through, validate the whole input up front.
+	if _, err := json.Compact(data); err != nil {
+		fmt.Fprintf(stderr, "jsonlookup: %s: %s\n", *file, err)
+		return exitInvalidJson
+	}
+
+	value, err := lookup(data, keys)
+	if err == json.JsonPathNotFound {
+		fmt.Fprintf(stderr, "jsonlookup: key path %q not found\n", keys)
+		return exitNotFound
+	} else if err != nil {
+		fmt.Fprintf(stderr, "jsonlookup: %s\n", err)
+		return exitInvalidJson
+	}
+
+	p := &printer{raw: *raw, out: stdout}
+
+	if !*iterate {
+		if err := p.printValue(value.V, value.Str); err != nil {
+			fmt.Fprintf(stderr, "jsonlookup: %s\n", err)
+			return exitInvalidJson
+		}
+		return exitOK
+	}
+
+	if value.Str || (value.V[0] != '[' && value.V[0] != '{') {
+		fmt.Fprintf(stderr, "jsonlookup: value at key path %q is neither an array nor an object\n", keys)
+		return exitUsage
+	}
+	if err := p.iterate(value.V); err != nil {
+		fmt.Fprintf(stderr, "jsonlookup: %s\n", err)
+		return exitInvalidJson
+	}
+	return exitOK
+}
+
+func lookup(data []byte, keys []string) (*json.V, error) {
+	if len(keys) == 0 {
+		// `data` was validated, so it is known to hold exactly one value.
+		start, end := 0, len(data)
+		for isWhiteSpace(data[start]) {
+			start++
+		}
+		for isWhiteSpace(data[end-1]) {
+			end--
+		}
+		if data[start] == '"' {
+			return &json.V{V: data[start+1 : end-1], Str: true}, nil
+		}
+		return &json.V{V: data[start:end]}, nil
+	}
+
+	ch := make(chan *json.V)
+	go json.GetByKeyPath(ch, data, keys...)
+
+	res, ok := <-ch
+	if !ok {
+		return nil, json.InvalidJson
+	}
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return res, nil
+}
+
+type printer struct {
+	raw bool
+	out io.Writer
+}
+
+// printValue prints `value`, decoding it if `str`, a string value whose quotes were stripped off.
+func (p *printer) printValue(value []byte, str bool) error {
+	if str {
+		str, err := p.decode(value)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.out, "%s\n", str)
+		return err
+	}
+
+	_, err := fmt.Fprintf(p.out, "%s\n", value)
+	return err
+}
+
+func (p *printer) iterate(value []byte) error {
+	if value[0] == '[' {
+		ch := make(chan *json.V)
+		go json.IterateArray(ch, value)
+
+		for v := range ch {
+			if v.Err != nil {
+				return v.Err
+			}
+			elem, err := p.oneLine(v.V, v.Str)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(p.out, "%s\n", elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ch := make(chan *json.Kv)
+	go json.IterateObject(ch, value)
+
+	for kv := range ch {
+		if kv.Err != nil {
+			return kv.Err
+		}
+		key, err := p.decode(kv.K)
+		if err != nil {
+			return err
+		}
+		val, err := p.oneLine(kv.V, kv.Str)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(p.out, "%s\t%s\n", key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *printer) oneLine(value []byte, str bool) ([]byte, error) {
+	if str {
+		return p.decode(value)
+	}
+	if len(value) > 0 && (value[0] == '[' || value[0] == '{') {
+		return json.Compact(value)
+	}
+	return value, nil
+}
+
+func (p *printer) decode(str []byte) ([]byte, error) {
+	if p.raw {
+		return str, nil
+	}
+	return json.Unescape(str)
+}
+
+func isWhiteSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t'
+}
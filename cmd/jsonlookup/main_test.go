@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var RunTests = []struct {
+	desc       string
+	args       []string
+	stdin      string
+	expectCode int
+	expectOut  string
+}{
+	{
+		desc:       "String value is decoded",
+		args:       []string{"a", "b"},
+		stdin:      `{"a":{"b":"bachelors\ngraduate"}}`,
+		expectCode: exitOK,
+		expectOut:  "bachelors\ngraduate\n",
+	}, {
+		desc:       "String value is kept raw",
+		args:       []string{"-raw", "a", "b"},
+		stdin:      `{"a":{"b":"bachelors\ngraduate"}}`,
+		expectCode: exitOK,
+		expectOut:  "bachelors\\ngraduate\n",
+	}, {
+		desc:       "Structure value is printed as it is",
+		args:       []string{"a"},
+		stdin:      `{"a": {"b" : 1}}`,
+		expectCode: exitOK,
+		expectOut:  "{\"b\" : 1}\n",
+	}, {
+		desc:       "Iterate over an array",
+		args:       []string{"-iterate", "a"},
+		stdin:      `{"a":[1, "x\ty", {"b": [ 2 ]}, "[not an array]"]}`,
+		expectCode: exitOK,
+		expectOut:  "1\nx\ty\n{\"b\":[2]}\n[not an array]\n",
+	}, {
+		desc:       "Iterate over an object",
+		args:       []string{"--iterate"},
+		stdin:      `{"a":1, "b":"leonard"}`,
+		expectCode: exitOK,
+		expectOut:  "a\t1\nb\tleonard\n",
+	}, {
+		desc:       "Iterate over a string",
+		args:       []string{"-iterate", "a"},
+		stdin:      `{"a":"[1,2]"}`,
+		expectCode: exitUsage,
+	}, {
+		desc:       "Whole document is a string",
+		stdin:      " \"[1,\\u0032]\"\n",
+		expectCode: exitOK,
+		expectOut:  "[1,2]\n",
+	}, {
+		desc:       "Strings are told apart from the other values",
+		args:       []string{"-iterate"},
+		stdin:      `{"a":"","b":"[1, \u0032]","c":[1, 2]}`,
+		expectCode: exitOK,
+		expectOut:  "a\t\nb\t[1, 2]\nc\t[1,2]\n",
+	}, {
+		desc:       "Escaped quotes in keys and values",
+		args:       []string{"a\\\"b"},
+		stdin:      `{"a\"b":"say \"hi\"", "c":1}`,
+		expectCode: exitOK,
+		expectOut:  "say \"hi\"\n",
+	}, {
+		desc:       "Key path not found",
+		args:       []string{"a", "c"},
+		stdin:      `{"a":{"b":1}}`,
+		expectCode: exitNotFound,
+	}, {
+		desc:       "Invalid input",
+		args:       []string{"a"},
+		stdin:      `{"a":{"b":1}`,
+		expectCode: exitInvalidJson,
+	},
+}
+
+func TestRun(t *testing.T) {
+	for _, test := range RunTests {
+		var stdout, stderr bytes.Buffer
+
+		code := run(test.args, strings.NewReader(test.stdin), &stdout, &stderr)
+		if code != test.expectCode {
+			t.Errorf("run(%s) exited with %d, expected %d, stderr: %s", test.desc, code, test.expectCode, stderr.String())
+		}
+		if stdout.String() != test.expectOut {
+			t.Errorf("run(%s) printed %q, expected %q", test.desc, stdout.String(), test.expectOut)
+		}
+	}
+}
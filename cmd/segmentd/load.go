@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/lnshi/json-lookup/lookupcache"
+	"github.com/lnshi/json-lookup/tool/json"
+)
+
+// loadCache reads the data file at `path`, and the sidecar numeric rules file at `rulesPath` if not empty,
+// and makes sure they parse cleanly before they are served.
+func loadCache(path string, rulesPath string) (*lookupcache.Cache, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := json.Compact(data); err != nil {
+		return nil, err
+	}
+
+	var opts []lookupcache.Option
+	if rulesPath != "" {
+		opt, err := lookupcache.NumericRulesFromFile(rulesPath)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+	}
+
+	// Parse all the orgs up front, so the first lookups don't pay for it.
+	ec := lookupcache.New(data, opts...)
+	if err := ec.Load(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return ec, nil
+}
+
+// runLoads calls `load` once, then once per signal received from `reloads` until it is closed, all in the calling
+// goroutine. A load only starts once the previous one is done, so a slow load can't finish after a later one and
+// serve its older data over theirs. The signals received meanwhile wait in `reloads`.
+func runLoads(reloads <-chan os.Signal, load func()) {
+	load()
+	for range reloads {
+		load()
+	}
+}
@@ -0,0 +1,123 @@
+// Command segmentd serves segment lookups over http, and optionally gRPC, so callers don't have to
+// load the data file themselves.
+//
+// Endpoints:
+//
+//	GET /orgs/{org}/params/{key}?val=...  the []SegmentConfig as json, without val it is a GetSegmentForOrgAndKey
+//	GET /healthz                          200 as long as the process is up
+//	GET /readyz                           200 once the data file parsed cleanly, 503 before and while shutting down
+//
+// With -grpc-addr, the `lookuppb.SegmentLookup` service is served there as well. With -rules, the numeric rules
+// of that sidecar file are added to those of the data file, see `lookupcache.NumericRules`.
+//
+// The server listens right away and loads the data file in the background. On SIGHUP it reloads the files, once
+// the loads before are done, keeping the previous data if the new one doesn't parse, and pushes the changes to gRPC
+// `WatchOrg` streams.
+// On SIGINT or SIGTERM it turns not ready and lets in-flight requests finish before exiting.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/lnshi/json-lookup/lookupcache"
+	"github.com/lnshi/json-lookup/lookupcache/lookuppb"
+	"github.com/lnshi/json-lookup/lookupcache/lookuprpc"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to serve http on")
+	grpcAddr := flag.String("grpc-addr", "", "address to serve gRPC on, disabled if empty")
+	dataFile := flag.String("data", lookupcache.DefaultDataFile, "data file to serve")
+	rulesFile := flag.String("rules", "", "sidecar file of numeric rules to add to the data file")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for in-flight requests on shutdown")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := &server{}
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	rpcServer := lookuprpc.NewServer(nil)
+	grpcSrv := grpc.NewServer()
+	lookuppb.RegisterSegmentLookupServer(grpcSrv, rpcServer)
+
+	load := func() {
+		start := time.Now()
+		ec, err := loadCache(*dataFile, *rulesFile)
+		if err != nil {
+			log.Printf("segmentd: loading %s failed: %s", *dataFile, err)
+			// A failed reload keeps serving the data loaded before.
+			if cache, _ := s.readyCache(); cache == nil {
+				s.setLoadErr(err)
+			}
+			return
+		}
+		s.setCache(ec)
+		rpcServer.SetCache(ec)
+		log.Printf("segmentd: loaded %s in %s", *dataFile, time.Since(start))
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go runLoads(hup, load)
+
+	serveErr := make(chan error, 2)
+	go func() {
+		log.Printf("segmentd: serving http on %s", *addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatalf("segmentd: %s", err)
+		}
+		go func() {
+			log.Printf("segmentd: serving gRPC on %s", *grpcAddr)
+			serveErr <- grpcSrv.Serve(lis)
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		log.Fatalf("segmentd: %s", err)
+	case <-ctx.Done():
+	}
+
+	log.Printf("segmentd: shutting down")
+	s.setClosing()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcSrv.GracefulStop()
+		close(grpcStopped)
+	}()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("segmentd: shutdown: %s", err)
+	}
+
+	select {
+	case <-grpcStopped:
+	case <-shutdownCtx.Done():
+		// `WatchOrg` streams never end on their own.
+		grpcSrv.Stop()
+	}
+}
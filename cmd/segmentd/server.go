@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/lnshi/json-lookup/lookupcache"
+)
+
+// server serves lookups on a `LookupCache` over http, it isn't ready until it is given one.
+type server struct {
+	lock    sync.RWMutex
+	cache   lookupcache.LookupCache
+	loadErr error
+	closing bool
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/", getOnly(s.lookup))
+	mux.HandleFunc("/healthz", getOnly(s.health))
+	mux.HandleFunc("/readyz", getOnly(s.ready))
+	return mux
+}
+
+// setCache makes the server ready to serve lookups on `cache`.
+func (s *server) setCache(cache lookupcache.LookupCache) {
+	s.lock.Lock()
+	s.cache, s.loadErr = cache, nil
+	s.lock.Unlock()
+}
+
+// setLoadErr records why the server couldn't become ready, it is reported by the readiness endpoint.
+func (s *server) setLoadErr(err error) {
+	s.lock.Lock()
+	s.loadErr = err
+	s.lock.Unlock()
+}
+
+// setClosing turns the server not ready, so it gets taken out of rotation while shutting down.
+func (s *server) setClosing() {
+	s.lock.Lock()
+	s.closing = true
+	s.lock.Unlock()
+}
+
+func (s *server) readyCache() (lookupcache.LookupCache, string) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	switch {
+	case s.closing:
+		return nil, "shutting down"
+	case s.loadErr != nil:
+		return nil, "loading data failed: " + s.loadErr.Error()
+	case s.cache == nil:
+		return nil, "loading data"
+	default:
+		return s.cache, ""
+	}
+}
+
+// lookup serves `GET /orgs/{org}/params/{key}?val=...`, without `val` it is a `GetSegmentForOrgAndKey`.
+func (s *server) lookup(w http.ResponseWriter, r *http.Request) {
+	orgKey, paramKey, ok := parseLookupPath(r.URL.EscapedPath())
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	cache, reason := s.readyCache()
+	if cache == nil {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+
+	var segs []lookupcache.SegmentConfig
+	if vals, ok := r.URL.Query()["val"]; ok {
+		segs = cache.GetSegmentForOrgAndKeyAndVal(orgKey, paramKey, vals[0])
+	} else {
+		segs = cache.GetSegmentForOrgAndKey(orgKey, paramKey)
+	}
+
+	writeJson(w, segs)
+}
+
+// health is the liveness probe, the process is alive as long as it answers.
+func (s *server) health(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// ready is the readiness probe, it only succeeds once the data file parsed cleanly.
+func (s *server) ready(w http.ResponseWriter, r *http.Request) {
+	if cache, reason := s.readyCache(); cache == nil {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// parseLookupPath splits `/orgs/{org}/params/{key}`, the keys are unescaped one by one so they may hold a '/'.
+func parseLookupPath(escapedPath string) (orgKey, paramKey string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(escapedPath, "/orgs/"), "/")
+	if len(parts) != 3 || parts[1] != "params" || parts[0] == "" || parts[2] == "" {
+		return "", "", false
+	}
+
+	orgKey, err := url.PathUnescape(parts[0])
+	if err != nil {
+		return "", "", false
+	}
+	paramKey, err = url.PathUnescape(parts[2])
+	if err != nil {
+		return "", "", false
+	}
+
+	return orgKey, paramKey, true
+}
+
+func getOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	res, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("segmentd: encoding response: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(res, '\n'))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lnshi/json-lookup/lookupcache"
+)
+
+const testDataFile = "../../data/data.json"
+
+func get(t *testing.T, url string) (int, []byte) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed with error %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("GET %s failed reading body with error %s", url, err)
+	}
+	return resp.StatusCode, body
+}
+
+var LookupTests = []struct {
+	desc   string
+	path   string
+	expect []lookupcache.SegmentConfig
+}{
+	{
+		desc:   "As test case in README.md line 100",
+		path:   "/orgs/6lkb2cv/params/Edu?val=high_school",
+		expect: []lookupcache.SegmentConfig{{Id: "intr.edu.scho"}, {Id: "intr.edu"}},
+	}, {
+		desc:   "Value with spaces and a slash",
+		path:   "/orgs/6lkb2cv/params/sub?val=Engineering%20%2F%20Architecture",
+		expect: []lookupcache.SegmentConfig{{Id: "dem.emp.con-arch-des"}, {Id: "dem.emp.eng"}},
+	}, {
+		desc:   "Without val",
+		path:   "/orgs/6lkb2cv/params/sid",
+		expect: []lookupcache.SegmentConfig{{Id: "dem.life.expat"}},
+	}, {
+		desc:   "Empty val is the same as no val",
+		path:   "/orgs/6lkb2cv/params/sid?val=",
+		expect: []lookupcache.SegmentConfig{{Id: "dem.life.expat"}},
+	}, {
+		desc:   "Unknown param",
+		path:   "/orgs/6lkb2cv/params/Edu2",
+		expect: []lookupcache.SegmentConfig{},
+	}, {
+		desc:   "Escaped keys",
+		path:   "/orgs/6lkb2cv/params/%73id",
+		expect: []lookupcache.SegmentConfig{{Id: "dem.life.expat"}},
+	}, {
+		desc:   "Unknown org",
+		path:   "/orgs/nonexistent/params/gen?val=Male",
+		expect: []lookupcache.SegmentConfig{},
+	},
+}
+
+func TestServer(t *testing.T) {
+	s := &server{}
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	if code, _ := get(t, ts.URL+"/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz returned %d before loading, expected %d", code, http.StatusOK)
+	}
+	if code, _ := get(t, ts.URL+"/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz returned %d before loading, expected %d", code, http.StatusServiceUnavailable)
+	}
+	if code, _ := get(t, ts.URL+"/orgs/6lkb2cv/params/sid"); code != http.StatusServiceUnavailable {
+		t.Errorf("lookup returned %d before loading, expected %d", code, http.StatusServiceUnavailable)
+	}
+
+	ec, err := loadCache(testDataFile, "")
+	if err != nil {
+		t.Fatalf("loadCache failed with error %s", err)
+	}
+	s.setCache(ec)
+
+	if code, _ := get(t, ts.URL+"/readyz"); code != http.StatusOK {
+		t.Errorf("/readyz returned %d after loading, expected %d", code, http.StatusOK)
+	}
+
+	for _, test := range LookupTests {
+		code, body := get(t, ts.URL+test.path)
+		if code != http.StatusOK {
+			t.Errorf("GET %s (%s) returned %d, expected %d", test.path, test.desc, code, http.StatusOK)
+			continue
+		}
+
+		var res []lookupcache.SegmentConfig
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Errorf("GET %s (%s) returned %s, which failed to decode with error %s", test.path, test.desc, body, err)
+			continue
+		}
+		if res == nil || len(res) != len(test.expect) {
+			t.Errorf("GET %s (%s) returned %s, expected %v", test.path, test.desc, body, test.expect)
+			continue
+		}
+		for idx := range res {
+			if res[idx].Id != test.expect[idx].Id {
+				t.Errorf("GET %s (%s) returned %s, expected %v", test.path, test.desc, body, test.expect)
+				break
+			}
+		}
+	}
+
+	for _, path := range []string{"/orgs/6lkb2cv", "/orgs/6lkb2cv/params/", "/orgs/6lkb2cv/segs/sid", "/orgs/6lkb2cv/params/sid/x"} {
+		if code, _ := get(t, ts.URL+path); code != http.StatusNotFound {
+			t.Errorf("GET %s returned %d, expected %d", path, code, http.StatusNotFound)
+		}
+	}
+	if resp, err := http.Post(ts.URL+"/orgs/6lkb2cv/params/sid", "application/json", nil); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST on a lookup returned %v, expected %d, and err is %v", resp, http.StatusMethodNotAllowed, err)
+	}
+
+	s.setClosing()
+	if code, _ := get(t, ts.URL+"/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz returned %d while shutting down, expected %d", code, http.StatusServiceUnavailable)
+	}
+	if code, _ := get(t, ts.URL+"/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz returned %d while shutting down, expected %d", code, http.StatusOK)
+	}
+}
+
+func TestServerLoadFailure(t *testing.T) {
+	corrupt := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(corrupt, []byte(`[{"6lkb2cv": [{"gen": [}]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &server{}
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	_, err := loadCache(corrupt, "")
+	if err == nil {
+		t.Fatalf("loadCache on a corrupt file succeeded")
+	}
+	s.setLoadErr(err)
+
+	if code, _ := get(t, ts.URL+"/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz returned %d after a failed load, expected %d", code, http.StatusServiceUnavailable)
+	}
+
+	if _, err := loadCache(filepath.Join(t.TempDir(), "missing.json"), ""); err == nil {
+		t.Errorf("loadCache on a missing file succeeded")
+	}
+}
+
+func TestRunLoads(t *testing.T) {
+	reloads := make(chan os.Signal, 3)
+	for i := 0; i < 3; i++ {
+		reloads <- syscall.SIGHUP
+	}
+	close(reloads)
+
+	var running, done int32
+	var order []int32
+	runLoads(reloads, func() {
+		if atomic.AddInt32(&running, 1) != 1 {
+			t.Errorf("a load started while another one was running")
+		}
+		if len(order) == 0 {
+			// The first load is the slowest, the reloads must still wait for it.
+			time.Sleep(10 * time.Millisecond)
+		}
+		order = append(order, atomic.AddInt32(&done, 1))
+		atomic.AddInt32(&running, -1)
+	})
+
+	if len(order) != 4 || order[0] != 1 || order[3] != 4 {
+		t.Errorf("the loads finished in the order %v, expected [1 2 3 4]", order)
+	}
+}
@@ -0,0 +1,253 @@
+// Command segments answers "which segments does org X get for param Y=Z" from a data file.
+//
+// Usage:
+//
+//	segments [-data file] [-format table|json|csv] -orgs
+//	segments [-data file] [-format table|json|csv] -org X
+//	segments [-data file] [-format table|json|csv] -org X -param Y [-val Z]
+//	segments [-data file] [-format table|json|csv] -i
+//
+// The first form lists all orgs, the second the params configured for org X, the third looks segments up
+// the same as `LookupCache` does, but exits with status 1 for an unknown org or param. With -i, the same queries are read from stdin one per line, see `help`.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lnshi/json-lookup/lookupcache"
+)
+
+const (
+	exitOK = iota
+	exitFailure
+	exitUsage
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("segments", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dataFile := flags.String("data", lookupcache.DefaultDataFile, "data file to load")
+	rulesFile := flags.String("rules", "", "sidecar file of numeric rules to add to the data file")
+	format := flags.String("format", "table", "output format: table, json or csv")
+	listOrgs := flags.Bool("orgs", false, "list all orgs")
+	orgKey := flags.String("org", "", "org key")
+	paramKey := flags.String("param", "", "param key, lists the params of -org if not given")
+	paramVal := flags.String("val", "", "param value")
+	interactive := flags.Bool("i", false, "read queries from stdin")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: segments [flags]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if !isFormat(*format) {
+		fmt.Fprintf(stderr, "segments: unknown format %q\n", *format)
+		return exitUsage
+	}
+
+	var opts []lookupcache.Option
+	if *rulesFile != "" {
+		opt, err := lookupcache.NumericRulesFromFile(*rulesFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "segments: %s\n", err)
+			return exitFailure
+		}
+		opts = append(opts, opt)
+	}
+
+	ec, err := lookupcache.NewFromFile(*dataFile, opts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "segments: %s\n", err)
+		return exitFailure
+	}
+	s := &session{ec: ec, format: *format, out: stdout}
+
+	var t *table
+	switch {
+	case *interactive:
+		if err := s.repl(stdin); err != nil {
+			fmt.Fprintf(stderr, "segments: %s\n", err)
+			return exitFailure
+		}
+		return exitOK
+	case *listOrgs:
+		t, err = s.orgs()
+	case *orgKey != "" && *paramKey == "":
+		t, err = s.params(*orgKey)
+	case *orgKey != "":
+		t, err = s.segments(*orgKey, *paramKey, *paramVal)
+	default:
+		flags.Usage()
+		return exitUsage
+	}
+	if err == nil {
+		err = t.write(stdout, s.format)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "segments: %s\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+type session struct {
+	ec     *lookupcache.Cache
+	format string
+	out    io.Writer
+}
+
+func (s *session) orgs() (*table, error) {
+	orgKeys, err := s.ec.OrgKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &table{header: []string{"org"}}
+	for _, orgKey := range orgKeys {
+		t.rows = append(t.rows, []string{orgKey})
+	}
+	return t, nil
+}
+
+func (s *session) params(orgKey string) (*table, error) {
+	paramKeys := s.ec.ParamKeys(orgKey)
+	if paramKeys == nil {
+		return nil, fmt.Errorf("org %q not found", orgKey)
+	}
+
+	t := &table{header: []string{"org", "param"}}
+	for _, paramKey := range paramKeys {
+		t.rows = append(t.rows, []string{orgKey, paramKey})
+	}
+	return t, nil
+}
+
+// segments looks the segments up, telling an unknown org or param from a value which matches nothing.
+func (s *session) segments(orgKey, paramKey, paramVal string) (*table, error) {
+	segs, err := s.ec.GetSegmentForOrgAndKeyAndValE(orgKey, paramKey, paramVal)
+	switch {
+	case errors.Is(err, lookupcache.ErrOrgNotFound):
+		return nil, fmt.Errorf("org %q not found", orgKey)
+	case errors.Is(err, lookupcache.ErrParamNotFound):
+		return nil, fmt.Errorf("param %q not found for org %q", paramKey, orgKey)
+	case err != nil:
+		return nil, err
+	}
+
+	t := &table{header: []string{"org", "param", "val", "segmentId"}}
+	for _, seg := range segs {
+		t.rows = append(t.rows, []string{orgKey, paramKey, paramVal, seg.GetId()})
+	}
+	return t, nil
+}
+
+const replHelp = `commands:
+  get <org> <param> [val]   segments org gets for param=val
+  orgs                      list all orgs
+  params <org>              list the params of org
+  format table|json|csv     switch the output format
+  help                      show this help
+  quit                      leave
+arguments with spaces can be quoted: get 6lkb2cv sub "Engineering / Architecture"
+`
+
+func (s *session) repl(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+
+	for {
+		fmt.Fprint(s.out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(s.out)
+			return scanner.Err()
+		}
+
+		args, err := splitArgs(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(s.out, "error: %s\n", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		var t *table
+		switch cmd := args[0]; {
+		case cmd == "quit" || cmd == "exit":
+			return nil
+		case cmd == "help":
+			fmt.Fprint(s.out, replHelp)
+			continue
+		case cmd == "format" && len(args) == 2 && isFormat(args[1]):
+			s.format = args[1]
+			continue
+		case cmd == "orgs" && len(args) == 1:
+			t, err = s.orgs()
+		case cmd == "params" && len(args) == 2:
+			t, err = s.params(args[1])
+		case cmd == "get" && (len(args) == 3 || len(args) == 4):
+			args = append(args, "")
+			t, err = s.segments(args[1], args[2], args[3])
+		default:
+			err = errors.New("bad command, try help")
+		}
+		if err == nil {
+			err = t.write(s.out, s.format)
+		}
+		if err != nil {
+			fmt.Fprintf(s.out, "error: %s\n", err)
+		}
+	}
+}
+
+// splitArgs splits `line` at white spaces, except for those in a single or double quoted part.
+func splitArgs(line string) ([]string, error) {
+	var (
+		args    []string
+		curr    strings.Builder
+		inArg   bool
+		quoteCh rune
+	)
+
+	for _, ch := range line {
+		switch {
+		case quoteCh != 0 && ch == quoteCh:
+			quoteCh = 0
+		case quoteCh != 0:
+			curr.WriteRune(ch)
+		case ch == '"' || ch == '\'':
+			quoteCh, inArg = ch, true
+		case ch == ' ' || ch == '\t':
+			if inArg {
+				args = append(args, curr.String())
+				curr.Reset()
+				inArg = false
+			}
+		default:
+			curr.WriteRune(ch)
+			inArg = true
+		}
+	}
+	if quoteCh != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		args = append(args, curr.String())
+	}
+
+	return args, nil
+}
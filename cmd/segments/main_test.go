@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDataFile = "../../data/data.json"
+
+var RunTests = []struct {
+	desc       string
+	args       []string
+	stdin      string
+	expectCode int
+	expectOut  string
+}{
+	{
+		desc:       "Lookup with a value, as csv",
+		args:       []string{"-format", "csv", "-org", "6lkb2cv", "-param", "Edu", "-val", "high_school"},
+		expectCode: exitOK,
+		expectOut:  "org,param,val,segmentId\n6lkb2cv,Edu,high_school,intr.edu.scho\n6lkb2cv,Edu,high_school,intr.edu\n",
+	}, {
+		desc:       "Lookup without a value, as table",
+		args:       []string{"-org", "6lkb2cv", "-param", "sid"},
+		expectCode: exitOK,
+		expectOut:  "ORG      PARAM  VAL  SEGMENTID\n6lkb2cv  sid    \"\"   dem.life.expat\n",
+	}, {
+		desc:       "Lookup as json",
+		args:       []string{"-format", "json", "-org", "6lkb2cv", "-param", "gen", "-val", "Male"},
+		expectCode: exitOK,
+		expectOut:  "[\n  {\n    \"org\": \"6lkb2cv\",\n    \"param\": \"gen\",\n    \"segmentId\": \"dem.g.m\",\n    \"val\": \"Male\"\n  }\n]\n",
+	}, {
+		desc:       "Lookup matching nothing",
+		args:       []string{"-format", "csv", "-org", "6lkb2cv", "-param", "gen", "-val", "Other"},
+		expectCode: exitOK,
+		expectOut:  "org,param,val,segmentId\n",
+	}, {
+		desc:       "Lookup for an unknown org",
+		args:       []string{"-format", "csv", "-org", "nonexistent", "-param", "gen"},
+		expectCode: exitFailure,
+	}, {
+		desc:       "Lookup for an unknown param",
+		args:       []string{"-format", "csv", "-org", "6lkb2cv", "-param", "nonexistent"},
+		expectCode: exitFailure,
+	}, {
+		desc:       "Params of an org",
+		args:       []string{"-format", "csv", "-org", "bkie9g1"},
+		expectCode: exitOK,
+		expectOut:  "org,param\nbkie9g1,_\nbkie9g1,cat\n",
+	}, {
+		desc:       "Params of an unknown org",
+		args:       []string{"-org", "nonexistent"},
+		expectCode: exitFailure,
+	}, {
+		desc:       "Unknown format",
+		args:       []string{"-format", "xml", "-orgs"},
+		expectCode: exitUsage,
+	}, {
+		desc:       "Nothing to do",
+		args:       []string{},
+		expectCode: exitUsage,
+	}, {
+		desc:       "Interactive",
+		args:       []string{"-i", "-format", "csv"},
+		stdin:      "get 6lkb2cv sub \"Engineering / Architecture\"\nget 6lkb2cv kids\nformat table\nget 6lkb2cv\nquit\nget 6lkb2cv sid\n",
+		expectCode: exitOK,
+		expectOut: "> org,param,val,segmentId\n" +
+			"6lkb2cv,sub,Engineering / Architecture,dem.emp.con-arch-des\n" +
+			"6lkb2cv,sub,Engineering / Architecture,dem.emp.eng\n" +
+			"> error: param \"kids\" not found for org \"6lkb2cv\"\n" +
+			"> > error: bad command, try help\n> ",
+	},
+}
+
+func TestRun(t *testing.T) {
+	for _, test := range RunTests {
+		var stdout, stderr bytes.Buffer
+
+		args := append([]string{"-data", testDataFile}, test.args...)
+		code := run(args, strings.NewReader(test.stdin), &stdout, &stderr)
+		if code != test.expectCode {
+			t.Errorf("run(%s) exited with %d, expected %d, stderr: %s", test.desc, code, test.expectCode, stderr.String())
+		}
+		if test.expectCode == exitOK && stdout.String() != test.expectOut {
+			t.Errorf("run(%s) printed %q, expected %q", test.desc, stdout.String(), test.expectOut)
+		}
+	}
+}
+
+func TestRunListOrgs(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	if code := run([]string{"-data", testDataFile, "-format", "csv", "-orgs"}, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run(-orgs) exited with %d, stderr: %s", code, stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 118 || lines[0] != "org" || lines[1] != "6lkb2cv" {
+		t.Errorf("run(-orgs) printed %d lines starting with %q, expected the header and 117 orgs starting with 6lkb2cv", len(lines), lines[:2])
+	}
+}
+
+func TestRunNumericRules(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	rulesFile := filepath.Join(t.TempDir(), "rules.json")
+	if err := ioutil.WriteFile(rulesFile, []byte(`[{"1a9n4ou": [{"age": [{"95+": {"segmentId": "dem.ag.95+"}}]}]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"-data", testDataFile, "-rules", rulesFile, "-format", "csv", "-org", "1a9n4ou", "-param", "age", "-val", "100"}
+	if code := run(args, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run(-rules) exited with %d, stderr: %s", code, stderr.String())
+	}
+	if expect := "org,param,val,segmentId\n1a9n4ou,age,100,dem.ag.95+\n"; stdout.String() != expect {
+		t.Errorf("run(-rules) printed %q, expected %q", stdout.String(), expect)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"-data", testDataFile, "-rules", filepath.Join(t.TempDir(), "missing.json"), "-orgs"}, nil, &stdout, &stderr); code != exitFailure {
+		t.Errorf("run(-rules) with a missing rules file exited with %d, expected %d", code, exitFailure)
+	}
+}
+
+var splitArgsTests = []struct {
+	line   string
+	expect []string
+}{
+	{line: `  get  6lkb2cv gen Male `, expect: []string{"get", "6lkb2cv", "gen", "Male"}},
+	{line: `get 6lkb2cv sub "Engineering / Architecture"`, expect: []string{"get", "6lkb2cv", "sub", "Engineering / Architecture"}},
+	{line: `get 6lkb2cv sid ''`, expect: []string{"get", "6lkb2cv", "sid", ""}},
+}
+
+func TestSplitArgs(t *testing.T) {
+	for _, test := range splitArgsTests {
+		res, err := splitArgs(test.line)
+		if err != nil || strings.Join(res, "|") != strings.Join(test.expect, "|") || len(res) != len(test.expect) {
+			t.Errorf("splitArgs(%s) returned %q, expected %q, and err is %v", test.line, res, test.expect, err)
+		}
+	}
+	if _, err := splitArgs(`get "6lkb2cv`); err == nil {
+		t.Errorf("splitArgs with an unterminated quote succeeded")
+	}
+}
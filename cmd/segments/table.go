@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+var formats = []string{"table", "json", "csv"}
+
+func isFormat(format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// table is the result of one query, written out in any of the `formats`.
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+func (t *table) write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return t.writeJson(w)
+	case "csv":
+		return t.writeCsv(w)
+	default:
+		return t.writeTable(w)
+	}
+}
+
+func (t *table) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(t.header, "\t")))
+	for _, row := range t.rows {
+		cells := make([]string, len(row))
+		for idx, cell := range row {
+			// Multi-valued param values hold new lines, keep every row on one line.
+			if strings.ContainsAny(cell, "\t\n\r") || cell == "" {
+				cell = strconv.Quote(cell)
+			}
+			cells[idx] = cell
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// writeJson writes one object per row, keyed by the header.
+func (t *table) writeJson(w io.Writer) error {
+	objs := make([]map[string]string, 0, len(t.rows))
+	for _, row := range t.rows {
+		obj := make(map[string]string, len(t.header))
+		for idx, col := range t.header {
+			obj[col] = row[idx]
+		}
+		objs = append(objs, obj)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(objs)
+}
+
+func (t *table) writeCsv(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(t.header)
+	cw.WriteAll(t.rows)
+	return cw.Error()
+}
@@ -0,0 +1,110 @@
+// Command segsnap builds the snapshot of a data file, which caches created with `lookupcache.WithSnapshotFile`
+// read the orgs from instead of parsing the data file.
+//
+// Usage:
+//
+//	segsnap [-data file] [-rules file] [-o file]
+//	segsnap [-data file] [-rules file] [-o file] -check
+//
+// The snapshot is written to -o, the data file followed by ".snap" by default. It holds the numeric rules of -rules
+// as well, caches must be created with the same ones. With -check, nothing is written, it exits with status 1 if
+// the snapshot isn't up to date with the data file and the numeric rules of -rules, none if not given.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/lnshi/json-lookup/lookupcache"
+)
+
+const (
+	exitOK = iota
+	exitFailure
+	exitUsage
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("segsnap", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dataFile := flags.String("data", lookupcache.DefaultDataFile, "data file to build the snapshot of")
+	rulesFile := flags.String("rules", "", "sidecar file of numeric rules to add to the data file")
+	outFile := flags.String("o", "", "snapshot file to write, the data file followed by .snap if not given")
+	check := flags.Bool("check", false, "check the snapshot is up to date instead of writing it")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: segsnap [flags]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if *outFile == "" {
+		*outFile = *dataFile + ".snap"
+	}
+
+	var opts []lookupcache.Option
+	if *rulesFile != "" {
+		opt, err := lookupcache.NumericRulesFromFile(*rulesFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "segsnap: %s\n", err)
+			return exitFailure
+		}
+		opts = append(opts, opt)
+	}
+
+	if *check {
+		ec, err := lookupcache.NewFromFile(*dataFile, append(opts, lookupcache.WithSnapshotFile(*outFile))...)
+		if err != nil {
+			fmt.Fprintf(stderr, "segsnap: %s\n", err)
+			return exitFailure
+		}
+		if err := ec.SnapshotError(); err != nil {
+			fmt.Fprintf(stderr, "segsnap: %s: %s\n", *outFile, err)
+			return exitFailure
+		}
+		fmt.Fprintf(stdout, "%s is up to date\n", *outFile)
+		return exitOK
+	}
+
+	ec, err := lookupcache.NewFromFile(*dataFile, opts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "segsnap: %s\n", err)
+		return exitFailure
+	}
+	if err := writeSnapshot(ec, *outFile); err != nil {
+		fmt.Fprintf(stderr, "segsnap: %s\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// writeSnapshot writes the snapshot of `ec` to `path` through a temporary file, so that a cache reading it
+// meanwhile never gets half of it.
+func writeSnapshot(ec *lookupcache.Cache, path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := ec.WriteSnapshot(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/lnshi/json-lookup/lookupcache"
+)
+
+const testDataFile = "../../data/data.json"
+
+func TestRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	snapFile := filepath.Join(t.TempDir(), "data.snap")
+
+	if code := run([]string{"-data", testDataFile, "-o", snapFile, "-check"}, &stdout, &stderr); code != exitFailure {
+		t.Errorf("run(-check) without a snapshot exited with %d, expected %d", code, exitFailure)
+	}
+
+	if code := run([]string{"-data", testDataFile, "-o", snapFile}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exited with %d, stderr: %s", code, stderr.String())
+	}
+	if code := run([]string{"-data", testDataFile, "-o", snapFile, "-check"}, &stdout, &stderr); code != exitOK {
+		t.Errorf("run(-check) exited with %d, stderr: %s", code, stderr.String())
+	}
+
+	ec, err := lookupcache.NewFromFile(testDataFile, lookupcache.WithSnapshotFile(snapFile))
+	if err != nil {
+		t.Fatalf("`NewFromFile` failed with error %s", err)
+	}
+	if err := ec.SnapshotError(); err != nil {
+		t.Errorf("the snapshot wasn't used: %s", err)
+	}
+	if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "gen", "Male"); len(res) != 1 || res[0].Id != "dem.g.m" {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` returned %s, expected [{dem.g.m}]", res)
+	}
+
+	// Another data file, the snapshot isn't up to date.
+	otherDataFile := filepath.Join(t.TempDir(), "data.json")
+	if err := ioutil.WriteFile(otherDataFile, []byte(`[{"6lkb2cv": []}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := run([]string{"-data", otherDataFile, "-o", snapFile, "-check"}, &stdout, &stderr); code != exitFailure {
+		t.Errorf("run(-check) of another data file exited with %d, expected %d", code, exitFailure)
+	}
+
+	// Other numeric rules, the snapshot isn't up to date either.
+	rulesFile := filepath.Join(t.TempDir(), "rules.json")
+	if err := ioutil.WriteFile(rulesFile, []byte(`[{"6lkb2cv": [{"age": [{"18-24": {"segmentId": "dem.ag.18-24"}}]}]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := run([]string{"-data", testDataFile, "-rules", rulesFile, "-o", snapFile, "-check"}, &stdout, &stderr); code != exitFailure {
+		t.Errorf("run(-check) with other numeric rules exited with %d, expected %d", code, exitFailure)
+	}
+	if code := run([]string{"-data", testDataFile, "-rules", rulesFile, "-o", snapFile}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run with numeric rules exited with %d, stderr: %s", code, stderr.String())
+	}
+	if code := run([]string{"-data", testDataFile, "-rules", rulesFile, "-o", snapFile, "-check"}, &stdout, &stderr); code != exitOK {
+		t.Errorf("run(-check) with the same numeric rules exited with %d, stderr: %s", code, stderr.String())
+	}
+	if code := run([]string{"-data", testDataFile, "-o", snapFile, "-check"}, &stdout, &stderr); code != exitFailure {
+		t.Errorf("run(-check) without the numeric rules exited with %d, expected %d", code, exitFailure)
+	}
+
+	if code := run([]string{"-data", filepath.Join(t.TempDir(), "missing.json")}, &stdout, &stderr); code != exitFailure {
+		t.Errorf("run with a missing data file exited with %d, expected %d", code, exitFailure)
+	}
+	if code := run([]string{"extra"}, &stdout, &stderr); code != exitUsage {
+		t.Errorf("run with an extra argument exited with %d, expected %d", code, exitUsage)
+	}
+}
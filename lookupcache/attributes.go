@@ -0,0 +1,97 @@
+package lookupcache
+
+import (
+	"sort"
+)
+
+// SegmentMatch is a segment found by `GetSegmentsForOrgAndAttributesWithProvenance`,
+// together with the keys of the attributes which produced it, sorted.
+type SegmentMatch struct {
+	SegmentConfig
+	Attributes []string
+}
+
+// GetSegmentsForOrgAndAttributes evaluates all the attributes of a user, e.g. {"gen": "Female", "age": "22"},
+// against `orgKey` and returns the union of the segments they match, each segment once.
+// It is the same as one `GetSegmentForOrgAndKeyAndVal` per attribute, but the org is only resolved once.
+// Segments come in the order of the sorted attribute keys, then in the order of the data file,
+// followed by those of the expression rules of the org, see `ExprRulePrefix`.
+func (ec *Cache) GetSegmentsForOrgAndAttributes(orgKey string, attrs map[string]string) []SegmentConfig {
+	matches := ec.GetSegmentsForOrgAndAttributesWithProvenance(orgKey, attrs)
+
+	res := make([]SegmentConfig, 0, len(matches))
+	for _, match := range matches {
+		res = append(res, match.SegmentConfig)
+	}
+	return res
+}
+
+// GetSegmentsForOrgAndAttributesWithProvenance is `GetSegmentsForOrgAndAttributes`,
+// also telling which attributes produced each segment.
+func (ec *Cache) GetSegmentsForOrgAndAttributesWithProvenance(orgKey string, attrs map[string]string) []SegmentMatch {
+	if orgKey == "" || len(attrs) == 0 {
+		return []SegmentMatch{}
+	}
+
+	entry, ok := ec.org(orgKey)
+	if !ok {
+		return []SegmentMatch{}
+	}
+	paramIndexes := entry.params
+
+	attrKeys := make([]string, 0, len(attrs))
+	for attrKey := range attrs {
+		attrKeys = append(attrKeys, attrKey)
+	}
+	sort.Strings(attrKeys)
+
+	res := make([]SegmentMatch, 0)
+	// Index of every segment in `res`, to merge the attributes producing the same segment.
+	resIdx := make(map[string]int)
+
+	for _, attrKey := range attrKeys {
+		idx, ok := paramIndexes[attrKey]
+		if !ok {
+			continue
+		}
+
+		for _, seg := range idx.match(ec.paramMatcher(attrKey), attrs[attrKey]) {
+			if idx, ok := resIdx[seg.Id]; ok {
+				// The same attribute may match several rules emitting this segment.
+				if attrs := res[idx].Attributes; attrs[len(attrs)-1] != attrKey {
+					res[idx].Attributes = append(attrs, attrKey)
+				}
+				continue
+			}
+			resIdx[seg.Id] = len(res)
+			res = append(res, SegmentMatch{SegmentConfig: seg, Attributes: []string{attrKey}})
+		}
+	}
+
+	for _, match := range ec.evalExprRules(paramIndexes, attrs) {
+		if idx, ok := resIdx[match.Id]; ok {
+			res[idx].Attributes = mergeSortedStrings(res[idx].Attributes, match.Attributes)
+			continue
+		}
+		resIdx[match.Id] = len(res)
+		res = append(res, match)
+	}
+
+	return res
+}
+
+// mergeSortedStrings returns the sorted union of the sorted `a` and `b`.
+func mergeSortedStrings(a, b []string) []string {
+	res := make([]string, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0] < b[0]):
+			res, a = append(res, a[0]), a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			res, b = append(res, b[0]), b[1:]
+		default:
+			res, a, b = append(res, a[0]), a[1:], b[1:]
+		}
+	}
+	return res
+}
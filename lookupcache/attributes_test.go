@@ -0,0 +1,96 @@
+package lookupcache
+
+import (
+	"testing"
+)
+
+const attributesTestData = `[
+  {"6lkb2cv": [
+    {"gen": [{"Female": {"segmentId": "dem.g.f"}}, {"Male": {"segmentId": "dem.g.m"}}]},
+    {"age": [{"18\n19\n20": {"segmentId": "dem.ag.18-20"}}, {"20\n21": {"segmentId": "dem.ag.young"}}]},
+    {"edu": [{"college": {"segmentId": "dem.ag.young"}}]},
+    {"sid": [{"": {"segmentId": "dem.life.expat"}}]}
+  ]}
+]`
+
+var GetSegmentsForOrgAndAttributesTests = []struct {
+	desc   string
+	orgKey string
+	attrs  map[string]string
+	expect []SegmentMatch
+}{
+	{
+		desc:   "no attributes",
+		orgKey: "6lkb2cv",
+		attrs:  map[string]string{},
+		expect: []SegmentMatch{},
+	},
+	{
+		desc:   "unknown org",
+		orgKey: "nonexistent",
+		attrs:  map[string]string{"gen": "Male"},
+		expect: []SegmentMatch{},
+	},
+	{
+		desc:   "unknown attributes are skipped",
+		orgKey: "6lkb2cv",
+		attrs:  map[string]string{"gen": "Male", "xyz": "1"},
+		expect: []SegmentMatch{{SegmentConfig{Id: "dem.g.m"}, []string{"gen"}}},
+	},
+	{
+		desc:   "union in sorted attribute order",
+		orgKey: "6lkb2cv",
+		attrs:  map[string]string{"sid": "", "gen": "Female", "age": "19"},
+		expect: []SegmentMatch{
+			{SegmentConfig{Id: "dem.ag.18-20"}, []string{"age"}},
+			{SegmentConfig{Id: "dem.g.f"}, []string{"gen"}},
+			{SegmentConfig{Id: "dem.life.expat"}, []string{"sid"}},
+		},
+	},
+	{
+		desc:   "segments produced by several attributes are deduplicated",
+		orgKey: "6lkb2cv",
+		attrs:  map[string]string{"age": "20", "edu": "college"},
+		expect: []SegmentMatch{
+			{SegmentConfig{Id: "dem.ag.18-20"}, []string{"age"}},
+			{SegmentConfig{Id: "dem.ag.young"}, []string{"age", "edu"}},
+		},
+	},
+}
+
+func TestGetSegmentsForOrgAndAttributes(t *testing.T) {
+	ec := New([]byte(attributesTestData))
+
+	for _, test := range GetSegmentsForOrgAndAttributesTests {
+		res := ec.GetSegmentsForOrgAndAttributesWithProvenance(test.orgKey, test.attrs)
+		if !compareSliceOfSegmentMatch(test.expect, res) {
+			t.Errorf("%s: `GetSegmentsForOrgAndAttributesWithProvenance` returned %v, expected %v", test.desc, res, test.expect)
+		}
+
+		segs := ec.GetSegmentsForOrgAndAttributes(test.orgKey, test.attrs)
+		expect := make([]SegmentConfig, 0, len(test.expect))
+		for _, match := range test.expect {
+			expect = append(expect, match.SegmentConfig)
+		}
+		if !compareSliceOfSegmentConfig(expect, segs) {
+			t.Errorf("%s: `GetSegmentsForOrgAndAttributes` returned %v, expected %v", test.desc, segs, expect)
+		}
+	}
+}
+
+func compareSliceOfSegmentMatch(a, b []SegmentMatch) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx].Id != b[idx].Id || len(a[idx].Attributes) != len(b[idx].Attributes) {
+			return false
+		}
+		for attrIdx := range a[idx].Attributes {
+			if a[idx].Attributes[attrIdx] != b[idx].Attributes[attrIdx] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,236 @@
+package lookupcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lnshi/json-lookup/tool/json"
+)
+
+// orgDir is the directory of the orgs of a data file, built by scanning it once or read from its offset index file,
+// so that finding an org, or finding it isn't there, doesn't take another scan.
+type orgDir struct {
+	done chan struct{}
+	data []byte
+
+	// `keys` lists the keys of the orgs in the order of the data file, an org listed twice is there twice,
+	// and `spans` tells where the raw details of each of them are in `data`.
+	keys  []string
+	spans []orgSpan
+	// `first` maps the key of every org to its first listing in `keys`, the one it is looked up from.
+	first map[string]int
+	// `versions` are the versions of the orgs of a `VersionedSource`, as listed, see `ReloadChanged`.
+	versions map[string]string
+	// `err` is the error the scan stopped at, the orgs listed before it are in the directory.
+	err error
+}
+
+// orgSpan is the byte offset and length of the raw details of an org in the data,
+// the offset is -1 for an org only in the other sources.
+type orgSpan struct {
+	offset int
+	length int
+}
+
+// details returns the raw details of `orgKey`, a slice of the data, nothing is copied.
+// They are nil for an org only in the other sources.
+func (dir *orgDir) details(orgKey string) ([]byte, bool) {
+	listing, ok := dir.first[orgKey]
+	if !ok {
+		return nil, false
+	}
+	span := dir.spans[listing]
+	if span.offset < 0 {
+		return nil, true
+	}
+	return dir.data[span.offset : span.offset+span.length], true
+}
+
+// add lists the org `orgKey` whose raw details are at `span`.
+func (dir *orgDir) add(orgKey string, span orgSpan) {
+	if _, ok := dir.first[orgKey]; !ok {
+		dir.first[orgKey] = len(dir.keys)
+	}
+	dir.keys = append(dir.keys, orgKey)
+	dir.spans = append(dir.spans, span)
+}
+
+// directory returns the directory of the orgs of `data` along with the generation of `data`.
+// The first caller reads it from the offset index file, if any and up to date, or scans `data` for it,
+// whoever asks for it meanwhile waits for that.
+func (ec *Cache) directory() (*orgDir, int) {
+	ec.lock.Lock()
+	dir, data, gen := ec.dir, ec.data, ec.gen
+	if ec.closed {
+		ec.lock.Unlock()
+		// The data is gone, there is nothing to list.
+		dir = newOrgDir(nil)
+		dir.err = ErrClosed
+		close(dir.done)
+		return dir, gen
+	}
+	if dir != nil {
+		ec.lock.Unlock()
+		<-dir.done
+		return dir, gen
+	}
+	dir = newOrgDir(data)
+	ec.dir = dir
+	ec.lock.Unlock()
+
+	if ec.src != nil {
+		dir.listSource(ec.src)
+	} else if ec.offsetIndexFile == "" || !dir.readOffsetIndex(ec.offsetIndexFile) {
+		atomic.AddInt64(&ec.scans, 1)
+		dir.scan()
+
+		if ec.offsetIndexFile != "" && dir.err == nil {
+			// Only saves the next scan, it doesn't matter much if it fails.
+			dir.writeOffsetIndex(ec.offsetIndexFile)
+		}
+	}
+	ec.addSourceOrgs(dir)
+	close(dir.done)
+
+	return dir, gen
+}
+
+func newOrgDir(data []byte) *orgDir {
+	return &orgDir{
+		done:  make(chan struct{}),
+		data:  data,
+		keys:  make([]string, 0),
+		first: make(map[string]int),
+	}
+}
+
+// scan lists the orgs of `data` and where their raw details are. On an error it keeps those found before it.
+func (dir *orgDir) scan() {
+	chOrgs := make(chan *json.V)
+	go json.IterateArray(chOrgs, dir.data)
+	defer drainV(chOrgs)
+
+	for org := range chOrgs {
+		if org.Err != nil {
+			dir.err = corrupt(org.Err)
+			return
+		}
+
+		chOrgDetails := make(chan *json.Kv)
+		go json.IterateObject(chOrgDetails, org.V)
+
+		for orgDetail := range chOrgDetails {
+			if orgDetail.Err != nil {
+				drainKv(chOrgDetails)
+				dir.err = corrupt(orgDetail.Err)
+				return
+			}
+
+			// The iterators hand out slices of `data`, which the offset is found back from.
+			dir.add(string(orgDetail.K), orgSpan{offset: cap(dir.data) - cap(orgDetail.V), length: len(orgDetail.V)})
+		}
+	}
+}
+
+const (
+	defaultNegativeCacheSize = 4096
+	defaultNegativeCacheTTL  = time.Minute
+)
+
+// WithNegativeCache makes the cache remember up to `size` orgs found not to be in the data for `ttl`, instead of
+// 4096 orgs for a minute, so that looking them up again doesn't even take the directory. A `size` of 0 turns it off.
+// The orgs remembered are forgotten by `Reload`.
+func WithNegativeCache(size int, ttl time.Duration) Option {
+	return func(ec *Cache) {
+		ec.negative = newNegCache(size, ttl)
+	}
+}
+
+// negCache remembers the orgs of the data of generation `gen` recently found not to be there.
+// Once full, an org added evicts the one added first.
+type negCache struct {
+	lock sync.Mutex
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+	gen  int
+
+	expires map[string]time.Time
+	// `ring` holds the keys of `expires` in the order they were added, `next` is the position of the oldest one
+	// once `ring` is full.
+	ring []string
+	next int
+}
+
+// newNegCache returns nil if `size` isn't positive, which remembers nothing.
+func newNegCache(size int, ttl time.Duration) *negCache {
+	if size <= 0 {
+		return nil
+	}
+	return &negCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		expires: make(map[string]time.Time),
+		ring:    make([]string, 0, size),
+	}
+}
+
+// has reports whether `orgKey` has been found not to be in the data less than `ttl` ago.
+func (nc *negCache) has(orgKey string) bool {
+	if nc == nil {
+		return false
+	}
+
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+
+	expires, ok := nc.expires[orgKey]
+	return ok && nc.now().Before(expires)
+}
+
+// add remembers that `orgKey` isn't in the data of generation `gen`, unless that data has been reloaded since.
+func (nc *negCache) add(gen int, orgKey string) {
+	if nc == nil {
+		return
+	}
+
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+
+	if gen != nc.gen {
+		return
+	}
+
+	expires := nc.now().Add(nc.ttl)
+	// Already there, possibly expired, it keeps its place in `ring`.
+	if _, ok := nc.expires[orgKey]; ok {
+		nc.expires[orgKey] = expires
+		return
+	}
+
+	if len(nc.ring) < nc.size {
+		nc.ring = append(nc.ring, orgKey)
+	} else {
+		delete(nc.expires, nc.ring[nc.next])
+		nc.ring[nc.next] = orgKey
+		nc.next = (nc.next + 1) % nc.size
+	}
+	nc.expires[orgKey] = expires
+}
+
+// reset forgets everything, the data is now that of generation `gen`.
+func (nc *negCache) reset(gen int) {
+	if nc == nil {
+		return
+	}
+
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+
+	nc.gen = gen
+	nc.expires = make(map[string]time.Time)
+	nc.ring = nc.ring[:0]
+	nc.next = 0
+}
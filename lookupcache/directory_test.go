@@ -0,0 +1,120 @@
+package lookupcache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOrgDirectory(t *testing.T) {
+	data, err := ioutil.ReadFile(DefaultDataFile)
+	if err != nil {
+		t.Fatalf("reading the data file failed with error %s", err)
+	}
+
+	ec := New(data, WithNegativeCache(0, 0))
+	for i := 0; i < 100; i++ {
+		if res := ec.GetSegmentForOrgAndKeyAndVal(fmt.Sprintf("unknown%d", i), "gen", "Female"); len(res) != 0 {
+			t.Errorf("`GetSegmentForOrgAndKeyAndVal` of an unknown org returned %s, expected nothing", res)
+		}
+	}
+	if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "gen", "Female"); len(res) == 0 {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` of 6lkb2cv returned nothing, expected its segments")
+	}
+	if _, err := ec.OrgKeys(); err != nil {
+		t.Errorf("`OrgKeys` failed with error %s", err)
+	}
+	if scans := atomic.LoadInt64(&ec.scans); scans != 1 {
+		t.Errorf("the data was scanned %d times, expected once", scans)
+	}
+
+	// Reloaded data has a directory of its own.
+	ec.Reload([]byte(`[{"1a9n4ou": [{"edu": [{"": {"segmentId": "intr.edu"}}]}]}]`))
+	if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "gen", "Female"); len(res) != 0 {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` of 6lkb2cv after reloading returned %s, expected nothing", res)
+	}
+	if scans := atomic.LoadInt64(&ec.scans); scans != 2 {
+		t.Errorf("the data was scanned %d times after reloading, expected twice", scans)
+	}
+}
+
+func TestOrgDirectoryFirstListing(t *testing.T) {
+	ec := New([]byte(`[
+  {"6lkb2cv": [{"gen": [{"Female": {"segmentId": "dem.g.f"}}]}]},
+  {"6lkb2cv": [{"gen": [{"Female": {"segmentId": "dem.g.f.2"}}]}]},
+  {"1a9n4ou" [{"gen": [{"Male": {"segmentId": "dem.g.m"}}]}]}
+]`))
+
+	if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "gen", "Female"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.g.f"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` returned %s, expected [{dem.g.f}]", res)
+	}
+	// The scan stopped at the invalid org, those before it are still there.
+	if _, err := ec.OrgKeys(); err == nil {
+		t.Errorf("`OrgKeys` of invalid data succeeded, expected an error")
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	nc := newNegCache(2, time.Minute)
+	nc.now = func() time.Time { return now }
+
+	nc.add(0, "a")
+	nc.add(0, "b")
+	if !nc.has("a") || !nc.has("b") {
+		t.Errorf("a and b were added, expected them both remembered")
+	}
+
+	// Full, the first one added goes.
+	nc.add(0, "c")
+	if nc.has("a") || !nc.has("b") || !nc.has("c") {
+		t.Errorf("c was added to the full cache, expected a evicted and b and c remembered")
+	}
+
+	now = now.Add(time.Minute)
+	if nc.has("b") || nc.has("c") {
+		t.Errorf("b and c are a minute old, expected them expired")
+	}
+
+	// Added again, it expires later.
+	nc.add(0, "c")
+	if !nc.has("c") {
+		t.Errorf("c was added again, expected it remembered")
+	}
+
+	// Reloaded, a miss of the previous data is no miss of the new one.
+	nc.reset(1)
+	nc.add(0, "d")
+	if nc.has("c") || nc.has("d") {
+		t.Errorf("c and d were added before the reload, expected them forgotten")
+	}
+	nc.add(1, "d")
+	if !nc.has("d") {
+		t.Errorf("d was added after the reload, expected it remembered")
+	}
+
+	var off *negCache
+	off.add(0, "a")
+	if off.has("a") || newNegCache(0, time.Minute) != nil {
+		t.Errorf("a cache of size 0 remembered a, expected it to remember nothing")
+	}
+}
+
+func TestNegativeCacheLookups(t *testing.T) {
+	ec := New([]byte(rulesTestData), WithNegativeCache(8, time.Hour))
+
+	if res := ec.GetSegmentForOrgAndKey("unknown", "edu"); len(res) != 0 {
+		t.Errorf("`GetSegmentForOrgAndKey` of an unknown org returned %s, expected nothing", res)
+	}
+	if !ec.negative.has("unknown") {
+		t.Errorf("unknown was looked up, expected it remembered as missing")
+	}
+
+	// Reloaded data having it, it is found.
+	ec.Reload([]byte(`[{"unknown": [{"edu": [{"": {"segmentId": "intr.edu"}}]}]}]`))
+	if res := ec.GetSegmentForOrgAndKey("unknown", "edu"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "intr.edu"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKey` after reloading returned %s, expected [{intr.edu}]", res)
+	}
+}
@@ -0,0 +1,80 @@
+package lookupcache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LookupCacheE is `LookupCache` telling why nothing was found. Finding no segment for a value isn't an error,
+// the other failures are, or wrap, one of `ErrInvalidArgument`, `ErrOrgNotFound`, `ErrParamNotFound`,
+// `ErrDataCorrupt` and `ErrClosed`, see `errors.Is`. The segments are nil whenever the error isn't.
+type LookupCacheE interface {
+	GetSegmentForOrgAndKeyE(orgKey string, paramKey string) ([]SegmentConfig, error)
+	GetSegmentForOrgAndKeyAndValE(orgKey string, paramKey string, paramVal string) ([]SegmentConfig, error)
+}
+
+var (
+	// ErrInvalidArgument is returned for an empty org key or param key.
+	ErrInvalidArgument = errors.New("lookupcache: invalid argument")
+	// ErrOrgNotFound is returned for an org which isn't in the data.
+	ErrOrgNotFound = errors.New("lookupcache: org not found")
+	// ErrParamNotFound is returned for a param the org has no rules for.
+	ErrParamNotFound = errors.New("lookupcache: param not found")
+	// ErrDataCorrupt is wrapped by the errors of the data which can't be parsed, the org looked up may be in
+	// the part of it which can't.
+	ErrDataCorrupt = errors.New("lookupcache: corrupt data")
+)
+
+var (
+	_ LookupCache  = (*Cache)(nil)
+	_ LookupCacheE = (*Cache)(nil)
+)
+
+func (ec *Cache) GetSegmentForOrgAndKeyE(orgKey string, paramKey string) ([]SegmentConfig, error) {
+	return ec.GetSegmentForOrgAndKeyAndValE(orgKey, paramKey, "")
+}
+
+// GetSegmentForOrgAndKeyAndValE fails with an `*OrgError` wrapping the error parsing the org, or fetching it from
+// the source of the cache, if it can't be.
+func (ec *Cache) GetSegmentForOrgAndKeyAndValE(orgKey string, paramKey string, paramVal string) ([]SegmentConfig, error) {
+	if orgKey == "" || paramKey == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	entry, err := ec.lookupOrg(orgKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return ec.matchOrg(entry, paramKey, paramVal)
+}
+
+// IgnoreErrors adapts `c` to `LookupCache`, a lookup which fails finds nothing.
+func IgnoreErrors(c LookupCacheE) LookupCache {
+	return ignoreErrors{c}
+}
+
+type ignoreErrors struct {
+	c LookupCacheE
+}
+
+func (ie ignoreErrors) GetSegmentForOrgAndKey(orgKey string, paramKey string) []SegmentConfig {
+	segs, err := ie.c.GetSegmentForOrgAndKeyE(orgKey, paramKey)
+	if err != nil {
+		return []SegmentConfig{}
+	}
+	return segs
+}
+
+func (ie ignoreErrors) GetSegmentForOrgAndKeyAndVal(orgKey string, paramKey string, paramVal string) []SegmentConfig {
+	segs, err := ie.c.GetSegmentForOrgAndKeyAndValE(orgKey, paramKey, paramVal)
+	if err != nil {
+		return []SegmentConfig{}
+	}
+	return segs
+}
+
+// corrupt wraps `err`, met parsing the data, with `ErrDataCorrupt`.
+func corrupt(err error) error {
+	return fmt.Errorf("%w: %w", ErrDataCorrupt, err)
+}
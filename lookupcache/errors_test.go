@@ -0,0 +1,84 @@
+package lookupcache
+
+import (
+	"errors"
+	"testing"
+)
+
+const errorsTestData = `[
+  {"6lkb2cv": [{"gen": [{"Female": {"segmentId": "dem.g.f"}}]}]},
+  {"1a9n4ou": [{"gen": [{"Female": {"segment": "dem.g.f"}}]}]}
+]`
+
+var GetSegmentForOrgAndKeyAndValETests = []struct {
+	desc     string
+	orgKey   string
+	paramKey string
+	paramVal string
+	expect   []SegmentConfig
+	err      error
+}{
+	{
+		desc: "found", orgKey: "6lkb2cv", paramKey: "gen", paramVal: "Female",
+		expect: []SegmentConfig{{Id: "dem.g.f"}},
+	},
+	{
+		desc: "no match", orgKey: "6lkb2cv", paramKey: "gen", paramVal: "Male",
+		expect: []SegmentConfig{},
+	},
+	{
+		desc: "empty org key", orgKey: "", paramKey: "gen", paramVal: "Female",
+		err: ErrInvalidArgument,
+	},
+	{
+		desc: "empty param key", orgKey: "6lkb2cv", paramKey: "", paramVal: "Female",
+		err: ErrInvalidArgument,
+	},
+	{
+		desc: "unknown param", orgKey: "6lkb2cv", paramKey: "age", paramVal: "19",
+		err: ErrParamNotFound,
+	},
+	{
+		desc: "corrupt org", orgKey: "1a9n4ou", paramKey: "gen", paramVal: "Female",
+		err: ErrDataCorrupt,
+	},
+	{
+		desc: "unknown org", orgKey: "nonexistent", paramKey: "gen", paramVal: "Female",
+		err: ErrOrgNotFound,
+	},
+}
+
+func TestGetSegmentForOrgAndKeyAndValE(t *testing.T) {
+	ec := New([]byte(errorsTestData))
+
+	for _, test := range GetSegmentForOrgAndKeyAndValETests {
+		res, err := ec.GetSegmentForOrgAndKeyAndValE(test.orgKey, test.paramKey, test.paramVal)
+		if !errors.Is(err, test.err) || (err == nil && !compareSliceOfSegmentConfig(test.expect, res)) {
+			t.Errorf("%s: `GetSegmentForOrgAndKeyAndValE` returned %s and %v, expected %s and %v", test.desc, res, err, test.expect, test.err)
+		}
+		if err != nil && res != nil {
+			t.Errorf("%s: `GetSegmentForOrgAndKeyAndValE` returned %s along with an error", test.desc, res)
+		}
+
+		// The same lookup through `LookupCache` finds nothing instead of failing.
+		expect := test.expect
+		if test.err != nil {
+			expect = []SegmentConfig{}
+		}
+		for desc, lc := range map[string]LookupCache{"Cache": ec, "IgnoreErrors": IgnoreErrors(ec)} {
+			if res := lc.GetSegmentForOrgAndKeyAndVal(test.orgKey, test.paramKey, test.paramVal); res == nil || !compareSliceOfSegmentConfig(expect, res) {
+				t.Errorf("%s: `GetSegmentForOrgAndKeyAndVal` of %s returned %s, expected %s", test.desc, desc, res, expect)
+			}
+		}
+	}
+
+	// Found missing before.
+	if _, err := ec.GetSegmentForOrgAndKeyE("nonexistent", "gen"); !errors.Is(err, ErrOrgNotFound) {
+		t.Errorf("`GetSegmentForOrgAndKeyE` of an unknown org returned %v, expected %v", err, ErrOrgNotFound)
+	}
+
+	// The org may be in the part of the data which can't be read.
+	if _, err := New([]byte(`[{"6lkb2cv": [{"gen": [`)).GetSegmentForOrgAndKeyE("nonexistent", "gen"); !errors.Is(err, ErrDataCorrupt) {
+		t.Errorf("`GetSegmentForOrgAndKeyE` of truncated data returned %v, expected %v", err, ErrDataCorrupt)
+	}
+}
@@ -0,0 +1,503 @@
+package lookupcache
+
+import (
+	"container/list"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+)
+
+// WithMaxOrgs makes the cache keep up to `n` orgs parsed, the others are evicted as `WithEviction` tells
+// and parsed again when looked up.
+func WithMaxOrgs(n int) Option {
+	return func(ec *Cache) {
+		ec.maxOrgs = n
+	}
+}
+
+// WithMaxBytes makes the cache keep orgs parsed up to roughly `n` bytes, the others are evicted as `WithEviction`
+// tells and parsed again when looked up. The size of an org is estimated from its rules and their indexes.
+func WithMaxBytes(n int64) Option {
+	return func(ec *Cache) {
+		ec.maxBytes = n
+	}
+}
+
+// WithEviction makes the cache evict the orgs picked by `policy` when over its capacity, instead of `LRU`.
+func WithEviction(policy EvictionPolicy) Option {
+	return func(ec *Cache) {
+		ec.policy = policy
+	}
+}
+
+// Evictor tracks the orgs kept by a cache to pick those to evict. Its methods may be called concurrently.
+type Evictor interface {
+	// Added is called when the org `orgKey` is parsed and kept.
+	Added(orgKey string)
+	// Accessed is called when the org `orgKey` is looked up and found parsed, possibly just as it is evicted,
+	// in which case it is ignored.
+	Accessed(orgKey string)
+	// Victim picks the org to evict and stops tracking it. It is only called while some are tracked,
+	// and may pick the org just added.
+	Victim() string
+	// Removed is called when the org `orgKey` is dropped other than by eviction, e.g. as it was removed from the
+	// source of the cache, the evictor stops tracking it. It is ignored if the org isn't tracked.
+	Removed(orgKey string)
+}
+
+// EvictionPolicy returns a new `Evictor` tracking nothing, for a cache and again every time it is reloaded.
+type EvictionPolicy func() Evictor
+
+// The built-in eviction policies.
+var (
+	// LRU evicts the org looked up least recently.
+	LRU EvictionPolicy = func() Evictor {
+		return newLRUEvictor()
+	}
+
+	// LFU evicts the org looked up least often since it was added, the least recently among those.
+	LFU EvictionPolicy = func() Evictor {
+		return newLFUEvictor()
+	}
+
+	// WTinyLFU keeps the orgs added lately in a small LRU window, an org leaving it is only kept over the LRU org of
+	// the rest if it has been looked up more often lately, as estimated by a count-min sketch.
+	// It resists scans of many orgs looked up once better than `LRU`.
+	WTinyLFU EvictionPolicy = func() Evictor {
+		return newTinyLFUEvictor()
+	}
+)
+
+// Stats are the counters of a cache since it was created.
+type Stats struct {
+	// Hits counts the lookups of orgs found parsed, Misses those of orgs not parsed or not in the data.
+	Hits   int64
+	Misses int64
+	// Loads counts the orgs parsed, Evictions those evicted.
+	Loads     int64
+	Evictions int64
+
+	// Orgs is the number of orgs kept parsed, Bytes roughly the memory they take.
+	Orgs  int
+	Bytes int64
+}
+
+// Stats returns the counters of the cache.
+func (ec *Cache) Stats() Stats {
+	ec.lock.RLock()
+	orgs, bytes := len(ec.orgs), ec.bytes
+	ec.lock.RUnlock()
+
+	return Stats{
+		Hits:      atomic.LoadInt64(&ec.hits),
+		Misses:    atomic.LoadInt64(&ec.misses),
+		Loads:     atomic.LoadInt64(&ec.parses),
+		Evictions: atomic.LoadInt64(&ec.evictions),
+		Orgs:      orgs,
+		Bytes:     bytes,
+	}
+}
+
+// bounded reports whether the cache has a capacity.
+func (ec *Cache) bounded() bool {
+	return ec.maxOrgs > 0 || ec.maxBytes > 0
+}
+
+// ownStrings returns `entry` of `orgKey` with a string table of its own, so that its strings go away with it
+// once evicted, see `parseOrg`.
+func ownStrings(orgKey string, entry *orgEntry) *orgEntry {
+	return copyOrg(newStrTable(), orgKey, entry)
+}
+
+// copyOrg returns `entry` of `orgKey` with its strings interned in `strs`.
+func copyOrg(strs *strTable, orgKey string, entry *orgEntry) *orgEntry {
+	paramMap := make(map[string]*paramRules, len(entry.params))
+	for paramKey, idx := range entry.params {
+		rules := &paramRules{}
+		for rule, val := range idx.rules.vals {
+			rules.addFrom(val, strs.internString(idx.strs.str(idx.rules.segIds[rule])), idx.rules.source(rule))
+		}
+		paramMap[strs.str(strs.internString(paramKey))] = rules
+	}
+	return newOrgEntry(strs, orgKey, paramMap)
+}
+
+// addOrg keeps `orgKey` parsed, evicting orgs if that takes the cache over its capacity.
+// `ec.lock` must be held for writing.
+func (ec *Cache) addOrg(orgKey string, entry *orgEntry) {
+	ec.orgs[orgKey] = entry
+	ec.bytes += entry.size
+
+	if !ec.bounded() {
+		ec.indexOrg(orgKey, entry.params)
+		return
+	}
+	ec.evictor.Added(orgKey)
+
+	for len(ec.orgs) > 0 && ((ec.maxOrgs > 0 && len(ec.orgs) > ec.maxOrgs) || (ec.maxBytes > 0 && ec.bytes > ec.maxBytes)) {
+		victimKey := ec.evictor.Victim()
+		victim, ok := ec.orgs[victimKey]
+		if !ok {
+			// A broken `Evictor`, better over capacity than looping forever.
+			break
+		}
+		delete(ec.orgs, victimKey)
+		ec.bytes -= victim.size
+		atomic.AddInt64(&ec.evictions, 1)
+	}
+}
+
+// The estimated overheads of the maps and slices holding an org, a param and a rule.
+const (
+	orgOverhead   = 128
+	paramOverhead = 256
+	ruleOverhead  = 32
+	// strOverhead is that of an interned string, its header in the table and its id in the sorted ones.
+	strOverhead = 24
+)
+
+// orgSize estimates the memory taken by the org `orgKey` of params `params`, counting every distinct interned
+// string of its rules once. Those are the strings of its own table in a cache with a capacity, see `parseOrg`,
+// in a cache without one other orgs may share them.
+func orgSize(orgKey string, params map[string]*paramIndex) int64 {
+	size := int64(orgOverhead + len(orgKey))
+	seen := make(map[uint32]bool)
+	count := func(strs *strTable, id uint32) {
+		if !seen[id] {
+			seen[id] = true
+			size += int64(strOverhead + len(strs.str(id)))
+		}
+	}
+
+	for paramKey, idx := range params {
+		size += int64(paramOverhead+len(paramKey)+ruleOverhead*idx.rules.len()) + idx.size()
+		for rule, val := range idx.rules.vals {
+			size += int64(len(val))
+			count(idx.strs, idx.rules.segIds[rule])
+		}
+		for rule, decoded := range idx.decoded {
+			// Values without escapes are their own decoded values.
+			if decoded != idx.rules.vals[rule] {
+				size += int64(len(decoded))
+			}
+		}
+	}
+	return size
+}
+
+// lruEvictor keeps the orgs in `order` from the most recently looked up.
+type lruEvictor struct {
+	lock  sync.Mutex
+	order *list.List
+	elems map[string]*list.Element
+}
+
+func newLRUEvictor() *lruEvictor {
+	return &lruEvictor{order: list.New(), elems: make(map[string]*list.Element)}
+}
+
+func (e *lruEvictor) Added(orgKey string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.elems[orgKey] = e.order.PushFront(orgKey)
+}
+
+func (e *lruEvictor) Accessed(orgKey string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if elem, ok := e.elems[orgKey]; ok {
+		e.order.MoveToFront(elem)
+	}
+}
+
+func (e *lruEvictor) Victim() string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	orgKey := e.order.Remove(e.order.Back()).(string)
+	delete(e.elems, orgKey)
+	return orgKey
+}
+
+func (e *lruEvictor) Removed(orgKey string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if elem, ok := e.elems[orgKey]; ok {
+		e.order.Remove(elem)
+		delete(e.elems, orgKey)
+	}
+}
+
+// lfuEvictor keeps the orgs in one list per number of lookups, from the most recently looked up,
+// so that picking the victim doesn't take going through them all.
+type lfuEvictor struct {
+	lock    sync.Mutex
+	freqs   map[int]*list.List
+	elems   map[string]*list.Element
+	counts  map[string]int
+	minFreq int
+}
+
+func newLFUEvictor() *lfuEvictor {
+	return &lfuEvictor{
+		freqs:  make(map[int]*list.List),
+		elems:  make(map[string]*list.Element),
+		counts: make(map[string]int),
+	}
+}
+
+func (e *lfuEvictor) Added(orgKey string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.push(orgKey, 1)
+	e.minFreq = 1
+}
+
+func (e *lfuEvictor) Accessed(orgKey string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	count, ok := e.counts[orgKey]
+	if !ok {
+		return
+	}
+	e.remove(orgKey)
+	if count == e.minFreq && e.freqs[count] == nil {
+		e.minFreq++
+	}
+	e.push(orgKey, count+1)
+}
+
+func (e *lfuEvictor) Victim() string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	// `minFreq` is only off after a victim emptied its list.
+	if e.freqs[e.minFreq] == nil {
+		e.minFreq = 0
+		for count := range e.freqs {
+			if e.minFreq == 0 || count < e.minFreq {
+				e.minFreq = count
+			}
+		}
+	}
+	orgKey := e.freqs[e.minFreq].Back().Value.(string)
+	e.remove(orgKey)
+	return orgKey
+}
+
+func (e *lfuEvictor) Removed(orgKey string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	// `Victim` finds `minFreq` again if its list is emptied.
+	if _, ok := e.counts[orgKey]; ok {
+		e.remove(orgKey)
+	}
+}
+
+func (e *lfuEvictor) push(orgKey string, count int) {
+	orgs, ok := e.freqs[count]
+	if !ok {
+		orgs = list.New()
+		e.freqs[count] = orgs
+	}
+	e.elems[orgKey] = orgs.PushFront(orgKey)
+	e.counts[orgKey] = count
+}
+
+func (e *lfuEvictor) remove(orgKey string) {
+	count := e.counts[orgKey]
+	orgs := e.freqs[count]
+	orgs.Remove(e.elems[orgKey])
+	if orgs.Len() == 0 {
+		delete(e.freqs, count)
+	}
+	delete(e.elems, orgKey)
+	delete(e.counts, orgKey)
+}
+
+// tinyLFUEvictor is `WTinyLFU`, `window` and `main` are both kept from the most recently looked up.
+type tinyLFUEvictor struct {
+	lock   sync.Mutex
+	window *list.List
+	main   *list.List
+	elems  map[string]*list.Element
+	// `inWindow` tells which of the lists an org is in.
+	inWindow map[string]bool
+	sketch   *countMinSketch
+}
+
+// windowShare is the share of the orgs the window gets, at least one.
+const windowShare = 100
+
+func newTinyLFUEvictor() *tinyLFUEvictor {
+	return &tinyLFUEvictor{
+		window:   list.New(),
+		main:     list.New(),
+		elems:    make(map[string]*list.Element),
+		inWindow: make(map[string]bool),
+		sketch:   newCountMinSketch(),
+	}
+}
+
+func (e *tinyLFUEvictor) Added(orgKey string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.sketch.add(orgKey, len(e.elems)+1)
+	e.elems[orgKey] = e.window.PushFront(orgKey)
+	e.inWindow[orgKey] = true
+}
+
+func (e *tinyLFUEvictor) Accessed(orgKey string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	elem, ok := e.elems[orgKey]
+	if !ok {
+		return
+	}
+	e.sketch.add(orgKey, len(e.elems))
+	if e.inWindow[orgKey] {
+		e.window.MoveToFront(elem)
+	} else {
+		e.main.MoveToFront(elem)
+	}
+}
+
+func (e *tinyLFUEvictor) Victim() string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	windowMax := len(e.elems) / windowShare
+	if windowMax < 1 {
+		windowMax = 1
+	}
+
+	// The orgs added while the cache wasn't full yet go to `main` as they are, but the one added last.
+	for e.window.Len() > windowMax+1 || (e.window.Len() > windowMax && e.main.Len() == 0) {
+		e.toMain(e.window.Back())
+	}
+
+	if e.window.Len() > windowMax {
+		candidate, victim := e.window.Back(), e.main.Back()
+		if e.sketch.estimate(candidate.Value.(string)) > e.sketch.estimate(victim.Value.(string)) {
+			e.toMain(candidate)
+			return e.remove(e.main, victim)
+		}
+		return e.remove(e.window, candidate)
+	}
+
+	if e.main.Len() > 0 {
+		return e.remove(e.main, e.main.Back())
+	}
+	return e.remove(e.window, e.window.Back())
+}
+
+func (e *tinyLFUEvictor) Removed(orgKey string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	elem, ok := e.elems[orgKey]
+	if !ok {
+		return
+	}
+	if e.inWindow[orgKey] {
+		e.remove(e.window, elem)
+	} else {
+		e.remove(e.main, elem)
+	}
+}
+
+func (e *tinyLFUEvictor) toMain(elem *list.Element) {
+	orgKey := e.window.Remove(elem).(string)
+	e.elems[orgKey] = e.main.PushFront(orgKey)
+	delete(e.inWindow, orgKey)
+}
+
+func (e *tinyLFUEvictor) remove(orgs *list.List, elem *list.Element) string {
+	orgKey := orgs.Remove(elem).(string)
+	delete(e.elems, orgKey)
+	delete(e.inWindow, orgKey)
+	return orgKey
+}
+
+// countMinSketch estimates how often the orgs have been looked up lately, with `depth` rows of 4 bit counters
+// which are all halved once `width` * 10 lookups have been counted, so that old lookups fade away.
+type countMinSketch struct {
+	seed     maphash.Seed
+	width    int
+	counters [depth][]uint8
+	added    int
+}
+
+const (
+	depth      = 4
+	maxCounter = 15
+	minWidth   = 64
+)
+
+func newCountMinSketch() *countMinSketch {
+	s := &countMinSketch{seed: maphash.MakeSeed()}
+	s.resize(minWidth)
+	return s
+}
+
+func (s *countMinSketch) resize(width int) {
+	s.width = width
+	for row := range s.counters {
+		s.counters[row] = make([]uint8, width)
+	}
+	s.added = 0
+}
+
+// add counts a lookup of `orgKey`, `orgs` being the number of orgs tracked, which the sketch grows with.
+func (s *countMinSketch) add(orgKey string, orgs int) {
+	// What has been counted so far is lost when growing, it is only an estimate anyway.
+	if orgs*4 > s.width {
+		width := s.width
+		for orgs*4 > width {
+			width *= 2
+		}
+		s.resize(width)
+	}
+
+	hash := maphash.String(s.seed, orgKey)
+	for row := range s.counters {
+		if idx := s.index(hash, row); s.counters[row][idx] < maxCounter {
+			s.counters[row][idx]++
+		}
+	}
+
+	s.added++
+	if s.added >= s.width*10 {
+		for row := range s.counters {
+			for idx := range s.counters[row] {
+				s.counters[row][idx] /= 2
+			}
+		}
+		s.added /= 2
+	}
+}
+
+func (s *countMinSketch) estimate(orgKey string) uint8 {
+	hash := maphash.String(s.seed, orgKey)
+	res := uint8(maxCounter)
+	for row := range s.counters {
+		if count := s.counters[row][s.index(hash, row)]; count < res {
+			res = count
+		}
+	}
+	return res
+}
+
+// index derives the counter of `hash` in `row` by double hashing, `width` being a power of 2.
+func (s *countMinSketch) index(hash uint64, row int) int {
+	h1, h2 := hash, hash>>32|hash<<32
+	return int((h1 + uint64(row)*h2) & uint64(s.width-1))
+}
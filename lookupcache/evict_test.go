@@ -0,0 +1,272 @@
+package lookupcache
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMaxOrgs(t *testing.T) {
+	ec := New([]byte(`[
+  {"a": [{"gen": [{"Female": {"segmentId": "dem.g.f"}}]}]},
+  {"b": [{"gen": [{"Female": {"segmentId": "dem.g.f"}}]}]},
+  {"c": [{"gen": [{"Male": {"segmentId": "dem.g.m"}}]}]}
+]`), WithMaxOrgs(2))
+
+	for _, orgKey := range []string{"a", "b", "a", "c"} {
+		ec.GetSegmentForOrgAndKey(orgKey, "gen")
+	}
+
+	// b is the least recently looked up.
+	for orgKey, kept := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := ec.orgs[orgKey]; ok != kept {
+			t.Errorf("%s is kept parsed: %t, expected %t", orgKey, ok, kept)
+		}
+	}
+
+	res := ec.Stats()
+	expect := Stats{Hits: 1, Misses: 3, Loads: 3, Evictions: 1, Orgs: 2, Bytes: res.Bytes}
+	if res.Bytes <= 0 || res != expect {
+		t.Errorf("`Stats` returned %+v, expected %+v and some bytes", res, expect)
+	}
+
+	// Parsed again.
+	if res := ec.GetSegmentForOrgAndKeyAndVal("b", "gen", "Female"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.g.f"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` of an evicted org returned %s, expected [{dem.g.f}]", res)
+	}
+	if res := ec.Stats(); res.Loads != 4 || res.Evictions != 2 {
+		t.Errorf("`Stats` returned %+v, expected 4 loads and 2 evictions", res)
+	}
+
+	// All the orgs are there, though they aren't all kept.
+	expectRules := []Rule{{OrgKey: "a", ParamKey: "gen", ParamVal: "Female"}, {OrgKey: "b", ParamKey: "gen", ParamVal: "Female"}}
+	if res := ec.RulesForSegment("dem.g.f"); !compareSliceOfRule(expectRules, res) {
+		t.Errorf("`RulesForSegment` returned %v, expected %v", res, expectRules)
+	}
+	if res := ec.Stats(); res.Orgs != 2 {
+		t.Errorf("`Stats` after `RulesForSegment` returned %+v, expected 2 orgs still", res)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	data, err := ioutil.ReadFile(DefaultDataFile)
+	if err != nil {
+		t.Fatalf("reading the data file failed with error %s", err)
+	}
+
+	const maxBytes = 64 << 10
+	ec := New(data, WithMaxBytes(maxBytes))
+	unbounded := New(data)
+
+	orgKeys, _ := ec.OrgKeys()
+	for _, orgKey := range orgKeys {
+		expect := unbounded.GetSegmentForOrgAndKeyAndVal(orgKey, "gen", "Female")
+		if res := ec.GetSegmentForOrgAndKeyAndVal(orgKey, "gen", "Female"); !compareSliceOfSegmentConfig(expect, res) {
+			t.Errorf("`GetSegmentForOrgAndKeyAndVal` of %s returned %s, expected %s", orgKey, res, expect)
+		}
+		if res := ec.Stats(); res.Bytes > maxBytes {
+			t.Fatalf("`Stats` returned %+v, expected at most %d bytes", res, maxBytes)
+		}
+	}
+	if res := ec.Stats(); res.Evictions == 0 {
+		t.Errorf("`Stats` returned %+v, expected some evictions", res)
+	}
+}
+
+// TestLoadEvicting checks that the orgs a load evicts on the way are still found, and parsed again.
+func TestLoadEvicting(t *testing.T) {
+	data, err := ioutil.ReadFile(DefaultDataFile)
+	if err != nil {
+		t.Fatalf("reading the data file failed with error %s", err)
+	}
+
+	for _, opt := range []Option{WithMaxOrgs(5), WithMaxBytes(64 << 10)} {
+		ec := New(data, opt)
+		if err := ec.Load(context.Background()); err != nil {
+			t.Fatalf("`Load` failed with error %s", err)
+		}
+		if res := ec.Stats(); res.Evictions == 0 {
+			t.Fatalf("`Stats` returned %+v, expected some evictions", res)
+		}
+
+		for _, test := range GetSegmentForOrgAndKeyAndValBasicTests {
+			if res := ec.GetSegmentForOrgAndKeyAndVal(test.orgKey, test.paramKey, test.paramVal); !compareSliceOfSegmentConfig(test.expect, res) {
+				t.Errorf("%s: `GetSegmentForOrgAndKeyAndVal` returned %s, expected %s", test.desc, res, test.expect)
+			}
+		}
+		if _, err := ec.GetSegmentForOrgAndKeyE("6lkb2cv", "gen"); err != nil {
+			t.Errorf("`GetSegmentForOrgAndKeyE` of an evicted org failed with error %s", err)
+		}
+	}
+}
+
+// TestOwnStrings checks that the orgs of a cache with a capacity don't share their strings, parsed or restored from
+// a snapshot, so that evicting them frees those.
+func TestOwnStrings(t *testing.T) {
+	data, err := ioutil.ReadFile(DefaultDataFile)
+	if err != nil {
+		t.Fatalf("reading the data file failed with error %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := New(data).WriteSnapshot(&buf); err != nil {
+		t.Fatalf("`WriteSnapshot` failed with error %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "data.snap")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for desc, ec := range map[string]*Cache{
+		"parsed":   New(data, WithMaxOrgs(10)),
+		"restored": New(data, WithMaxOrgs(10), WithSnapshotFile(path)),
+	} {
+		orgKeys, _ := ec.OrgKeys()
+		for _, orgKey := range orgKeys[:5] {
+			ec.GetSegmentForOrgAndKey(orgKey, "gen")
+		}
+
+		tables := make(map[*strTable]string)
+		for orgKey, entry := range ec.orgs {
+			for _, idx := range entry.params {
+				if other, ok := tables[idx.strs]; ok && other != orgKey {
+					t.Fatalf("%s: %s and %s share their strings", desc, orgKey, other)
+				}
+				tables[idx.strs] = orgKey
+			}
+		}
+		if res := len(*ec.strs.strs.Load()); res != 0 {
+			t.Errorf("%s: the cache holds %d strings, expected none", desc, res)
+		}
+	}
+}
+
+var EvictionPolicyTests = []struct {
+	desc   string
+	policy EvictionPolicy
+	// `hotKept` tells whether an org looked up again and again survives a scan of all the orgs.
+	hotKept bool
+}{
+	{"LRU", LRU, false},
+	{"LFU", LFU, true},
+	{"WTinyLFU", WTinyLFU, true},
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	data, err := ioutil.ReadFile(DefaultDataFile)
+	if err != nil {
+		t.Fatalf("reading the data file failed with error %s", err)
+	}
+
+	for _, tt := range EvictionPolicyTests {
+		ec := New(data, WithMaxOrgs(10), WithEviction(tt.policy))
+
+		orgKeys, _ := ec.OrgKeys()
+		hot := orgKeys[0]
+		for i := 0; i < 20; i++ {
+			ec.GetSegmentForOrgAndKey(orgKeys[i%5], "gen")
+			ec.GetSegmentForOrgAndKey(hot, "gen")
+		}
+		for _, orgKey := range orgKeys {
+			ec.GetSegmentForOrgAndKey(orgKey, "gen")
+		}
+		// The scan ends far from it.
+		for _, orgKey := range orgKeys[len(orgKeys)-20:] {
+			ec.GetSegmentForOrgAndKey(orgKey, "gen")
+		}
+
+		if res := ec.Stats(); res.Orgs != 10 {
+			t.Errorf("%s: `Stats` returned %+v, expected 10 orgs", tt.desc, res)
+		}
+		if _, ok := ec.orgs[hot]; ok != tt.hotKept {
+			t.Errorf("%s: the hot org is kept parsed: %t, expected %t", tt.desc, ok, tt.hotKept)
+		}
+	}
+}
+
+func TestLFUEvictor(t *testing.T) {
+	e := newLFUEvictor()
+	for _, orgKey := range []string{"a", "b", "c"} {
+		e.Added(orgKey)
+	}
+	e.Accessed("a")
+	e.Accessed("a")
+	e.Accessed("c")
+	e.Accessed("unknown")
+
+	for _, expect := range []string{"b", "c", "a"} {
+		if res := e.Victim(); res != expect {
+			t.Errorf("`Victim` returned %s, expected %s", res, expect)
+		}
+	}
+
+	// The least recently looked up of the least looked up.
+	e.Added("d")
+	e.Added("e")
+	e.Accessed("d")
+	e.Accessed("e")
+	if res := e.Victim(); res != "d" {
+		t.Errorf("`Victim` returned %s, expected d", res)
+	}
+}
+
+func TestEvictorRemoved(t *testing.T) {
+	for _, tt := range EvictionPolicyTests {
+		e := tt.policy()
+		for _, orgKey := range []string{"a", "b", "c"} {
+			e.Added(orgKey)
+		}
+		e.Accessed("b")
+		e.Removed("b")
+		e.Removed("unknown")
+
+		victims := map[string]bool{e.Victim(): true, e.Victim(): true}
+		if !victims["a"] || !victims["c"] {
+			t.Errorf("%s: `Victim` returned %v, expected a and c", tt.desc, victims)
+		}
+
+		// Tracked again once added again.
+		e.Added("b")
+		if res := e.Victim(); res != "b" {
+			t.Errorf("%s: `Victim` returned %s, expected b", tt.desc, res)
+		}
+	}
+}
+
+// TestConcurrentEvictions is meant to run with `-race`.
+func TestConcurrentEvictions(t *testing.T) {
+	data, err := ioutil.ReadFile(DefaultDataFile)
+	if err != nil {
+		t.Fatalf("reading the data file failed with error %s", err)
+	}
+
+	for _, policy := range []EvictionPolicy{LRU, LFU, WTinyLFU} {
+		ec := New(data, WithMaxOrgs(5), WithEviction(policy))
+		reference := New(data)
+		orgKeys, _ := ec.OrgKeys()
+
+		var wg sync.WaitGroup
+		for worker := 0; worker < 8; worker++ {
+			wg.Add(1)
+			go func(worker int) {
+				defer wg.Done()
+
+				for i := 0; i < len(orgKeys); i++ {
+					orgKey := orgKeys[(worker*13+i)%len(orgKeys)]
+					expect := reference.GetSegmentForOrgAndKeyAndVal(orgKey, "gen", "Female")
+					if res := ec.GetSegmentForOrgAndKeyAndVal(orgKey, "gen", "Female"); !compareSliceOfSegmentConfig(expect, res) {
+						t.Errorf("`GetSegmentForOrgAndKeyAndVal` of %s returned %s, expected %s", orgKey, res, expect)
+					}
+				}
+			}(worker)
+		}
+		wg.Wait()
+
+		if res := ec.Stats(); res.Orgs > 5 {
+			t.Errorf("`Stats` returned %+v, expected at most 5 orgs", res)
+		}
+	}
+}
@@ -0,0 +1,560 @@
+package lookupcache
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Expr is a compiled rule expression, which combines predicates on several params of a user, e.g.
+//
+//	gen = "Female" AND edu in ("bachelors", "graduate") AND age in [25, 34]
+//
+// The predicates are:
+//
+//	key = "val"          the value of `key` is "val"
+//	key != "val"         the value of `key` isn't "val", or there is no `key` at all
+//	key ~ "val"          the value of `key` matches "val" with the matcher of `key`, see `Matcher`
+//	key in ("a", "b")    the value of `key` is one of those
+//	key in [lo, hi]      the value of `key` is a number from `lo` to `hi`, both included
+//	key < 18             the value of `key` is a number below 18, and so on for `<=`, `>` and `>=`
+//
+// They are combined with `AND`, `OR` and `NOT`, from the tightest binding to the loosest `NOT`, `AND`, `OR`,
+// and grouped with parentheses. Keywords are case-insensitive, and a key can be quoted like a value.
+// Predicates other than `!=` are false for a key which isn't among the attributes.
+type Expr struct {
+	src  string
+	root exprNode
+}
+
+// ExprSyntaxError is returned by `ParseExpr` for an expression which doesn't parse.
+type ExprSyntaxError struct {
+	// Offset is the byte offset in the expression where the error was found.
+	Offset int
+	Msg    string
+}
+
+func (e *ExprSyntaxError) Error() string {
+	return fmt.Sprintf("lookupcache: expr: offset %d: %s", e.Offset, e.Msg)
+}
+
+// ParseExpr parses and compiles the rule expression `src`.
+func ParseExpr(src string) (*Expr, error) {
+	p := &exprParser{src: src}
+	p.next()
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+
+	return &Expr{src: src, root: root}, nil
+}
+
+// MustParseExpr is `ParseExpr`, panicking if `src` doesn't parse. It is meant for expressions known at compile time.
+func MustParseExpr(src string) *Expr {
+	e, err := ParseExpr(src)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval reports whether `attrs`, the attributes of a user, satisfy the expression.
+// `~` predicates are matched with `LegacySubstring`.
+func (e *Expr) Eval(attrs map[string]string) bool {
+	return e.root.eval(attrs, func(string) Matcher { return LegacySubstring })
+}
+
+// Params returns the sorted keys of the params the expression looks at.
+func (e *Expr) Params() []string {
+	set := make(map[string]struct{})
+	e.root.params(set)
+
+	params := make([]string, 0, len(set))
+	for param := range set {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+
+	return params
+}
+
+// ExprRulePrefix marks a rule value of the data file, or of the sidecar rules file, as an expression rule, e.g.
+//
+//	{"gen": [{"expr:gen = \"Female\" AND age in [18, 24]": {"segmentId": "dem.g.f.young"}}]}
+//
+// Its segment is found by `GetSegmentsForOrgAndAttributes` and `EvalExprRules` for the attributes satisfying the
+// expression, `~` predicates matched with the matchers of the cache. It is only evaluated if its param, `gen` here,
+// is among the attributes, which spares evaluating the others: it had better be one the expression needs.
+// Single value lookups such as `GetSegmentForOrgAndKeyAndVal` never match it, nor does an expression which
+// doesn't parse.
+const ExprRulePrefix = "expr:"
+
+// exprRule returns the compiled expression of the rule value `ruleVal`, nil if it doesn't parse, if it is an
+// expression rule.
+func exprRule(ruleVal string) (*Expr, bool) {
+	if !strings.HasPrefix(ruleVal, ExprRulePrefix) {
+		return nil, false
+	}
+	e, err := ParseExpr(decodeRuleVal(ruleVal[len(ExprRulePrefix):]))
+	if err != nil {
+		return nil, true
+	}
+	return e, true
+}
+
+// EvalExprRules returns the segments of the expression rules of `orgKey` satisfied by `attrs`, each segment once,
+// in the order of the sorted attribute keys, then in the order of the data file, see `ExprRulePrefix`.
+func (ec *Cache) EvalExprRules(orgKey string, attrs map[string]string) []SegmentConfig {
+	res := make([]SegmentConfig, 0)
+
+	entry, ok := ec.org(orgKey)
+	if !ok {
+		return res
+	}
+	for _, match := range ec.evalExprRules(entry.params, attrs) {
+		res = append(res, match.SegmentConfig)
+	}
+	return res
+}
+
+// evalExprRules returns the segments of the expression rules of the params `paramIndexes` satisfied by `attrs`,
+// along with the params of the attributes each expression looked at.
+func (ec *Cache) evalExprRules(paramIndexes map[string]*paramIndex, attrs map[string]string) []SegmentMatch {
+	res := make([]SegmentMatch, 0)
+
+	attrKeys := make([]string, 0, len(attrs))
+	for attrKey := range attrs {
+		if idx, ok := paramIndexes[attrKey]; ok && len(idx.exprs) > 0 {
+			attrKeys = append(attrKeys, attrKey)
+		}
+	}
+	sort.Strings(attrKeys)
+
+	seen := make(map[string]bool)
+	for _, attrKey := range attrKeys {
+		idx := paramIndexes[attrKey]
+		for _, rule := range idx.exprs {
+			segId := idx.strs.str(idx.rules.segIds[rule.rule])
+			if seen[segId] || rule.expr == nil || !rule.expr.root.eval(attrs, ec.paramMatcher) {
+				continue
+			}
+			seen[segId] = true
+
+			provenance := make([]string, 0)
+			for _, param := range rule.expr.Params() {
+				if _, ok := attrs[param]; ok {
+					provenance = append(provenance, param)
+				}
+			}
+			res = append(res, SegmentMatch{SegmentConfig: SegmentConfig{Id: segId}, Attributes: provenance})
+		}
+	}
+
+	return res
+}
+
+// exprNode is a node of a compiled expression.
+type exprNode interface {
+	eval(attrs map[string]string, matcherFor func(paramKey string) Matcher) bool
+	params(set map[string]struct{})
+}
+
+type andNode struct {
+	children []exprNode
+}
+
+func (n *andNode) eval(attrs map[string]string, matcherFor func(string) Matcher) bool {
+	for _, child := range n.children {
+		if !child.eval(attrs, matcherFor) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *andNode) params(set map[string]struct{}) {
+	for _, child := range n.children {
+		child.params(set)
+	}
+}
+
+type orNode struct {
+	children []exprNode
+}
+
+func (n *orNode) eval(attrs map[string]string, matcherFor func(string) Matcher) bool {
+	for _, child := range n.children {
+		if child.eval(attrs, matcherFor) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *orNode) params(set map[string]struct{}) {
+	for _, child := range n.children {
+		child.params(set)
+	}
+}
+
+type notNode struct {
+	child exprNode
+}
+
+func (n *notNode) eval(attrs map[string]string, matcherFor func(string) Matcher) bool {
+	return !n.child.eval(attrs, matcherFor)
+}
+
+func (n *notNode) params(set map[string]struct{}) {
+	n.child.params(set)
+}
+
+type predNode struct {
+	key string
+	op  string
+	// `vals` are the values of `=`, `!=`, `~` and `in (...)`.
+	vals []string
+	// `pred` is the numeric predicate of `in [...]` and the comparisons.
+	pred numericPredicate
+}
+
+func (n *predNode) eval(attrs map[string]string, matcherFor func(string) Matcher) bool {
+	val, ok := attrs[n.key]
+	if !ok {
+		return n.op == "!="
+	}
+
+	switch n.op {
+	case "=":
+		return val == n.vals[0]
+	case "!=":
+		return val != n.vals[0]
+	case "~":
+		return matcherFor(n.key).Match(n.vals[0], val)
+	case "in":
+		for _, v := range n.vals {
+			if val == v {
+				return true
+			}
+		}
+		return false
+	default:
+		num, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return err == nil && n.pred.match(num)
+	}
+}
+
+func (n *predNode) params(set map[string]struct{}) {
+	set[n.key] = struct{}{}
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokWord
+	tokString
+	tokNumber
+	tokOp
+	tokPunct
+	tokInvalid
+)
+
+type token struct {
+	kind tokKind
+	text string
+	// `val` is the decoded value of a string.
+	val    string
+	offset int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// keyword reports whether the token is the keyword `kw`, whatever its case.
+func (t token) keyword(kw string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, kw)
+}
+
+type exprParser struct {
+	src    string
+	offset int
+	tok    token
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return &ExprSyntaxError{Offset: p.tok.offset, Msg: fmt.Sprintf(format, args...)}
+}
+
+// next moves on to the next token of `src`.
+func (p *exprParser) next() {
+	for p.offset < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.offset]) != -1 {
+		p.offset++
+	}
+
+	start := p.offset
+	if start == len(p.src) {
+		p.tok = token{kind: tokEOF, offset: start}
+		return
+	}
+
+	c := p.src[start]
+	switch {
+	case c == '"':
+		end := start + 1
+		for end < len(p.src) && p.src[end] != '"' {
+			if p.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.src) {
+			p.offset = len(p.src)
+			p.tok = token{kind: tokInvalid, text: p.src[start:], offset: start}
+			return
+		}
+		p.offset = end + 1
+		val, err := strconv.Unquote(p.src[start:p.offset])
+		if err != nil {
+			p.tok = token{kind: tokInvalid, text: p.src[start:p.offset], offset: start}
+			return
+		}
+		p.tok = token{kind: tokString, text: p.src[start:p.offset], val: val, offset: start}
+	case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		end := start + 1
+		for end < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[end]) != -1 {
+			end++
+		}
+		p.offset = end
+		p.tok = token{kind: tokNumber, text: p.src[start:end], offset: start}
+	case isWordStart(c):
+		end := start + 1
+		for end < len(p.src) && (isWordStart(p.src[end]) || strings.IndexByte("0123456789.-", p.src[end]) != -1) {
+			end++
+		}
+		p.offset = end
+		p.tok = token{kind: tokWord, text: p.src[start:end], offset: start}
+	case strings.HasPrefix(p.src[start:], "!=") || strings.HasPrefix(p.src[start:], "<=") || strings.HasPrefix(p.src[start:], ">="):
+		p.offset = start + 2
+		p.tok = token{kind: tokOp, text: p.src[start:p.offset], offset: start}
+	case strings.IndexByte("=~<>", c) != -1:
+		p.offset = start + 1
+		p.tok = token{kind: tokOp, text: p.src[start:p.offset], offset: start}
+	case strings.IndexByte("()[],", c) != -1:
+		p.offset = start + 1
+		p.tok = token{kind: tokPunct, text: p.src[start:p.offset], offset: start}
+	default:
+		p.offset = start + 1
+		p.tok = token{kind: tokInvalid, text: p.src[start:p.offset], offset: start}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	children := []exprNode{node}
+	for p.tok.keyword("OR") {
+		p.next()
+		if node, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &orNode{children: children}, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	node, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	children := []exprNode{node}
+	for p.tok.keyword("AND") {
+		p.next()
+		if node, err = p.parseNot(); err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &andNode{children: children}, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.tok.keyword("NOT") {
+		p.next()
+		child, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	}
+
+	if p.tok.kind == tokPunct && p.tok.text == "(" {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+
+	return p.parsePred()
+}
+
+func (p *exprParser) parsePred() (exprNode, error) {
+	var key string
+	switch {
+	case p.tok.kind == tokString:
+		key = p.tok.val
+	case p.tok.kind == tokWord && !p.tok.keyword("AND") && !p.tok.keyword("OR") && !p.tok.keyword("NOT") && !p.tok.keyword("IN"):
+		key = p.tok.text
+	default:
+		return nil, p.errorf("expected a param key, found %s", p.tok)
+	}
+	p.next()
+
+	if p.tok.keyword("IN") {
+		p.next()
+		return p.parseIn(key)
+	}
+
+	if p.tok.kind != tokOp {
+		return nil, p.errorf("expected an operator after %q, found %s", key, p.tok)
+	}
+	op := p.tok.text
+	p.next()
+
+	switch op {
+	case "=", "!=", "~":
+		val, err := p.parseVal()
+		if err != nil {
+			return nil, err
+		}
+		return &predNode{key: key, op: op, vals: []string{val}}, nil
+	default:
+		num, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		pred := numericPredicate{lo: math.Inf(-1), hi: math.Inf(1)}
+		switch op {
+		case "<", "<=":
+			pred.hi, pred.hiExcl = num, op == "<"
+		default:
+			pred.lo, pred.loExcl = num, op == ">"
+		}
+		return &predNode{key: key, op: op, pred: pred}, nil
+	}
+}
+
+func (p *exprParser) parseIn(key string) (exprNode, error) {
+	if p.tok.kind == tokPunct && p.tok.text == "[" {
+		p.next()
+		lo, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(","); err != nil {
+			return nil, err
+		}
+		hi, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return nil, err
+		}
+		return &predNode{key: key, op: "in[]", pred: numericPredicate{lo: lo, hi: hi}}, nil
+	}
+
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	vals := make([]string, 0)
+	for {
+		val, err := p.parseVal()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
+
+		if p.tok.kind == tokPunct && p.tok.text == ")" {
+			p.next()
+			return &predNode{key: key, op: "in", vals: vals}, nil
+		}
+		if err := p.expectPunct(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseVal parses a value, a string or a number as written.
+func (p *exprParser) parseVal() (string, error) {
+	switch p.tok.kind {
+	case tokString:
+		val := p.tok.val
+		p.next()
+		return val, nil
+	case tokNumber:
+		val := p.tok.text
+		p.next()
+		return val, nil
+	default:
+		return "", p.errorf("expected a value, found %s", p.tok)
+	}
+}
+
+func (p *exprParser) parseNumber() (float64, error) {
+	if p.tok.kind != tokNumber {
+		return 0, p.errorf("expected a number, found %s", p.tok)
+	}
+	num, err := strconv.ParseFloat(p.tok.text, 64)
+	if err != nil {
+		return 0, p.errorf("invalid number %s", p.tok)
+	}
+	p.next()
+	return num, nil
+}
+
+func (p *exprParser) expectPunct(punct string) error {
+	if p.tok.kind != tokPunct || p.tok.text != punct {
+		return p.errorf("expected %q, found %s", punct, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
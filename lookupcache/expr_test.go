@@ -0,0 +1,169 @@
+package lookupcache
+
+import (
+	"errors"
+	"testing"
+)
+
+var exprTestUser = map[string]string{"gen": "Female", "edu": "bachelors", "age": "27", "sub": "Engineering / Architecture"}
+
+var ExprTests = []struct {
+	desc   string
+	expr   string
+	attrs  map[string]string
+	expect bool
+}{
+	{desc: "equal", expr: `gen = "Female"`, attrs: exprTestUser, expect: true},
+	{desc: "equal is exact", expr: `gen = "male"`, attrs: exprTestUser, expect: false},
+	{desc: "not equal", expr: `gen != "Male"`, attrs: exprTestUser, expect: true},
+	{desc: "not equal on a missing key", expr: `kids != "yes"`, attrs: exprTestUser, expect: true},
+	{desc: "missing key", expr: `kids = "yes"`, attrs: exprTestUser, expect: false},
+	{desc: "matcher", expr: `edu ~ "bachelors\ngraduate"`, attrs: exprTestUser, expect: true},
+	{desc: "matcher takes the value as the rule value", expr: `sub ~ "Architecture"`, attrs: exprTestUser, expect: false},
+	{desc: "set", expr: `edu in ("bachelors", "graduate")`, attrs: exprTestUser, expect: true},
+	{desc: "set mismatch", expr: `edu IN ("high_school")`, attrs: exprTestUser, expect: false},
+	{desc: "range", expr: `age in [25, 34]`, attrs: exprTestUser, expect: true},
+	{desc: "range mismatch", expr: `age in [35, 44]`, attrs: exprTestUser, expect: false},
+	{desc: "range of a non-number", expr: `gen in [25, 34]`, attrs: exprTestUser, expect: false},
+	{desc: "comparisons", expr: `age >= 27 AND age <= 27 AND age > 26.5 AND age < 28`, attrs: exprTestUser, expect: true},
+	{desc: "exclusive comparison", expr: `age < 27`, attrs: exprTestUser, expect: false},
+	{desc: "and", expr: `gen = "Female" AND edu = "bachelors" AND age in [25, 34]`, attrs: exprTestUser, expect: true},
+	{desc: "and mismatch", expr: `gen = "Female" and edu = "graduate"`, attrs: exprTestUser, expect: false},
+	{desc: "or", expr: `gen = "Male" OR age < 30`, attrs: exprTestUser, expect: true},
+	{desc: "not", expr: `NOT gen = "Male"`, attrs: exprTestUser, expect: true},
+	{desc: "not binds tighter than and", expr: `NOT gen = "Male" AND gen = "Female"`, attrs: exprTestUser, expect: true},
+	{desc: "and binds tighter than or", expr: `gen = "Female" OR gen = "Male" AND age > 99`, attrs: exprTestUser, expect: true},
+	{desc: "parentheses", expr: `(gen = "Female" OR gen = "Male") AND age > 99`, attrs: exprTestUser, expect: false},
+	{desc: "quoted key", expr: `"gen" = "Female"`, attrs: exprTestUser, expect: true},
+	{desc: "escaped value", expr: `sub = "Engineering \u002F Architecture"`, attrs: exprTestUser, expect: true},
+	{desc: "number as a value", expr: `age = 27`, attrs: exprTestUser, expect: true},
+	{desc: "no attributes", expr: `NOT (gen = "Female")`, attrs: map[string]string{}, expect: true},
+}
+
+func TestExpr(t *testing.T) {
+	for _, test := range ExprTests {
+		e, err := ParseExpr(test.expr)
+		if err != nil {
+			t.Errorf("%s: `ParseExpr(%s)` failed with error %s", test.desc, test.expr, err)
+			continue
+		}
+		if res := e.Eval(test.attrs); res != test.expect {
+			t.Errorf("%s: `%s` evaluated to %t, expected %t", test.desc, test.expr, res, test.expect)
+		}
+	}
+}
+
+var ExprSyntaxErrorTests = []struct {
+	expr         string
+	expectOffset int
+}{
+	{expr: ``, expectOffset: 0},
+	{expr: `gen`, expectOffset: 3},
+	{expr: `gen = `, expectOffset: 6},
+	{expr: `gen == "Male"`, expectOffset: 5},
+	{expr: `gen = "Male" AND`, expectOffset: 16},
+	{expr: `gen = "Male" OR OR age < 3`, expectOffset: 16},
+	{expr: `(gen = "Male"`, expectOffset: 13},
+	{expr: `gen = "Male")`, expectOffset: 12},
+	{expr: `age < "18"`, expectOffset: 6},
+	{expr: `age in [18 24]`, expectOffset: 11},
+	{expr: `edu in ()`, expectOffset: 8},
+	{expr: `gen = "Male`, expectOffset: 6},
+	{expr: `gen = "a\/b"`, expectOffset: 6},
+	{expr: `gen = "Male" & age < 3`, expectOffset: 13},
+	{expr: `AND = "x"`, expectOffset: 0},
+}
+
+func TestExprSyntaxError(t *testing.T) {
+	for _, test := range ExprSyntaxErrorTests {
+		_, err := ParseExpr(test.expr)
+
+		var syntaxErr *ExprSyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("`ParseExpr(%s)` returned error %v, expected an `ExprSyntaxError`", test.expr, err)
+			continue
+		}
+		if syntaxErr.Offset != test.expectOffset {
+			t.Errorf("`ParseExpr(%s)` failed at offset %d (%s), expected %d", test.expr, syntaxErr.Offset, err, test.expectOffset)
+		}
+	}
+}
+
+func TestExprParams(t *testing.T) {
+	res := MustParseExpr(`gen = "Female" AND (age < 18 OR NOT "edu" = "x") AND gen != "y"`).Params()
+	if len(res) != 3 || res[0] != "age" || res[1] != "edu" || res[2] != "gen" {
+		t.Errorf("`Params` returned %s, expected [age edu gen]", res)
+	}
+}
+
+// exprTestData is `attributesTestData` with expression rules, filed under a param they need but for `sid`.
+const exprTestData = `[
+  {"6lkb2cv": [
+    {"gen": [{"Female": {"segmentId": "dem.g.f"}}, {"Male": {"segmentId": "dem.g.m"}},
+             {"expr:gen = \"Female\" AND age in [18, 24]": {"segmentId": "dem.g.f.young"}},
+             {"expr:NOT gen in (\"Female\", \"Male\")": {"segmentId": "dem.g.unknown"}},
+             {"expr:gen = \"F\" OR age = \"F\"": {"segmentId": "dem.g.f"}},
+             {"expr:gen = ": {"segmentId": "zz_trash"}}]},
+    {"age": [{"18\n19\n20": {"segmentId": "dem.ag.18-20"}}, {"20\n21": {"segmentId": "dem.ag.young"}}]},
+    {"edu": [{"college": {"segmentId": "dem.ag.young"}}]},
+    {"sub": [{"expr:sub ~ \"engineering\"": {"segmentId": "intr.eng"}}]},
+    {"sid": [{"expr:NOT gen = \"Male\"": {"segmentId": "dem.life.not-male"}}]}
+  ]}
+]`
+
+func TestExprRules(t *testing.T) {
+	ec := New([]byte(exprTestData), WithParamMatcher("sub", CaseInsensitive))
+
+	for _, test := range []struct {
+		attrs  map[string]string
+		expect []SegmentConfig
+	}{
+		{attrs: map[string]string{"gen": "Female", "age": "20"}, expect: []SegmentConfig{{Id: "dem.g.f.young"}}},
+		// With the matcher of the cache.
+		{attrs: map[string]string{"sub": "Engineering"}, expect: []SegmentConfig{{Id: "intr.eng"}}},
+		// Only evaluated if their param is among the attributes.
+		{attrs: map[string]string{"gen": "Other", "sid": "x"}, expect: []SegmentConfig{{Id: "dem.g.unknown"}, {Id: "dem.life.not-male"}}},
+		{attrs: map[string]string{"age": "20"}, expect: []SegmentConfig{}},
+	} {
+		if res := ec.EvalExprRules("6lkb2cv", test.attrs); !compareSliceOfSegmentConfig(test.expect, res) {
+			t.Errorf("`EvalExprRules` of %v returned %s, expected %s", test.attrs, res, test.expect)
+		}
+	}
+
+	res := ec.GetSegmentsForOrgAndAttributesWithProvenance("6lkb2cv", map[string]string{"gen": "F", "age": "20", "edu": "college"})
+	expect := []SegmentMatch{
+		{SegmentConfig{Id: "dem.ag.18-20"}, []string{"age"}},
+		{SegmentConfig{Id: "dem.ag.young"}, []string{"age", "edu"}},
+		{SegmentConfig{Id: "dem.g.f"}, []string{"age", "gen"}},
+		{SegmentConfig{Id: "dem.g.unknown"}, []string{"gen"}},
+	}
+	if !compareSliceOfSegmentMatch(expect, res) {
+		t.Errorf("`GetSegmentsForOrgAndAttributesWithProvenance` returned %v, expected %v", res, expect)
+	}
+
+	// Single value lookups never match expression rules.
+	if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "gen", "Female"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.g.f"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` returned %s, expected [{dem.g.f}]", res)
+	}
+	if res := New([]byte(exprTestData)).GetSegmentForOrgAndKeyAndVal("6lkb2cv", "sub", "engineering"); len(res) != 0 {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` scanning the rules returned %s, expected nothing", res)
+	}
+}
+
+func TestExprRulesSidecar(t *testing.T) {
+	opt, err := NumericRules([]byte(`[{"6lkb2cv": [{"age": [{"25-34": {"segmentId": "dem.ag.25-34"}}, {"expr:age in [25, 34] AND gen = \"Female\"": {"segmentId": "dem.g.f.adult"}}]}]}]`))
+	if err != nil {
+		t.Fatalf("`NumericRules` failed with error %s", err)
+	}
+	ec := New([]byte(attributesTestData), opt)
+
+	res := ec.GetSegmentsForOrgAndAttributes("6lkb2cv", map[string]string{"gen": "Female", "age": "30"})
+	if expect := []SegmentConfig{{Id: "dem.ag.25-34"}, {Id: "dem.g.f"}, {Id: "dem.g.f.adult"}}; !compareSliceOfSegmentConfig(expect, res) {
+		t.Errorf("`GetSegmentsForOrgAndAttributes` returned %s, expected %s", res, expect)
+	}
+
+	var syntaxErr *ExprSyntaxError
+	if _, err := NumericRules([]byte(`[{"6lkb2cv": [{"age": [{"expr:age in [25,": {"segmentId": "dem.ag.25-34"}}]}]}]`)); !errors.As(err, &syntaxErr) {
+		t.Errorf("`NumericRules` with an invalid expression returned %v, expected an `*ExprSyntaxError`", err)
+	}
+}
@@ -0,0 +1,224 @@
+package lookupcache
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// WithHistory keeps the last `n` versions of the data, the current one included, for the lookups at a version
+// or at a time, such as `GetSegmentForOrgAndKeyAndValAtTime`. Every `Reload`, and every `ReloadChanged` which finds
+// changes, starts a new version. An org whose raw details didn't change from one version to the next is shared
+// between them rather than parsed again.
+// A version of the data of a file keeps its data, so its orgs can always be looked up. A version of a source only
+// keeps the orgs parsed while it was current and those which haven't changed since, see `WithLoadMode` to parse
+// them all.
+// The past versions of a cache with a capacity keep no orgs parsed, which would take more memory than it allows:
+// those of the data of a file are parsed again at every lookup, only those of a source which haven't changed
+// since can be looked up. A past version never looked into while current is scanned for its directory by its
+// first lookup.
+func WithHistory(n int) Option {
+	return func(ec *Cache) {
+		ec.historySize = n
+	}
+}
+
+// ErrNotRetained is returned by the lookups at a version, or a time, no longer kept, see `WithHistory`.
+var ErrNotRetained = errors.New("lookupcache: version not retained")
+
+// Version is a version of the data of a cache.
+type Version struct {
+	// Id counts the versions, from 1 for the data the cache was created with.
+	Id int
+	// LoadedAt is when the version was loaded, it is current until the next one is.
+	LoadedAt time.Time
+}
+
+// pastVersion is a version replaced by a reload, kept for the lookups at it.
+type pastVersion struct {
+	Version
+	// `data` and `dir` are the data of the version and its directory, built by the first lookup at the version if
+	// it wasn't while current, `orgs` are the orgs parsed while it was current, shared with the next versions as long
+	// as they didn't change. `dir` is set under `ec.lock`.
+	data []byte
+	dir  *orgDir
+	orgs map[string]*orgEntry
+}
+
+// Versions returns the versions kept, oldest first, the current one last.
+func (ec *Cache) Versions() []Version {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	versions := make([]Version, 0, len(ec.history)+1)
+	for _, past := range ec.history {
+		versions = append(versions, past.Version)
+	}
+	return append(versions, ec.version)
+}
+
+// GetSegmentForOrgAndKeyAndValAtVersion is `GetSegmentForOrgAndKeyAndValE` as of the version `id`, it fails the
+// same way, or with `ErrNotRetained` if that version, or the org as of it, isn't kept.
+// A cache with a capacity parses the org again at every lookup at a past version, see `WithHistory`.
+func (ec *Cache) GetSegmentForOrgAndKeyAndValAtVersion(id int, orgKey string, paramKey string, paramVal string) ([]SegmentConfig, error) {
+	if orgKey == "" || paramKey == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	entry, err := ec.orgAt(id, orgKey)
+	if err != nil {
+		return nil, err
+	}
+	return ec.matchOrg(entry, paramKey, paramVal)
+}
+
+// GetSegmentForOrgAndKeyAndValAtTime is `GetSegmentForOrgAndKeyAndValAtVersion` as of the version current at `at`,
+// it fails with `ErrNotRetained` if there was none kept then.
+func (ec *Cache) GetSegmentForOrgAndKeyAndValAtTime(at time.Time, orgKey string, paramKey string, paramVal string) ([]SegmentConfig, error) {
+	id, err := ec.versionAt(at)
+	if err != nil {
+		return nil, err
+	}
+	return ec.GetSegmentForOrgAndKeyAndValAtVersion(id, orgKey, paramKey, paramVal)
+}
+
+// versionAt returns the id of the version current at `at`.
+func (ec *Cache) versionAt(at time.Time) (int, error) {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	if !at.Before(ec.version.LoadedAt) {
+		return ec.version.Id, nil
+	}
+	for idx := len(ec.history) - 1; idx >= 0; idx-- {
+		if !at.Before(ec.history[idx].LoadedAt) {
+			return ec.history[idx].Id, nil
+		}
+	}
+	return 0, ErrNotRetained
+}
+
+// orgAt returns `orgKey` as of the version `id`, or why it can't, see `lookupOrg`.
+func (ec *Cache) orgAt(id int, orgKey string) (*orgEntry, error) {
+	for {
+		ec.lock.RLock()
+		current := ec.version.Id
+		var past *pastVersion
+		for _, version := range ec.history {
+			if version.Id == id {
+				past = version
+			}
+		}
+		ec.lock.RUnlock()
+
+		if past != nil {
+			return ec.pastOrg(past, orgKey)
+		}
+		if id != current {
+			return nil, ErrNotRetained
+		}
+
+		entry, err := ec.lookupOrg(orgKey)
+
+		ec.lock.RLock()
+		current = ec.version.Id
+		ec.lock.RUnlock()
+		if current == id {
+			return entry, err
+		}
+		// Reloaded meanwhile, the version is looked for in the history.
+	}
+}
+
+// pastOrg returns `orgKey` as of the version `past`, parsing it again from the data of the version if it wasn't kept.
+// The orgs parsed again aren't kept, not to grow the memory taken by past versions.
+func (ec *Cache) pastOrg(past *pastVersion, orgKey string) (*orgEntry, error) {
+	if entry, ok := past.orgs[orgKey]; ok {
+		return entry, nil
+	}
+
+	ec.lock.Lock()
+	dir := past.dir
+	scan := dir == nil && ec.src == nil
+	if scan {
+		// Never looked into while current, it is scanned once for all the lookups at the version.
+		dir = newOrgDir(past.data)
+		past.dir = dir
+	}
+	ec.lock.Unlock()
+
+	if dir == nil {
+		return nil, ErrNotRetained
+	}
+	if scan {
+		atomic.AddInt64(&ec.scans, 1)
+		dir.scan()
+		ec.addSourceOrgs(dir)
+		close(dir.done)
+	}
+	<-dir.done
+
+	orgDetails, found := dir.details(orgKey)
+	if !found {
+		if dir.err != nil {
+			return nil, dir.err
+		}
+		return nil, ErrOrgNotFound
+	}
+	if ec.src == nil {
+		entry, err := ec.parseOrg(orgKey, orgDetails)
+		if err != nil {
+			return nil, &OrgError{OrgKey: orgKey, Err: err}
+		}
+		return entry, nil
+	}
+
+	// The source only has the org as of the version if it didn't change since.
+	current, _ := ec.directory()
+	version, ok := dir.versions[orgKey]
+	if !ok || current.versions == nil || current.versions[orgKey] != version {
+		return nil, ErrNotRetained
+	}
+	return ec.lookupOrg(orgKey)
+}
+
+// retire moves the current version to the history, if one is kept, and starts the next version.
+// `ec.lock` must be held for writing, before anything of the current version is replaced.
+func (ec *Cache) retire() {
+	if ec.historySize > 1 {
+		past := &pastVersion{Version: ec.version, data: ec.data, dir: ec.dir, orgs: ec.orgs}
+		if ec.bounded() {
+			// Not counted in `bytes`, they would take the cache over its capacity.
+			past.orgs = nil
+		}
+		ec.history = append(ec.history, past)
+		if len(ec.history) > ec.historySize-1 {
+			ec.history = append([]*pastVersion(nil), ec.history[len(ec.history)-(ec.historySize-1):]...)
+		}
+	}
+	ec.version = Version{Id: ec.version.Id + 1, LoadedAt: time.Now()}
+}
+
+// sharedOrg returns `orgKey` as parsed while the previous version was current, if its raw details `orgDetails`
+// are the same in both versions. `ec.lock` must be held.
+func (ec *Cache) sharedOrg(orgKey string, orgDetails []byte) *orgEntry {
+	if len(ec.history) == 0 || orgDetails == nil {
+		return nil
+	}
+	prev := ec.history[len(ec.history)-1]
+	entry, ok := prev.orgs[orgKey]
+	if !ok || prev.dir == nil {
+		return nil
+	}
+	select {
+	case <-prev.dir.done:
+	default:
+		return nil
+	}
+
+	if prevDetails, ok := prev.dir.details(orgKey); !ok || !bytes.Equal(prevDetails, orgDetails) {
+		return nil
+	}
+	return entry
+}
@@ -0,0 +1,170 @@
+package lookupcache
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// historyTestData is the data of the version `n`, in which the segment of 1a9n4ou is dem.g.<n>.
+func historyTestData(n int) []byte {
+	return []byte(fmt.Sprintf(`[
+  {"1a9n4ou": [{"gen": [{"Female": {"segmentId": "dem.g.%d"}}]}]},
+  {"6lkb2cv": [{"edu": [{"college": {"segmentId": "dem.edu.c"}}]}]}
+]`, n))
+}
+
+func TestHistory(t *testing.T) {
+	ec := New(historyTestData(1), WithHistory(3))
+	ec.GetSegmentForOrgAndKeyAndVal("1a9n4ou", "gen", "Female")
+
+	for n := 2; n <= 4; n++ {
+		time.Sleep(time.Millisecond)
+		ec.Reload(historyTestData(n))
+	}
+
+	versions := ec.Versions()
+	if len(versions) != 3 || versions[0].Id != 2 || versions[2].Id != 4 {
+		t.Fatalf("`Versions` returned %v, expected versions 2 to 4", versions)
+	}
+
+	for _, version := range versions {
+		expect := []SegmentConfig{{Id: fmt.Sprintf("dem.g.%d", version.Id)}}
+
+		res, err := ec.GetSegmentForOrgAndKeyAndValAtVersion(version.Id, "1a9n4ou", "gen", "Female")
+		if err != nil || !compareSliceOfSegmentConfig(expect, res) {
+			t.Errorf("`GetSegmentForOrgAndKeyAndValAtVersion` of version %d returned %s and %v, expected %s", version.Id, res, err, expect)
+		}
+		res, err = ec.GetSegmentForOrgAndKeyAndValAtTime(version.LoadedAt, "1a9n4ou", "gen", "Female")
+		if err != nil || !compareSliceOfSegmentConfig(expect, res) {
+			t.Errorf("`GetSegmentForOrgAndKeyAndValAtTime` at version %d returned %s and %v, expected %s", version.Id, res, err, expect)
+		}
+	}
+
+	for _, test := range []struct {
+		id               int
+		orgKey, paramKey string
+		expect           error
+	}{
+		{id: 2, orgKey: "nonexistent", paramKey: "gen", expect: ErrOrgNotFound},
+		{id: 4, orgKey: "nonexistent", paramKey: "gen", expect: ErrOrgNotFound},
+		{id: 2, orgKey: "1a9n4ou", paramKey: "nonexistent", expect: ErrParamNotFound},
+		{id: 2, orgKey: "", paramKey: "gen", expect: ErrInvalidArgument},
+	} {
+		if res, err := ec.GetSegmentForOrgAndKeyAndValAtVersion(test.id, test.orgKey, test.paramKey, "Female"); !errors.Is(err, test.expect) || res != nil {
+			t.Errorf("`GetSegmentForOrgAndKeyAndValAtVersion` of %s and %s at version %d returned %s and %v, expected %v", test.orgKey, test.paramKey, test.id, res, err, test.expect)
+		}
+	}
+	if _, err := ec.GetSegmentForOrgAndKeyAndValAtVersion(1, "1a9n4ou", "gen", "Female"); err != ErrNotRetained {
+		t.Errorf("`GetSegmentForOrgAndKeyAndValAtVersion` of a version dropped returned %v, expected %v", err, ErrNotRetained)
+	}
+	if _, err := ec.GetSegmentForOrgAndKeyAndValAtTime(versions[0].LoadedAt.Add(-time.Nanosecond), "1a9n4ou", "gen", "Female"); err != ErrNotRetained {
+		t.Errorf("`GetSegmentForOrgAndKeyAndValAtTime` before the versions kept returned %v, expected %v", err, ErrNotRetained)
+	}
+
+	// Without a history, only the current version is kept.
+	ec = New(historyTestData(1))
+	ec.Reload(historyTestData(2))
+	if res := ec.Versions(); len(res) != 1 || res[0].Id != 2 {
+		t.Errorf("`Versions` returned %v, expected version 2 only", res)
+	}
+}
+
+func TestHistoryShared(t *testing.T) {
+	ec := New(historyTestData(1), WithHistory(2))
+	ec.GetSegmentForOrgAndKeyAndVal("1a9n4ou", "gen", "Female")
+	ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "edu", "college")
+
+	ec.Reload(historyTestData(2))
+	ec.GetSegmentForOrgAndKeyAndVal("1a9n4ou", "gen", "Female")
+	ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "edu", "college")
+
+	// 6lkb2cv didn't change, it is shared rather than parsed again.
+	if res := ec.Stats().Loads; res != 3 {
+		t.Errorf("%d orgs parsed, expected 3", res)
+	}
+}
+
+func TestHistorySource(t *testing.T) {
+	dir := t.TempDir()
+	writeOrg := func(orgKey string, n int) {
+		details := fmt.Sprintf(`[{"gen": [{"Female": {"segmentId": "dem.g.%d"}}]}]`, n)
+		if err := ioutil.WriteFile(filepath.Join(dir, orgKey+".json"), []byte(details), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeOrg("1a9n4ou", 1)
+	writeOrg("6lkb2cv", 1)
+	writeOrg("7ahk3pz", 1)
+
+	ec := NewFromSource(NewDirSource(dir), WithHistory(2))
+	ec.GetSegmentForOrgAndKeyAndVal("1a9n4ou", "gen", "Female")
+
+	writeOrg("1a9n4ou", 2)
+	writeOrg("7ahk3pz", 2)
+	if err := ec.ReloadChanged(); err != nil {
+		t.Fatalf("`ReloadChanged` failed with error %s", err)
+	}
+
+	for _, test := range []struct {
+		orgKey string
+		expect []SegmentConfig
+		err    error
+	}{
+		// Parsed while current.
+		{orgKey: "1a9n4ou", expect: []SegmentConfig{{Id: "dem.g.1"}}},
+		// Not changed since.
+		{orgKey: "6lkb2cv", expect: []SegmentConfig{{Id: "dem.g.1"}}},
+		// Changed before being parsed.
+		{orgKey: "7ahk3pz", err: ErrNotRetained},
+	} {
+		res, err := ec.GetSegmentForOrgAndKeyAndValAtVersion(1, test.orgKey, "gen", "Female")
+		if err != test.err || !compareSliceOfSegmentConfig(test.expect, res) {
+			t.Errorf("`GetSegmentForOrgAndKeyAndValAtVersion` of %s returned %s and %v, expected %s and %v", test.orgKey, res, err, test.expect, test.err)
+		}
+	}
+
+	if res, err := ec.GetSegmentForOrgAndKeyAndValAtVersion(2, "1a9n4ou", "gen", "Female"); err != nil || !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.g.2"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndValAtVersion` of the current version returned %s and %v, expected [{dem.g.2}]", res, err)
+	}
+}
+
+// TestHistoryPastDirectory checks that a past version never looked into while current is scanned once, and that
+// its errors are reported.
+func TestHistoryPastDirectory(t *testing.T) {
+	ec := New([]byte(`[{"1a9n4ou": [{"gen": [{"Female": {"segmentId": "dem.g.1"}}]}]}, {"6lkb2cv": [{"edu": 1}]}]`), WithHistory(2))
+	ec.Reload(historyTestData(2))
+
+	for i := 0; i < 3; i++ {
+		res, err := ec.GetSegmentForOrgAndKeyAndValAtVersion(1, "1a9n4ou", "gen", "Female")
+		if err != nil || !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.g.1"}}, res) {
+			t.Errorf("`GetSegmentForOrgAndKeyAndValAtVersion` returned %s and %v, expected [{dem.g.1}]", res, err)
+		}
+	}
+	if res, err := ec.GetSegmentForOrgAndKeyAndValAtVersion(1, "6lkb2cv", "edu", "college"); !errors.Is(err, ErrDataCorrupt) || res != nil {
+		t.Errorf("`GetSegmentForOrgAndKeyAndValAtVersion` of a corrupt org returned %s and %v, expected %v", res, err, ErrDataCorrupt)
+	}
+	if res := atomic.LoadInt64(&ec.scans); res != 1 {
+		t.Errorf("the past version was scanned %d times, expected once", res)
+	}
+}
+
+// TestHistoryBounded checks that the past versions of a cache with a capacity keep no orgs, but can still be
+// looked up.
+func TestHistoryBounded(t *testing.T) {
+	ec := New(historyTestData(1), WithHistory(2), WithMaxOrgs(1))
+	ec.GetSegmentForOrgAndKeyAndVal("1a9n4ou", "gen", "Female")
+	ec.Reload(historyTestData(2))
+
+	if res := ec.history[0].orgs; len(res) != 0 {
+		t.Errorf("the past version keeps %d orgs, expected none", len(res))
+	}
+	res, err := ec.GetSegmentForOrgAndKeyAndValAtVersion(1, "1a9n4ou", "gen", "Female")
+	if err != nil || !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.g.1"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndValAtVersion` returned %s and %v, expected [{dem.g.1}]", res, err)
+	}
+}
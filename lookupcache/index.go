@@ -0,0 +1,376 @@
+package lookupcache
+
+import (
+	"bytes"
+	"index/suffixarray"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// paramIndex holds the rules of an (org, param), indexed as the org is parsed so that looking a value up with
+// `LegacySubstring`, `Exact` or `NewlineSet` doesn't have to scan all of them. The other matchers scan them.
+// The indexes are sorted arrays of rule indices rather than maps, which would take several times the memory.
+// They still cost memory: a cache with every org parsed takes about 3 times the heap the rules took as `[]*ParamSeg`
+// by param, see `BenchmarkBytesPerRule`, and more as substring lookups build the suffix arrays, see `substringIndex`.
+type paramIndex struct {
+	strs  *strTable
+	rules paramRules
+
+	// `decoded` holds the decoded values of the rules if any of them has escapes, nil if they are the raw values.
+	decoded []string
+
+	// `byVal` holds the indices of the rules but the numeric and expression ones, sorted by raw value and then index,
+	// `byDecoded` the same sorted by decoded value, nil if that is `byVal`.
+	byVal     []int32
+	byDecoded []int32
+	// `lines` are the lines of the decoded values of more than one line, sorted by line and then rule,
+	// each line of a rule listed once.
+	lines []ruleLine
+
+	// `numeric` lists the rules with a numeric predicate, they are always checked one by one.
+	numeric []int32
+	// `exprs` lists the expression rules, compiled, which only lookups by attributes match, see `ExprRulePrefix`.
+	exprs []exprRuleIdx
+
+	// `substrings` is built by the first substring lookup, once, for params with enough rules to be worth it, see
+	// `substringIndex`.
+	substringsOnce sync.Once
+	substrings     *substringIndex
+}
+
+// substringIndex is the suffix array of the raw values of the rules of a param but the numeric and expression ones.
+// It takes 5 bytes for every byte of the values, a copy of them and an int32 of the suffix array, and 8 bytes for
+// every value, more than the rest of the param. So it is only built for the params looked substrings up in.
+type substringIndex struct {
+	// `values` is the values, each followed by a 0 byte, which can't be part of one.
+	// `starts` holds the offset of each of them in `values`, and `valueRules` the index of its rule.
+	values     *suffixarray.Index
+	starts     []int32
+	valueRules []int32
+}
+
+// exprRuleIdx is the expression rule `rule`, `expr` is nil if it doesn't parse.
+type exprRuleIdx struct {
+	rule int32
+	expr *Expr
+}
+
+// ruleLine is the line `start:end` of the decoded value of `rule`.
+type ruleLine struct {
+	rule       int32
+	start, end int32
+}
+
+// minSuffixArrayRules is the number of rules from which a substring lookup goes through the suffix array,
+// below that scanning the rules is as fast, and the suffix array isn't built.
+const minSuffixArrayRules = 8
+
+func newParamIndex(strs *strTable, rules paramRules) *paramIndex {
+	idx := &paramIndex{strs: strs, rules: rules}
+
+	valuesLen := 0
+	for rule := range rules.vals {
+		val := idx.val(rule)
+		if idx.decoded == nil && strings.IndexByte(val, '\\') != -1 {
+			idx.decoded = make([]string, rules.len())
+		}
+		valuesLen += len(val)
+	}
+	idx.rules.vals = packVals(rules.vals, valuesLen)
+
+	for rule := range rules.vals {
+		val := idx.val(rule)
+		if idx.decoded != nil {
+			idx.decoded[rule] = decodeRuleVal(val)
+		}
+
+		if _, ok := numericRule(val); ok {
+			idx.numeric = append(idx.numeric, int32(rule))
+			continue
+		}
+		if expr, ok := exprRule(val); ok {
+			idx.exprs = append(idx.exprs, exprRuleIdx{rule: int32(rule), expr: expr})
+			continue
+		}
+		idx.byVal = append(idx.byVal, int32(rule))
+
+		decoded := idx.decodedVal(rule)
+		if strings.IndexByte(decoded, '\n') != -1 {
+			idx.addLines(int32(rule), decoded)
+		}
+	}
+
+	sortRules(idx.byVal, idx.val)
+	if idx.decoded != nil {
+		idx.byDecoded = append([]int32(nil), idx.byVal...)
+		sortRules(idx.byDecoded, idx.decodedVal)
+	}
+	sort.Slice(idx.lines, func(i, j int) bool {
+		a, b := idx.line(idx.lines[i]), idx.line(idx.lines[j])
+		return a < b || (a == b && idx.lines[i].rule < idx.lines[j].rule)
+	})
+
+	return idx
+}
+
+// substringIndex returns the suffix array of the values of the rules, building it the first time.
+func (idx *paramIndex) substringIndex() *substringIndex {
+	idx.substringsOnce.Do(func() {
+		size := 0
+		for _, rule := range idx.byVal {
+			size += len(idx.val(int(rule))) + 1
+		}
+
+		// The suffix array keeps `values`, which had better not have room to spare.
+		sub := &substringIndex{starts: make([]int32, 0, len(idx.byVal)), valueRules: make([]int32, 0, len(idx.byVal))}
+		values := bytes.NewBuffer(make([]byte, 0, size))
+		for _, rule := range idx.byVal {
+			sub.starts = append(sub.starts, int32(values.Len()))
+			sub.valueRules = append(sub.valueRules, rule)
+			values.WriteString(idx.val(int(rule)))
+			values.WriteByte(0)
+		}
+		sub.values = suffixarray.New(values.Bytes())
+		idx.substrings = sub
+	})
+	return idx.substrings
+}
+
+// addLines adds the lines of `decoded`, the decoded value of `rule`.
+func (idx *paramIndex) addLines(rule int32, decoded string) {
+	first := len(idx.lines)
+	start := 0
+	for {
+		end := strings.IndexByte(decoded[start:], '\n')
+		if end == -1 {
+			end = len(decoded)
+		} else {
+			end += start
+		}
+
+		line := ruleLine{rule: rule, start: int32(start), end: int32(end)}
+		// A rule lists a line twice at worst, it only matches once.
+		listed := false
+		for _, other := range idx.lines[first:] {
+			if idx.line(other) == decoded[start:end] {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			idx.lines = append(idx.lines, line)
+		}
+
+		if end == len(decoded) {
+			return
+		}
+		start = end + 1
+	}
+}
+
+// sortRules sorts `rules` by the value `val` returns for them, and then index.
+func sortRules(rules []int32, val func(rule int) string) {
+	sort.Slice(rules, func(i, j int) bool {
+		a, b := val(int(rules[i])), val(int(rules[j]))
+		return a < b || (a == b && rules[i] < rules[j])
+	})
+}
+
+// packVals returns `vals` copied into a single string of `size` bytes at least, rather than one allocation each,
+// with room to spare for most of them.
+func packVals(vals []string, size int) []string {
+	var packed strings.Builder
+	packed.Grow(size)
+	for _, val := range vals {
+		packed.WriteString(val)
+	}
+
+	res, all := make([]string, len(vals)), packed.String()
+	for rule, val := range vals {
+		res[rule], all = all[:len(val)], all[len(val):]
+	}
+	return res
+}
+
+// val returns the raw value of `rule`.
+func (idx *paramIndex) val(rule int) string {
+	return idx.rules.vals[rule]
+}
+
+// decodedVal returns the decoded value of `rule`.
+func (idx *paramIndex) decodedVal(rule int) string {
+	if idx.decoded == nil {
+		return idx.val(rule)
+	}
+	return idx.decoded[rule]
+}
+
+func (idx *paramIndex) line(line ruleLine) string {
+	return idx.decodedVal(int(line.rule))[line.start:line.end]
+}
+
+// segs returns copies of the rules.
+func (idx *paramIndex) segs() []ParamSeg {
+	segs := make([]ParamSeg, 0, idx.rules.len())
+	for rule := range idx.rules.vals {
+		segs = append(segs, ParamSeg{ParamVal: idx.val(rule), SegId: idx.strs.str(idx.rules.segIds[rule])})
+	}
+	return segs
+}
+
+// scan returns the segments of the rules whose value `m` matches with `paramVal` going through them all,
+// numeric rules are matched by their predicate instead and expression rules skipped.
+func (idx *paramIndex) scan(m Matcher, paramVal string) []SegmentConfig {
+	return idx.segments(idx.scanRules(m, paramVal))
+}
+
+// match returns the segments of the rules whose value `m` matches with `paramVal`, in the order of the data file,
+// the same as `scan` does.
+func (idx *paramIndex) match(m Matcher, paramVal string) []SegmentConfig {
+	return idx.segments(idx.matchRules(m, paramVal))
+}
+
+// segments returns the segments of `rules`.
+func (idx *paramIndex) segments(rules []int32) []SegmentConfig {
+	res := make([]SegmentConfig, 0, len(rules))
+	for _, rule := range rules {
+		res = append(res, SegmentConfig{Id: idx.strs.str(idx.rules.segIds[rule])})
+	}
+	return res
+}
+
+// scanRules returns the indices of the rules `scan` returns the segments of.
+func (idx *paramIndex) scanRules(m Matcher, paramVal string) []int32 {
+	var res []int32
+
+	for rule := range idx.rules.vals {
+		val := idx.val(rule)
+		if pred, ok := numericRule(val); ok {
+			if matchNumeric(pred, paramVal) {
+				res = append(res, int32(rule))
+			}
+		} else if strings.HasPrefix(val, ExprRulePrefix) {
+			continue
+		} else if m.Match(val, paramVal) {
+			res = append(res, int32(rule))
+		}
+	}
+	return res
+}
+
+// matchRules returns the indices of the rules `match` returns the segments of.
+func (idx *paramIndex) matchRules(m Matcher, paramVal string) []int32 {
+	var rules []int32
+
+	switch m.(type) {
+	case legacySubstringMatcher:
+		switch {
+		case paramVal == "":
+			rules = idx.equal(idx.byVal, idx.val, paramVal)
+		case len(idx.byVal) < minSuffixArrayRules || strings.IndexByte(paramVal, 0) != -1:
+			return idx.scanRules(m, paramVal)
+		default:
+			rules = idx.substring(paramVal)
+		}
+	case exactMatcher:
+		rules = idx.equal(idx.byDecodedVal(), idx.decodedVal, paramVal)
+	case newlineSetMatcher:
+		// A value of one line is its only line, one of more lines is never equal to a line.
+		if strings.IndexByte(paramVal, '\n') == -1 {
+			rules = idx.equal(idx.byDecodedVal(), idx.decodedVal, paramVal)
+			if lines := idx.equalLines(paramVal); len(lines) > 0 {
+				rules = append(rules, lines...)
+				sortInt32s(rules)
+			}
+		}
+	default:
+		return idx.scanRules(m, paramVal)
+	}
+
+	numericMatched := false
+	for _, rule := range idx.numeric {
+		pred, _ := numericRule(idx.val(int(rule)))
+		if matchNumeric(pred, paramVal) {
+			rules = append(rules, rule)
+			numericMatched = true
+		}
+	}
+	if numericMatched {
+		sortInt32s(rules)
+	}
+	return rules
+}
+
+func (idx *paramIndex) byDecodedVal() []int32 {
+	if idx.byDecoded == nil {
+		return idx.byVal
+	}
+	return idx.byDecoded
+}
+
+// equal returns a copy of the run of `sorted`, sorted by `val`, whose value is `paramVal`.
+func (idx *paramIndex) equal(sorted []int32, val func(rule int) string, paramVal string) []int32 {
+	from := sort.Search(len(sorted), func(i int) bool { return val(int(sorted[i])) >= paramVal })
+	to := from
+	for to < len(sorted) && val(int(sorted[to])) == paramVal {
+		to++
+	}
+	return append([]int32(nil), sorted[from:to]...)
+}
+
+// equalLines returns the sorted indices of the rules of more than one line, one of which is `paramVal`.
+func (idx *paramIndex) equalLines(paramVal string) []int32 {
+	from := sort.Search(len(idx.lines), func(i int) bool { return idx.line(idx.lines[i]) >= paramVal })
+
+	var res []int32
+	for to := from; to < len(idx.lines) && idx.line(idx.lines[to]) == paramVal; to++ {
+		res = append(res, idx.lines[to].rule)
+	}
+	return res
+}
+
+// substring returns the sorted indices of the rules whose raw value contains `paramVal`, which isn't empty.
+func (idx *paramIndex) substring(paramVal string) []int32 {
+	sub := idx.substringIndex()
+	offsets := sub.values.Lookup([]byte(paramVal), -1)
+
+	set := make(map[int32]struct{}, len(offsets))
+	for _, offset := range offsets {
+		// `paramVal` has no 0 byte, so it is within the value starting before `offset`.
+		valueIdx := sort.Search(len(sub.starts), func(i int) bool { return int(sub.starts[i]) > offset }) - 1
+		set[sub.valueRules[valueIdx]] = struct{}{}
+	}
+
+	res := make([]int32, 0, len(set))
+	for rule := range set {
+		res = append(res, rule)
+	}
+	sortInt32s(res)
+
+	return res
+}
+
+// size estimates the memory taken by the rules and the indexes, but the strings of the string table.
+func (idx *paramIndex) size() int64 {
+	size := int64(20*idx.rules.len() + 2*len(idx.rules.sources) + 16*len(idx.decoded) + 4*(len(idx.byVal)+len(idx.byDecoded)+len(idx.numeric)) + 12*len(idx.lines) + 16*len(idx.exprs))
+	for _, rule := range idx.exprs {
+		if rule.expr != nil {
+			// The compiled expression takes about as much as its source, twice over.
+			size += int64(2 * len(rule.expr.src))
+		}
+	}
+	if len(idx.byVal) >= minSuffixArrayRules {
+		// The suffix array, counted whether it has been built or not, so that building it doesn't take a cache over
+		// its capacity.
+		size += int64(8 * len(idx.byVal))
+		for _, rule := range idx.byVal {
+			size += int64(5 * (len(idx.val(int(rule))) + 1))
+		}
+	}
+	return size
+}
+
+func sortInt32s(s []int32) {
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+}
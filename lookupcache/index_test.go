@@ -0,0 +1,175 @@
+package lookupcache
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestParamIndexMatchesScan checks that the indexes find what scanning the rules finds, for every param of the data file.
+func TestParamIndexMatchesScan(t *testing.T) {
+	orgKeys, err := Ec.OrgKeys()
+	if err != nil {
+		t.Fatalf("`Ec.OrgKeys` failed with error %s", err)
+	}
+
+	for _, orgKey := range orgKeys {
+		entry, _ := Ec.org(orgKey)
+
+		for paramKey, idx := range entry.params {
+			segs := idx.segs()
+
+			probes := []string{"", "\x00", "nonexistent", "1", "e"}
+			// A sample of the rules is enough, some params have hundreds of them.
+			for segIdx := 0; segIdx < len(segs); segIdx += len(segs)/10 + 1 {
+				seg := segs[segIdx]
+				decoded := decodeRuleVal(seg.ParamVal)
+				lines := strings.Split(decoded, "\n")
+				probes = append(probes, seg.ParamVal, seg.ParamVal[len(seg.ParamVal)/2:], decoded, lines[0], lines[len(lines)-1])
+			}
+
+			for _, m := range []Matcher{LegacySubstring, Exact, NewlineSet} {
+				for _, probe := range probes {
+					expect := idx.scan(m, probe)
+					if res := idx.match(m, probe); !compareSliceOfSegmentConfig(expect, res) {
+						t.Errorf("%T of %q for %s of %s returned %s, expected %s", m, probe, paramKey, orgKey, res, expect)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestParamIndexNumericRules(t *testing.T) {
+	segs := make([]ParamSeg, 0)
+	for age := 0; age < 20; age++ {
+		segs = append(segs, ParamSeg{ParamVal: fmt.Sprintf("%d", age), SegId: fmt.Sprintf("age.%d", age)})
+	}
+	segs = append(segs[:5:5], append([]ParamSeg{{ParamVal: "num:>=18", SegId: "adult"}}, segs[5:]...)...)
+
+	idx := newTestParamIndex(segs)
+	for _, probe := range []string{"1", "18", "19", "30"} {
+		expect := idx.scan(LegacySubstring, probe)
+		if res := idx.match(LegacySubstring, probe); !compareSliceOfSegmentConfig(expect, res) {
+			t.Errorf("matching %q returned %s, expected %s", probe, res, expect)
+		}
+	}
+}
+
+func TestParamIndexSubstringsOnDemand(t *testing.T) {
+	segs, probe := benchmarkSegs(minSuffixArrayRules)
+	idx := newTestParamIndex(segs)
+	if idx.substrings != nil {
+		t.Fatalf("the suffix array was built with the index, expected it built by the first substring lookup")
+	}
+
+	idx.match(Exact, probe)
+	if idx.substrings != nil {
+		t.Errorf("the suffix array was built by an `Exact` lookup")
+	}
+	expect := idx.scan(LegacySubstring, probe)
+	if res := idx.match(LegacySubstring, probe); !compareSliceOfSegmentConfig(expect, res) {
+		t.Errorf("matching %q returned %s, expected %s", probe, res, expect)
+	}
+	if idx.substrings == nil {
+		t.Errorf("the suffix array wasn't built by a `LegacySubstring` lookup")
+	}
+
+	// Too few rules for it to be worth it.
+	idx = newTestParamIndex(segs[:minSuffixArrayRules-1])
+	idx.match(LegacySubstring, probe)
+	if idx.substrings != nil {
+		t.Errorf("the suffix array was built for %d rules", minSuffixArrayRules-1)
+	}
+}
+
+// newTestParamIndex returns the index of the rules `segs`, their segment ids interned in a table of their own.
+func newTestParamIndex(segs []ParamSeg) *paramIndex {
+	strs := newStrTable()
+	rules := paramRules{}
+	for _, seg := range segs {
+		rules.add(seg.ParamVal, strs.internString(seg.SegId))
+	}
+	return newParamIndex(strs, rules)
+}
+
+// benchmarkSegs returns the rules of a param with `n` values, each listing a few lines, and a value matching one.
+func benchmarkSegs(n int) ([]ParamSeg, string) {
+	segs := make([]ParamSeg, 0, n)
+	for i := 0; i < n; i++ {
+		segs = append(segs, ParamSeg{
+			ParamVal: fmt.Sprintf(`value-%d-a\nvalue-%d-b\nvalue-%d-c`, i, i, i),
+			SegId:    fmt.Sprintf("seg.%d", i),
+		})
+	}
+	return segs, fmt.Sprintf("value-%d-b", n/2)
+}
+
+// baselineMatch is how the values were matched before the rules were indexed, going through the `[]*ParamSeg` of
+// the param. The `*Scan` benchmarks time it, the `*Indexed` ones `paramIndex.match`.
+func baselineMatch(segs []*ParamSeg, m Matcher, paramVal string) []SegmentConfig {
+	res := make([]SegmentConfig, 0)
+	for _, paramSeg := range segs {
+		if m.Match(paramSeg.ParamVal, paramVal) {
+			res = append(res, SegmentConfig{Id: paramSeg.SegId})
+		}
+	}
+	return res
+}
+
+func benchmarkMatch(b *testing.B, n int, m Matcher, indexed bool) {
+	segs, paramVal := benchmarkSegs(n)
+	idx := newTestParamIndex(segs)
+	baseline := make([]*ParamSeg, 0, len(segs))
+	for i := range segs {
+		baseline = append(baseline, &segs[i])
+	}
+	// The suffix array is built by the first substring lookup, not timed.
+	idx.match(m, paramVal)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var res []SegmentConfig
+		if indexed {
+			res = idx.match(m, paramVal)
+		} else {
+			res = baselineMatch(baseline, m, paramVal)
+		}
+		if len(res) != 1 {
+			b.Fatalf("found %d segments, expected 1", len(res))
+		}
+	}
+}
+
+func BenchmarkLegacySubstringScan(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) { benchmarkMatch(b, n, LegacySubstring, false) })
+	}
+}
+
+func BenchmarkLegacySubstringIndexed(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) { benchmarkMatch(b, n, LegacySubstring, true) })
+	}
+}
+
+func BenchmarkNewlineSetScan(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) { benchmarkMatch(b, n, NewlineSet, false) })
+	}
+}
+
+func BenchmarkNewlineSetIndexed(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) { benchmarkMatch(b, n, NewlineSet, true) })
+	}
+}
+
+func BenchmarkGetSegmentForOrgAndKeyAndVal(b *testing.B) {
+	Ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "sub", "kids")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "sub", "kids")
+	}
+}
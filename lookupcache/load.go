@@ -0,0 +1,209 @@
+package lookupcache
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// LoadMode tells when a `Cache` parses the orgs of its data.
+type LoadMode int
+
+const (
+	// Lazy parses an org the first time it is looked up, it is the default.
+	Lazy LoadMode = iota
+	// Eager parses all the orgs as `Load` does, in the background as soon as the cache is created or reloaded.
+	// Lookups wait for it to be done.
+	Eager
+)
+
+// WithLoadMode makes the cache parse its orgs as `mode` tells.
+func WithLoadMode(mode LoadMode) Option {
+	return func(ec *Cache) {
+		ec.loadMode = mode
+	}
+}
+
+// WithWorkers makes `Load` parse up to `n` orgs at the same time, instead of `runtime.GOMAXPROCS(0)`.
+func WithWorkers(n int) Option {
+	return func(ec *Cache) {
+		if n > 0 {
+			ec.workers = n
+		}
+	}
+}
+
+// WithLoadProgress makes `Load` call `progress` every time an org is parsed, with the number of orgs parsed
+// so far out of the `total` to parse. The calls don't overlap.
+func WithLoadProgress(progress func(done, total int)) Option {
+	return func(ec *Cache) {
+		ec.progress = progress
+	}
+}
+
+// OrgError is an org of the data file which failed to parse.
+type OrgError struct {
+	OrgKey string
+	Err    error
+}
+
+func (e *OrgError) Error() string {
+	return fmt.Sprintf("lookupcache: org %s: %s", e.OrgKey, e.Err)
+}
+
+func (e *OrgError) Unwrap() error {
+	return e.Err
+}
+
+// LoadError is returned by `Load` when some of the data couldn't be parsed, the rest of it is loaded.
+type LoadError struct {
+	// Errs are `*OrgError`s, an error of the top level array of the data file, or that of the context.
+	Errs []error
+}
+
+func (e *LoadError) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("lookupcache: %d errors loading data: %s", len(e.Errs), strings.Join(msgs, "; "))
+}
+
+func (e *LoadError) Unwrap() []error {
+	return e.Errs
+}
+
+// Load parses all the orgs of the data not parsed yet, with a pool of workers, see `WithWorkers`.
+// If `ctx` is done before, it stops and returns its error among the others. Whatever has been parsed is kept.
+// With `Eager` loading, it waits for the load started by the cache instead and returns the errors of that one.
+func (ec *Cache) Load(ctx context.Context) error {
+	ec.lock.RLock()
+	loading := ec.loading
+	ec.lock.RUnlock()
+
+	if loading == nil {
+		return ec.load(ctx)
+	}
+
+	select {
+	case <-loading.done:
+		return loading.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loadState is a load started by an `Eager` cache.
+type loadState struct {
+	done chan struct{}
+	err  error
+}
+
+// startLoad starts loading the data in the background, `ec.lock` must be held for writing.
+func (ec *Cache) startLoad() {
+	loading := &loadState{done: make(chan struct{})}
+	ec.loading = loading
+
+	go func() {
+		loading.err = ec.load(context.Background())
+		close(loading.done)
+	}()
+}
+
+// waitLoad waits for the load started by an `Eager` cache, if any.
+func (ec *Cache) waitLoad() {
+	ec.lock.RLock()
+	loading := ec.loading
+	ec.lock.RUnlock()
+
+	if loading != nil {
+		<-loading.done
+	}
+}
+
+// orgJob is an org of `data` for a worker of `load` to parse.
+type orgJob struct {
+	orgKey  string
+	details []byte
+}
+
+func (ec *Cache) load(ctx context.Context) error {
+	var errs []error
+
+	dir, gen := ec.directory()
+	if dir.err != nil {
+		errs = append(errs, dir.err)
+	}
+	jobs := ec.orgJobs(dir)
+
+	var lock sync.Mutex
+	done := 0
+
+	chJobs := make(chan orgJob)
+	var wg sync.WaitGroup
+	for i := 0; i < ec.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for job := range chJobs {
+				_, err := ec.loadOrg(gen, job.orgKey, job.details)
+
+				lock.Lock()
+				if err != nil {
+					errs = append(errs, &OrgError{OrgKey: job.orgKey, Err: err})
+				}
+				done++
+				if ec.progress != nil {
+					ec.progress(done, len(jobs))
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
+Jobs:
+	for _, job := range jobs {
+		select {
+		case chJobs <- job:
+		case <-ctx.Done():
+			break Jobs
+		}
+	}
+	close(chJobs)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		errs = append(errs, ctx.Err())
+	}
+
+	if len(errs) > 0 {
+		return &LoadError{Errs: errs}
+	}
+	ec.markComplete(gen)
+	return nil
+}
+
+// orgJobs lists the orgs of `dir` not parsed yet, in the order of the data file.
+func (ec *Cache) orgJobs(dir *orgDir) []orgJob {
+	jobs := make([]orgJob, 0)
+
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	for listing, orgKey := range dir.keys {
+		// An org listed twice is parsed from its first listing only, as looking it up does.
+		if _, ok := ec.orgs[orgKey]; !ok && dir.first[orgKey] == listing {
+			details, _ := dir.details(orgKey)
+			jobs = append(jobs, orgJob{orgKey: orgKey, details: details})
+		}
+	}
+
+	return jobs
+}
+
+func defaultWorkers() int {
+	return runtime.GOMAXPROCS(0)
+}
@@ -0,0 +1,119 @@
+package lookupcache
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/lnshi/json-lookup/tool/json"
+)
+
+func TestLoad(t *testing.T) {
+	data, err := ioutil.ReadFile(DefaultDataFile)
+	if err != nil {
+		t.Fatalf("reading the data file failed with error %s", err)
+	}
+
+	calls, lastDone, lastTotal := 0, 0, 0
+	ec := New(data, WithWorkers(3), WithLoadProgress(func(done, total int) {
+		calls++
+		lastDone, lastTotal = done, total
+	}))
+	if err := ec.Load(context.Background()); err != nil {
+		t.Fatalf("`Load` failed with error %s", err)
+	}
+	if calls != 117 || lastDone != 117 || lastTotal != 117 {
+		t.Errorf("`Load` reported progress %d times, up to %d/%d, expected 117 times up to 117/117", calls, lastDone, lastTotal)
+	}
+
+	// Everything parsed already, nothing is left to do.
+	calls = 0
+	if err := ec.Load(context.Background()); err != nil || calls != 0 {
+		t.Errorf("`Load` called again failed with error %v and reported progress %d times, expected nothing to do", err, calls)
+	}
+
+	// The same as parsed lazily.
+	lazy := New(data)
+	orgKeys, _ := lazy.OrgKeys()
+	for _, orgKey := range orgKeys {
+		for _, paramKey := range lazy.ParamKeys(orgKey) {
+			expect, res := lazy.ParamSegs(orgKey, paramKey), ec.ParamSegs(orgKey, paramKey)
+			if len(expect) != len(res) {
+				t.Errorf("%s of %s has %d rules loaded, expected %d", paramKey, orgKey, len(res), len(expect))
+				continue
+			}
+			for idx := range expect {
+				if expect[idx] != res[idx] {
+					t.Errorf("rule %d of %s of %s is %v loaded, expected %v", idx, paramKey, orgKey, res[idx], expect[idx])
+				}
+			}
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	data := []byte(`[
+  {"6lkb2cv": [{"gen": [{"Female": {"segmentId": "dem.g.f"}}]}]},
+  {"1a9n4ou": [{"gen": [{"Female": {"id": "dem.g.f"}}]}]},
+  {"bkie9g1": [{"gen": [{"Female" {"segmentId": "dem.g.f"}}]}]},
+  {"e9gd6h1": [{"gen": [{"Male": {"segmentId": "dem.g.m"}}]}]}
+]`)
+
+	ec := New(data, WithWorkers(2))
+	err := ec.Load(context.Background())
+
+	var loadErr *LoadError
+	if !errors.As(err, &loadErr) || len(loadErr.Errs) != 2 {
+		t.Fatalf("`Load` returned error %v, expected a `LoadError` of 2 errors", err)
+	}
+	var orgErr *OrgError
+	if !errors.As(err, &orgErr) {
+		t.Errorf("`Load` returned error %v, expected it to wrap an `OrgError`", err)
+	}
+	if !errors.Is(err, json.JsonPathNotFound) || !errors.Is(err, json.InvalidJson) {
+		t.Errorf("`Load` returned error %v, expected it to wrap `JsonPathNotFound` and `InvalidJson`", err)
+	}
+
+	// The orgs which parsed are loaded.
+	if res := ec.GetSegmentForOrgAndKeyAndVal("e9gd6h1", "gen", "Male"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.g.m"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` after a failed `Load` returned %s, expected [{dem.g.m}]", res)
+	}
+
+	if err := New([]byte(`[{"6lkb2cv": []}, `)).Load(context.Background()); !errors.Is(err, json.InvalidJson) {
+		t.Errorf("`Load` of invalid data returned error %v, expected `InvalidJson`", err)
+	}
+}
+
+func TestLoadCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ec := New([]byte(rulesTestData))
+	if err := ec.Load(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("`Load` with a canceled context returned error %v, expected `context.Canceled`", err)
+	}
+
+	// Still looked up lazily.
+	if res := ec.RulesForSegment("intr.edu"); len(res) != 3 {
+		t.Errorf("`RulesForSegment` after a canceled `Load` returned %v, expected 3 rules", res)
+	}
+}
+
+func TestEagerLoadMode(t *testing.T) {
+	ec := New([]byte(rulesTestData), WithLoadMode(Eager))
+	if res := ec.GetSegmentForOrgAndKey("1a9n4ou", "edu"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "intr.edu"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKey` returned %s, expected [{intr.edu}]", res)
+	}
+	if err := ec.Load(context.Background()); err != nil {
+		t.Errorf("`Load` failed with error %s", err)
+	}
+
+	ec.Reload([]byte(`[{"6lkb2cv": [`))
+	if err := ec.Load(context.Background()); !errors.Is(err, json.InvalidJson) {
+		t.Errorf("`Load` after reloading invalid data returned error %v, expected `InvalidJson`", err)
+	}
+	if res := ec.GetSegmentForOrgAndKey("1a9n4ou", "edu"); len(res) != 0 {
+		t.Errorf("`GetSegmentForOrgAndKey` after reloading invalid data returned %s, expected nothing", res)
+	}
+}
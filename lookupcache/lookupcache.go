@@ -1,11 +1,14 @@
 package lookupcache
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/lnshi/json-lookup/tool/json"
 )
@@ -27,169 +30,597 @@ func (cfg *SegmentConfig) GetId() string {
 
 // Starting Leonard's code
 
-// `data` is the raw bytes slice which represents the very original data in memory.
-var data []byte
+// DefaultDataFile is the data file `Ec` is loaded from.
+var DefaultDataFile = filepath.Join(os.Getenv("GOPATH"), "src/github.com/lnshi/json-lookup/data/data.json")
 
 type ParamSeg struct {
 	ParamVal string
 	SegId    string
 }
 
-type Cache map[string]map[string][]*ParamSeg
+// Cache holds the raw bytes of one data file and parses an org out of them the first time it is looked up.
+//
+// Cache used to be a map from org key to param key to rules, which callers could index directly. It is a struct
+// since each data file has a cache of its own, `Ec` being the one of `DefaultDataFile`: the orgs of a cache are
+// only parsed on demand, evicted and reloaded under its lock, so the map can't be handed out. The rules of an org
+// are read through `OrgKeys`, `ParamKeys` and `ParamSegs` instead.
+type Cache struct {
+	// `data` is the raw bytes slice which represents the very original data in memory.
+	data []byte
+
+	lock sync.RWMutex
+	orgs map[string]*orgEntry
+	// `strs` interns the param keys and segment ids of the orgs of `data`, it only grows until the next `Reload`.
+	// The orgs of a cache with a capacity each have a table of their own instead, going away with them, see `parseOrg`.
+	// `liveStrs` is the number of its strings the orgs used when last counted, see `compactStrings`.
+	strs     *strTable
+	liveStrs int
+
+	// `segRules` is the reverse index of `orgs`, from a segment id to the rules emitting it.
+	// It isn't kept by a cache with a capacity, see `bounded`.
+	segRules map[string][]Rule
+	// `complete` is set once every org of `data` has been parsed and kept, never for a cache with a capacity.
+	complete bool
+	// `matcher` matches the values of the params not in `paramMatchers`.
+	matcher       Matcher
+	paramMatchers map[string]Matcher
+	// `loadMode`, `workers` and `progress` are the load options, `loading` is the load started by an `Eager` cache.
+	loadMode LoadMode
+	workers  int
+	progress func(done, total int)
+	loading  *loadState
+
+	// `sidecar` holds the numeric rules added by `NumericRules`, if any.
+	sidecar *Cache
+	// `sources` are the sources merged over `data` by `NewFromSources`, and `sourceNames` the names of all of them,
+	// `data` first.
+	sources     []*source
+	sourceNames []string
+	// `src` is the source of a cache created by `NewFromSource`, whose orgs are fetched from it rather than parsed
+	// out of `data`.
+	src SegmentSource
+	// `reloading` is held by `ReloadChanged`, so that one goes after the other.
+	reloading sync.Mutex
+
+	// `dir` is the directory of the orgs of `data`, built by the first lookup which needs it, and `negative`
+	// remembers the orgs recently found not to be in `data`.
+	dir      *orgDir
+	negative *negCache
+	// `offsetIndexFile` is where the directory is saved, see `WithOffsetIndexFile`.
+	offsetIndexFile string
+	// `snapshotFile` is where the orgs parsed are read from, see `WithSnapshotFile`, and `snapshotErr` why they
+	// weren't for the current data.
+	snapshotFile string
+	snapshotErr  error
+
+	// `inflight` holds the orgs being parsed, see `loadOrg`, `parses` counts the orgs parsed so far and `scans`
+	// the scans of `data` for its directory.
+	inflight map[string]*orgCall
+	parses   int64
+	scans    int64
+
+	// `maxOrgs`, `maxBytes` and `policy` are the capacity options, `evictor` picks the orgs to evict and `bytes` is
+	// the size of the orgs in `orgs`.
+	maxOrgs  int
+	maxBytes int64
+	policy   EvictionPolicy
+	evictor  Evictor
+	bytes    int64
+	// `hits`, `misses` and `evictions` are counted for `Stats`.
+	hits      int64
+	misses    int64
+	evictions int64
+
+	// `mmap` is set by `WithMmap`, `unmap` releases the data file mapped by `NewFromFile` then, and `closed` is set
+	// once it has, by `Close`.
+	mmap   bool
+	unmap  func() error
+	closed bool
+
+	// `gen` is bumped by every `Reload`, so parses of the previous data don't end up in `orgs`.
+	gen int
+
+	// `version` is the current version of the data, `history` the previous ones kept, oldest first, up to
+	// `historySize` with the current one, see `WithHistory`.
+	version     Version
+	history     []*pastVersion
+	historySize int
+}
 
-var Ec Cache
+// Ec is the cache over `DefaultDataFile`, it finds nothing if that file cannot be read, see `EcErr`.
+var Ec *Cache
 
-var lock = sync.RWMutex{}
+// EcErr is the error reading `DefaultDataFile` into `Ec`, nil if it was read. Programs looking up `Ec` should
+// check it first, those loading their own data file can ignore it.
+var EcErr error
 
 func init() {
-	Ec = make(map[string]map[string][]*ParamSeg)
+	// Don't panic here, binaries loading their own data file must not depend on `DefaultDataFile` being around.
+	Ec = New(nil)
 
-	dataFilePath := filepath.Join(os.Getenv("GOPATH"), "src/github.com/lnshi/json-lookup/data/data.json")
+	res, err := ioutil.ReadFile(DefaultDataFile)
+	if err != nil {
+		EcErr = err
+		return
+	}
+	Ec.data = res
+}
 
-	if res, err := ioutil.ReadFile(dataFilePath); err != nil {
-		panic(err)
+// New returns a cache over `data`, the raw bytes of a data file, nothing is parsed before the first lookup.
+func New(data []byte, opts ...Option) *Cache {
+	ec := newCache(opts)
+	ec.data = data
+	ec.start()
+	return ec
+}
+
+// NewFromFile reads the data file at `path`, or maps it with `WithMmap`, and returns a cache over it.
+func NewFromFile(path string, opts ...Option) (*Cache, error) {
+	ec := newCache(opts)
+
+	if ec.mmap {
+		res, unmap, err := mapFile(path)
+		if err != nil {
+			return nil, err
+		}
+		ec.data, ec.unmap = res, unmap
 	} else {
-		data = res
+		res, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		ec.data = res
+	}
+
+	ec.start()
+	return ec, nil
+}
+
+// newCache returns a cache with `opts` applied, but no data yet.
+func newCache(opts []Option) *Cache {
+	ec := &Cache{
+		orgs:          make(map[string]*orgEntry),
+		strs:          newStrTable(),
+		inflight:      make(map[string]*orgCall),
+		segRules:      make(map[string][]Rule),
+		matcher:       LegacySubstring,
+		paramMatchers: make(map[string]Matcher),
+		workers:       defaultWorkers(),
+		negative:      newNegCache(defaultNegativeCacheSize, defaultNegativeCacheTTL),
+		policy:        LRU,
+		version:       Version{Id: 1, LoadedAt: time.Now()},
+	}
+	for _, opt := range opts {
+		opt(ec)
+	}
+	ec.evictor = ec.policy()
+
+	return ec
+}
+
+// start reads the snapshot file, if any, and starts loading the data as `loadMode` tells.
+func (ec *Cache) start() {
+	snap, err := ec.readSnapshot(ec.data)
+
+	ec.lock.Lock()
+	defer ec.lock.Unlock()
+
+	ec.restoreSnapshot(snap, err)
+	if ec.loadMode == Eager {
+		ec.startLoad()
+	}
+}
+
+// Reload replaces the data of the cache with `data`, everything parsed from the previous data is dropped,
+// but for the versions kept by `WithHistory`.
+func (ec *Cache) Reload(data []byte) {
+	snap, err := ec.readSnapshot(data)
+
+	ec.lock.Lock()
+	defer ec.lock.Unlock()
+
+	ec.retire()
+	ec.data = data
+	ec.orgs = make(map[string]*orgEntry)
+	ec.strs, ec.liveStrs = newStrTable(), 0
+	ec.evictor = ec.policy()
+	ec.bytes = 0
+	ec.inflight = make(map[string]*orgCall)
+	ec.segRules = make(map[string][]Rule)
+	ec.complete = false
+	ec.dir = nil
+	ec.gen++
+	ec.negative.reset(ec.gen)
+
+	ec.restoreSnapshot(snap, err)
+
+	if ec.loadMode == Eager {
+		ec.startLoad()
+	}
+}
+
+// OrgKeys returns the keys of all the orgs in the data file, in the order they are listed there,
+// followed by those only in the other sources, if any, see `NewFromSources`.
+func (ec *Cache) OrgKeys() ([]string, error) {
+	dir, _ := ec.directory()
+	if dir.err != nil {
+		return nil, dir.err
+	}
+
+	return append(make([]string, 0, len(dir.keys)), dir.keys...), nil
+}
+
+// ParamKeys returns the sorted keys of the params configured for `orgKey`, nil if there is no such org.
+func (ec *Cache) ParamKeys(orgKey string) []string {
+	entry, ok := ec.org(orgKey)
+	if !ok {
+		return nil
+	}
+
+	paramKeys := make([]string, 0, len(entry.params))
+	for paramKey := range entry.params {
+		paramKeys = append(paramKeys, paramKey)
+	}
+
+	sort.Strings(paramKeys)
+
+	return paramKeys
+}
+
+// ParamSegs returns copies of the rules configured for `paramKey` of `orgKey`, in the order of the data file.
+func (ec *Cache) ParamSegs(orgKey string, paramKey string) []ParamSeg {
+	entry, ok := ec.org(orgKey)
+	if !ok {
+		return nil
+	}
+
+	idx, ok := entry.params[paramKey]
+	if !ok {
+		return []ParamSeg{}
 	}
+	return idx.segs()
 }
 
-func (ec Cache) GetSegmentForOrgAndKey(orgKey string, paramKey string) []SegmentConfig {
+func (ec *Cache) GetSegmentForOrgAndKey(orgKey string, paramKey string) []SegmentConfig {
 	return ec.GetSegmentForOrgAndKeyAndVal(orgKey, paramKey, "")
 }
 
-func (ec Cache) GetSegmentForOrgAndKeyAndVal(orgKey string, paramKey string, paramVal string) []SegmentConfig {
-	if orgKey == "" || paramKey == "" {
+func (ec *Cache) GetSegmentForOrgAndKeyAndVal(orgKey string, paramKey string, paramVal string) []SegmentConfig {
+	segs, err := ec.GetSegmentForOrgAndKeyAndValE(orgKey, paramKey, paramVal)
+	if err != nil {
 		return []SegmentConfig{}
 	}
+	return segs
+}
 
-	// The data for this `orgKey` has already been parsed, we just need to search in `Ec`.
-	if paramMap, ok := Ec[orgKey]; ok {
-		// Found segs with this `paramKey`.
-		if segs, ok := paramMap[paramKey]; ok {
-
-			res := make([]SegmentConfig, 0)
-
-			for _, paramSeg := range segs {
-				if paramSeg.ParamVal == paramVal {
-					res = append(res, SegmentConfig{Id: paramSeg.SegId})
-				} else if paramVal != "" && strings.Index(paramSeg.ParamVal, paramVal) != -1 {
-					res = append(res, SegmentConfig{Id: paramSeg.SegId})
-				}
-			}
-			return res
-		} else {
-			// No this `paramKey`.
-			return []SegmentConfig{}
-		}
+// matchOrg returns the segments the rules of `paramKey` of the org `entry` emit for `paramVal`,
+// or `ErrParamNotFound`.
+func (ec *Cache) matchOrg(entry *orgEntry, paramKey string, paramVal string) ([]SegmentConfig, error) {
+	idx, ok := entry.params[paramKey]
+
+	// Found segs with this `paramKey`.
+	if ok {
+		return idx.match(ec.paramMatcher(paramKey), paramVal), nil
 	} else {
-		// We need to parse data for this `orgKey` from the raw bytes `data`.
+		// No this `paramKey`.
+		return nil, ErrParamNotFound
+	}
+}
 
-		chOrgs := make(chan *json.V)
-		go json.IterateArray(chOrgs, data)
+// orgEntry is an org as parsed, it isn't modified afterwards so it is read without holding `ec.lock`.
+type orgEntry struct {
+	// `params` holds the rules of every param along with their indexes, their strings are those of the string
+	// table of the cache when it was parsed, see `paramIndex.strs`. It may be one `Reload` replaced since,
+	// for an org shared with a past version, see `WithHistory`.
+	params map[string]*paramIndex
+	// `size` is roughly the memory it takes, see `WithMaxBytes`.
+	size int64
+}
 
-		var wg sync.WaitGroup
+// org returns `orgKey` as parsed, see `lookupOrg`, and whether it was found.
+func (ec *Cache) org(orgKey string) (*orgEntry, bool) {
+	entry, err := ec.lookupOrg(orgKey)
+	return entry, err == nil
+}
 
-		// Before there is org object returned we can do nothing.
-		for org := range chOrgs {
-			if org.Err != nil {
-				return []SegmentConfig{}
-			}
+// lookupOrg returns `orgKey` as parsed, parsing it from `data` if that hasn't been done yet or it has been evicted
+// since. It fails with `ErrOrgNotFound`, or an `*OrgError` if the org can't be parsed.
+func (ec *Cache) lookupOrg(orgKey string) (*orgEntry, error) {
+	if ec.loadMode == Eager {
+		ec.waitLoad()
+	}
 
-			chOrgDetails := make(chan *json.Kv)
-			go json.IterateObject(chOrgDetails, org.V)
+	// The data for this `orgKey` has already been parsed.
+	ec.lock.RLock()
+	entry, ok := ec.orgs[orgKey]
+	evictor := ec.evictor
+	closed := ec.closed
+	ec.lock.RUnlock()
+
+	if closed {
+		return nil, ErrClosed
+	}
+	if ok {
+		atomic.AddInt64(&ec.hits, 1)
+		// Without a capacity there is nothing to evict, nor any access order to keep.
+		if ec.bounded() {
+			evictor.Accessed(orgKey)
+		}
+		return entry, nil
+	}
+	atomic.AddInt64(&ec.misses, 1)
 
-			// Before knowing the `orgKey` we can do nothing.
-			for orgDetail := range chOrgDetails {
-				if orgDetail.Err != nil {
-					return []SegmentConfig{}
-				}
+	if ec.negative.has(orgKey) {
+		return nil, ErrOrgNotFound
+	}
 
-				currOrgKey := string(orgDetail.K)
+	// We need to parse data for this `orgKey` from the raw bytes of its details.
+	dir, gen := ec.directory()
+	orgDetails, found := dir.details(orgKey)
+	if !found {
+		if dir.err != nil {
+			// It may be past where the directory stopped.
+			return nil, dir.err
+		}
+		// Not found means the org isn't in `data` at all.
+		ec.negative.add(gen, orgKey)
+		return nil, ErrOrgNotFound
+	}
 
-				if _, ok := Ec[currOrgKey]; ok {
-					continue
-				}
+	entry, err := ec.loadOrg(gen, orgKey, orgDetails)
+	if err != nil {
+		return nil, &OrgError{OrgKey: orgKey, Err: err}
+	}
+	return entry, nil
+}
 
-				paramSegMap := make(map[string][]*ParamSeg)
+// eachOrg calls `fn` with every org of `data` in the order of the data file, or the error parsing it, and returns
+// the directory of `data`. The orgs not kept parsed are parsed without being kept, so as not to evict those looked up.
+func (ec *Cache) eachOrg(fn func(orgKey string, entry *orgEntry, err error)) *orgDir {
+	dir, gen := ec.directory()
+	for listing, orgKey := range dir.keys {
+		if dir.first[orgKey] != listing {
+			continue
+		}
 
-				// Added `orgDetail.V` to `Ec`.
-				wg.Add(1)
-				go addedToEc(&wg, currOrgKey, paramSegMap, orgDetail.V)
+		ec.lock.RLock()
+		entry, ok := ec.orgs[orgKey]
+		ok = ok && ec.gen == gen
+		ec.lock.RUnlock()
 
-				// This is the org current call is looking.
-				if currOrgKey == orgKey {
-					// Haven't reached end yet, close the channel deliberately to terminate the orgs iterator goroutine.
-					if _, ok := <-chOrgs; ok {
-						// Will cause race condition, but it is fine.
-						close(chOrgs)
-					}
-				}
-			}
+		if ok {
+			fn(orgKey, entry, nil)
+			continue
 		}
 
-		wg.Wait()
+		orgDetails, _ := dir.details(orgKey)
+		entry, err := ec.parseOrg(orgKey, orgDetails)
+		fn(orgKey, entry, err)
+	}
+	return dir
+}
+
+// parseAll parses all the orgs of `data` which haven't been yet.
+func (ec *Cache) parseAll() {
+	ec.lock.RLock()
+	complete := ec.complete
+	ec.lock.RUnlock()
+
+	if !complete {
+		ec.load(context.Background())
+	}
+}
+
+// orgCall is the parse of an org in flight, which concurrent lookups of the org wait for rather than parsing it too.
+type orgCall struct {
+	done  chan struct{}
+	entry *orgEntry
+	err   error
+}
+
+// loadOrg parses `orgDetails`, the raw details of `orgKey` in the data of generation `gen`, and adds the org to `orgs`.
+// The org is parsed once only, whoever asks for it meanwhile gets the same result, even if it is evicted right away.
+func (ec *Cache) loadOrg(gen int, orgKey string, orgDetails []byte) (*orgEntry, error) {
+	ec.lock.Lock()
+	if ec.gen != gen {
+		// Reloaded since, the caller still gets the org of the data it started with, but it isn't kept.
+		ec.lock.Unlock()
+		return ec.parseOrg(orgKey, orgDetails)
+	}
+	if entry, ok := ec.orgs[orgKey]; ok {
+		ec.lock.Unlock()
+		return entry, nil
+	}
+	if call, ok := ec.inflight[orgKey]; ok {
+		ec.lock.Unlock()
+		<-call.done
+		return call.entry, call.err
+	}
+	if entry := ec.sharedOrg(orgKey, orgDetails); entry != nil {
+		ec.addOrg(orgKey, entry)
+		ec.lock.Unlock()
+		return entry, nil
+	}
+	call := &orgCall{done: make(chan struct{})}
+	inflight := ec.inflight
+	inflight[orgKey] = call
+	ec.lock.Unlock()
+
+	call.entry, call.err = ec.parseOrg(orgKey, orgDetails)
 
-		return Ec.GetSegmentForOrgAndKeyAndVal(orgKey, paramKey, paramVal)
+	ec.lock.Lock()
+	// Reloaded meanwhile, what was parsed belongs to the previous data, `inflight` too.
+	if call.err == nil && ec.gen == gen {
+		ec.addOrg(orgKey, call.entry)
 	}
+	delete(inflight, orgKey)
+	ec.lock.Unlock()
+
+	close(call.done)
+
+	return call.entry, call.err
 }
 
-func addedToEc(wg *sync.WaitGroup, orgKey string, paramSegMap map[string][]*ParamSeg, orgDetails []byte) {
-	defer wg.Done()
+// parseOrg parses `orgDetails`, the raw details of `orgKey`, nil if it is only in the other sources or fetched
+// from the source of the cache, merging the rules of the other sources and adding those of the sidecar for it.
+func (ec *Cache) parseOrg(orgKey string, orgDetails []byte) (*orgEntry, error) {
+	atomic.AddInt64(&ec.parses, 1)
+
+	// The orgs of a cache with a capacity don't share their strings, which would outlive them otherwise.
+	strs := newStrTable()
+	if !ec.bounded() {
+		ec.lock.RLock()
+		strs = ec.strs
+		ec.lock.RUnlock()
+	}
+
+	paramMap := make(map[string]*paramRules)
+	var err error
+	switch {
+	case orgDetails != nil:
+		paramMap, err = parseOrgDetails(strs, orgDetails)
+	case ec.src != nil:
+		paramMap, err = ec.fetchOrg(strs, orgKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(ec.sources) > 0 {
+		if err := ec.mergeSources(strs, orgKey, paramMap); err != nil {
+			return nil, err
+		}
+	}
+	if ec.sidecar != nil {
+		ec.sidecarRules(strs, orgKey, paramMap)
+	}
+	return newOrgEntry(strs, orgKey, paramMap), nil
+}
 
-	chParam := make(chan *json.V)
-	go json.IterateArray(chParam, orgDetails)
+// newOrgEntry indexes the rules `paramMap` of `orgKey`, their strings are those of `strs`.
+func newOrgEntry(strs *strTable, orgKey string, paramMap map[string]*paramRules) *orgEntry {
+	entry := &orgEntry{params: make(map[string]*paramIndex, len(paramMap))}
+	for paramKey, rules := range paramMap {
+		entry.params[paramKey] = newParamIndex(strs, *rules)
+	}
+	entry.size = orgSize(orgKey, entry.params)
+	return entry
+}
 
-	for param := range chParam {
-		// Parse param object.
-		wg.Add(1)
-		go parseParamObj(wg, orgKey, paramSegMap, param.V)
+// markComplete records that all the orgs of the data of generation `gen` have been parsed.
+func (ec *Cache) markComplete(gen int) {
+	ec.lock.Lock()
+	// The orgs of a cache with a capacity may have been evicted on the way.
+	if ec.gen == gen && !ec.bounded() {
+		ec.complete = true
 	}
+	ec.lock.Unlock()
 }
 
-func parseParamObj(wg *sync.WaitGroup, orgKey string, paramSegMap map[string][]*ParamSeg, paramObj []byte) {
-	defer wg.Done()
+// parseOrgDetails parses the params of an org, `[{"<paramKey>": [<seg>, ...]}, ...]`, all in the calling goroutine
+// but for those of the iterators. Their param keys and segment ids are interned in `strs`.
+func parseOrgDetails(strs *strTable, orgDetails []byte) (map[string]*paramRules, error) {
+	paramSegMap := make(map[string]*paramRules)
+
+	chParams := make(chan *json.V)
+	go json.IterateArray(chParams, orgDetails)
+	defer drainV(chParams)
 
+	for param := range chParams {
+		if param.Err != nil {
+			return nil, corrupt(param.Err)
+		}
+		if err := parseParam(strs, paramSegMap, param.V); err != nil {
+			return nil, corrupt(err)
+		}
+	}
+
+	return paramSegMap, nil
+}
+
+// parseParam parses `{"<paramKey>": [<seg>, ...]}` into `paramSegMap`.
+func parseParam(strs *strTable, paramSegMap map[string]*paramRules, paramObj []byte) error {
 	chParamDetails := make(chan *json.Kv)
 	go json.IterateObject(chParamDetails, paramObj)
+	defer drainKv(chParamDetails)
 
 	for paramDetail := range chParamDetails {
-		// Parse segs array.
-		segs := make([]*ParamSeg, 0)
-
-		paramName := string(paramDetail.K)
+		if paramDetail.Err != nil {
+			return paramDetail.Err
+		}
 
-		lock.Lock()
-		paramSegMap[paramName] = segs
-		lock.Unlock()
+		// The same key across orgs is held once.
+		paramKey := strs.str(strs.intern(paramDetail.K))
+		rules, ok := paramSegMap[paramKey]
+		if !ok {
+			rules = &paramRules{}
+			paramSegMap[paramKey] = rules
+		}
 
-		wg.Add(1)
-		go parseSegArr(wg, orgKey, paramName, paramSegMap, paramDetail.V)
+		if err := parseSegs(strs, rules, paramDetail.V); err != nil {
+			return err
+		}
 	}
-}
 
-func parseSegArr(wg *sync.WaitGroup, orgKey string, paramName string, paramSegMap map[string][]*ParamSeg, segsArr []byte) {
-	defer wg.Done()
+	return nil
+}
 
+// parseSegs parses `[<seg>, ...]` into `rules`.
+func parseSegs(strs *strTable, rules *paramRules, segsArr []byte) error {
 	chSegs := make(chan *json.V)
 	go json.IterateArray(chSegs, segsArr)
+	defer drainV(chSegs)
 
 	for seg := range chSegs {
-		segInStr := string(seg.V)
+		paramVal, segId, err := parseSeg(seg)
+		if err != nil {
+			return err
+		}
+		rules.add(string(paramVal), strs.intern(segId))
+	}
 
-		firstQuotMark := strings.Index(segInStr, `"`)
-		secondQuotMark := strings.Index(segInStr[firstQuotMark+1:], `"`)
-		paramVal := segInStr[firstQuotMark+1 : firstQuotMark+secondQuotMark+1]
+	return nil
+}
 
-		lastQuotMark := strings.LastIndex(segInStr, `"`)
-		secondLastQuotMark := strings.LastIndex(segInStr[:lastQuotMark], `"`)
-		segId := segInStr[secondLastQuotMark+1 : lastQuotMark]
+// parseSeg parses `{"<paramVal>": {"segmentId": "<segId>"}}`, one of the elements of a segs array as handed out by
+// the iterator, so its `Err` is the one returned if set. The value and segment id returned are slices of `seg.V`.
+func parseSeg(seg *json.V) ([]byte, []byte, error) {
+	if seg.Err != nil {
+		return nil, nil, seg.Err
+	}
+
+	chSegDetails := make(chan *json.Kv)
+	go json.IterateObject(chSegDetails, seg.V)
+	// Returning early must not leave the iterator goroutine blocked.
+	defer drainKv(chSegDetails)
 
-		lock.Lock()
-		paramSegMap[paramName] = append(paramSegMap[paramName], &ParamSeg{ParamVal: paramVal, SegId: segId})
-		lock.Unlock()
+	segDetail, ok := <-chSegDetails
+	if !ok {
+		return nil, nil, json.JsonPathNotFound
+	}
+	if segDetail.Err != nil {
+		return nil, nil, segDetail.Err
+	}
+
+	chSegId := make(chan *json.V)
+	go json.GetByKeyPath(chSegId, segDetail.V, "segmentId")
+
+	segId, ok := <-chSegId
+	if !ok {
+		return nil, nil, json.JsonPathNotFound
+	}
+	if segId.Err != nil {
+		return nil, nil, segId.Err
 	}
 
-	lock.Lock()
-	Ec[orgKey] = paramSegMap
-	lock.Unlock()
+	return segDetail.K, segId.V, nil
+}
+
+func drainV(ch <-chan *json.V) {
+	for range ch {
+	}
+}
+
+func drainKv(ch <-chan *json.Kv) {
+	for range ch {
+	}
 }
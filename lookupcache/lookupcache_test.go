@@ -2,6 +2,9 @@ package lookupcache
 
 import (
 	"fmt"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -173,3 +176,126 @@ func TestEmptyIsAlwaysSame(t *testing.T) {
 	fmt.Println(res1)
 	// fmt.Printf("%p, %p", res1, res2)
 }
+
+func TestUnknownOrg(t *testing.T) {
+	res := Ec.GetSegmentForOrgAndKeyAndVal("nonexistent", "gen", "Male")
+	if !compareSliceOfSegmentConfig([]SegmentConfig{}, res) {
+		t.Errorf("`Ec.GetSegmentForOrgAndKeyAndVal` on an unknown org returned %s, expected nothing", res)
+	}
+}
+
+func TestOrgKeys(t *testing.T) {
+	if EcErr != nil {
+		t.Fatalf("reading `DefaultDataFile` failed with error %s", EcErr)
+	}
+	orgKeys, err := Ec.OrgKeys()
+	if err != nil {
+		t.Fatalf("`Ec.OrgKeys` failed with error %s", err)
+	}
+	if len(orgKeys) != 117 || orgKeys[0] != "6lkb2cv" || orgKeys[len(orgKeys)-1] != "e9gd6h1" {
+		t.Errorf("`Ec.OrgKeys` returned %d orgs from %s to %s, expected 117 orgs from 6lkb2cv to e9gd6h1", len(orgKeys), orgKeys[0], orgKeys[len(orgKeys)-1])
+	}
+
+	if _, err := New([]byte(`[{"6lkb2cv":[]},`)).OrgKeys(); err == nil {
+		t.Errorf("`OrgKeys` on invalid data succeeded")
+	}
+}
+
+func TestParamKeys(t *testing.T) {
+	if res := Ec.ParamKeys("bkie9g1"); len(res) != 2 || res[0] != "_" || res[1] != "cat" {
+		t.Errorf("`Ec.ParamKeys` returned %s, expected [_ cat]", res)
+	}
+	if res := Ec.ParamKeys("nonexistent"); res != nil {
+		t.Errorf("`Ec.ParamKeys` on an unknown org returned %s, expected nil", res)
+	}
+}
+
+func TestParamSegs(t *testing.T) {
+	res := Ec.ParamSegs("6lkb2cv", "gen")
+	if len(res) != 2 || res[0] != (ParamSeg{ParamVal: "Female", SegId: "dem.g.f"}) || res[1] != (ParamSeg{ParamVal: "Male", SegId: "dem.g.m"}) {
+		t.Errorf("`Ec.ParamSegs` returned %v, expected [{Female dem.g.f} {Male dem.g.m}]", res)
+	}
+	if res := Ec.ParamSegs("nonexistent", "gen"); res != nil {
+		t.Errorf("`Ec.ParamSegs` on an unknown org returned %v, expected nil", res)
+	}
+}
+
+// TestConcurrentLookups is meant to run with `-race`: many goroutines look the same orgs up on a fresh cache,
+// each org must still be parsed once.
+func TestConcurrentLookups(t *testing.T) {
+	data, err := ioutil.ReadFile(DefaultDataFile)
+	if err != nil {
+		t.Fatalf("reading the data file failed with error %s", err)
+	}
+
+	ec := New(data)
+	orgKeys, err := ec.OrgKeys()
+	if err != nil {
+		t.Fatalf("`OrgKeys` failed with error %s", err)
+	}
+
+	expect := make([][]SegmentConfig, len(orgKeys))
+	reference := New(data)
+	for idx, orgKey := range orgKeys {
+		expect[idx] = reference.GetSegmentForOrgAndKeyAndVal(orgKey, "gen", "Female")
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 32; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			for i := 0; i < len(orgKeys); i++ {
+				// Every worker starts from another org, so they run into each other's parses.
+				idx := (worker*7 + i) % len(orgKeys)
+				orgKey := orgKeys[idx]
+
+				if res := ec.GetSegmentForOrgAndKeyAndVal(orgKey, "gen", "Female"); !compareSliceOfSegmentConfig(expect[idx], res) {
+					t.Errorf("`GetSegmentForOrgAndKeyAndVal` of %s returned %s, expected %s", orgKey, res, expect[idx])
+				}
+				ec.GetSegmentsForOrgAndAttributes(orgKey, map[string]string{"gen": "Male", "age": "22"})
+				ec.ParamKeys(orgKey)
+				ec.GetSegmentForOrgAndKey("nonexistent", "gen")
+				if i%40 == 0 {
+					ec.RulesForSegment("intr.edu")
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	if parses := atomic.LoadInt64(&ec.parses); parses != int64(len(orgKeys)) {
+		t.Errorf("%d orgs were parsed, expected each of the %d orgs once", parses, len(orgKeys))
+	}
+}
+
+// TestConcurrentReloads is meant to run with `-race`: lookups run while the cache is reloaded over and over.
+func TestConcurrentReloads(t *testing.T) {
+	datas := [][]byte{[]byte(rulesTestData), []byte(rulesTestDataReloaded)}
+
+	ec := New(datas[0])
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 200; i++ {
+				// Either data, but never a mix of them.
+				switch res := ec.RulesForSegment("intr.edu"); len(res) {
+				case 1, 3:
+				default:
+					t.Errorf("`RulesForSegment` returned %v, expected the rules of either data", res)
+				}
+				ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "gen", "Female")
+				ec.GetSegmentsForOrgAndAttributes("1a9n4ou", map[string]string{"edu": "", "sub": "school"})
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		ec.Reload(datas[i%2])
+	}
+	wg.Wait()
+}
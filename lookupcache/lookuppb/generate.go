@@ -0,0 +1,4 @@
+// Package lookuppb holds the gRPC service definition of segment lookups, see lookup.proto.
+package lookuppb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative lookup.proto
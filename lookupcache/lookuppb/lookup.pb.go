@@ -0,0 +1,682 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        v5.29.3
+// source: lookup.proto
+
+package lookuppb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SegmentConfig struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SegmentConfig) Reset() {
+	*x = SegmentConfig{}
+	mi := &file_lookup_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SegmentConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SegmentConfig) ProtoMessage() {}
+
+func (x *SegmentConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_lookup_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SegmentConfig.ProtoReflect.Descriptor instead.
+func (*SegmentConfig) Descriptor() ([]byte, []int) {
+	return file_lookup_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SegmentConfig) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type GetSegmentForOrgAndKeyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrgKey        string                 `protobuf:"bytes,1,opt,name=org_key,json=orgKey,proto3" json:"org_key,omitempty"`
+	ParamKey      string                 `protobuf:"bytes,2,opt,name=param_key,json=paramKey,proto3" json:"param_key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSegmentForOrgAndKeyRequest) Reset() {
+	*x = GetSegmentForOrgAndKeyRequest{}
+	mi := &file_lookup_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSegmentForOrgAndKeyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSegmentForOrgAndKeyRequest) ProtoMessage() {}
+
+func (x *GetSegmentForOrgAndKeyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lookup_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSegmentForOrgAndKeyRequest.ProtoReflect.Descriptor instead.
+func (*GetSegmentForOrgAndKeyRequest) Descriptor() ([]byte, []int) {
+	return file_lookup_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetSegmentForOrgAndKeyRequest) GetOrgKey() string {
+	if x != nil {
+		return x.OrgKey
+	}
+	return ""
+}
+
+func (x *GetSegmentForOrgAndKeyRequest) GetParamKey() string {
+	if x != nil {
+		return x.ParamKey
+	}
+	return ""
+}
+
+type GetSegmentForOrgAndKeyAndValRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrgKey        string                 `protobuf:"bytes,1,opt,name=org_key,json=orgKey,proto3" json:"org_key,omitempty"`
+	ParamKey      string                 `protobuf:"bytes,2,opt,name=param_key,json=paramKey,proto3" json:"param_key,omitempty"`
+	ParamVal      string                 `protobuf:"bytes,3,opt,name=param_val,json=paramVal,proto3" json:"param_val,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSegmentForOrgAndKeyAndValRequest) Reset() {
+	*x = GetSegmentForOrgAndKeyAndValRequest{}
+	mi := &file_lookup_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSegmentForOrgAndKeyAndValRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSegmentForOrgAndKeyAndValRequest) ProtoMessage() {}
+
+func (x *GetSegmentForOrgAndKeyAndValRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lookup_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSegmentForOrgAndKeyAndValRequest.ProtoReflect.Descriptor instead.
+func (*GetSegmentForOrgAndKeyAndValRequest) Descriptor() ([]byte, []int) {
+	return file_lookup_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetSegmentForOrgAndKeyAndValRequest) GetOrgKey() string {
+	if x != nil {
+		return x.OrgKey
+	}
+	return ""
+}
+
+func (x *GetSegmentForOrgAndKeyAndValRequest) GetParamKey() string {
+	if x != nil {
+		return x.ParamKey
+	}
+	return ""
+}
+
+func (x *GetSegmentForOrgAndKeyAndValRequest) GetParamVal() string {
+	if x != nil {
+		return x.ParamVal
+	}
+	return ""
+}
+
+type SegmentsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Segments      []*SegmentConfig       `protobuf:"bytes,1,rep,name=segments,proto3" json:"segments,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SegmentsResponse) Reset() {
+	*x = SegmentsResponse{}
+	mi := &file_lookup_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SegmentsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SegmentsResponse) ProtoMessage() {}
+
+func (x *SegmentsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lookup_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SegmentsResponse.ProtoReflect.Descriptor instead.
+func (*SegmentsResponse) Descriptor() ([]byte, []int) {
+	return file_lookup_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SegmentsResponse) GetSegments() []*SegmentConfig {
+	if x != nil {
+		return x.Segments
+	}
+	return nil
+}
+
+type Lookup struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	OrgKey   string                 `protobuf:"bytes,1,opt,name=org_key,json=orgKey,proto3" json:"org_key,omitempty"`
+	ParamKey string                 `protobuf:"bytes,2,opt,name=param_key,json=paramKey,proto3" json:"param_key,omitempty"`
+	// An empty value is the same as `GetSegmentForOrgAndKey`.
+	ParamVal      string `protobuf:"bytes,3,opt,name=param_val,json=paramVal,proto3" json:"param_val,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Lookup) Reset() {
+	*x = Lookup{}
+	mi := &file_lookup_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Lookup) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Lookup) ProtoMessage() {}
+
+func (x *Lookup) ProtoReflect() protoreflect.Message {
+	mi := &file_lookup_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Lookup.ProtoReflect.Descriptor instead.
+func (*Lookup) Descriptor() ([]byte, []int) {
+	return file_lookup_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Lookup) GetOrgKey() string {
+	if x != nil {
+		return x.OrgKey
+	}
+	return ""
+}
+
+func (x *Lookup) GetParamKey() string {
+	if x != nil {
+		return x.ParamKey
+	}
+	return ""
+}
+
+func (x *Lookup) GetParamVal() string {
+	if x != nil {
+		return x.ParamVal
+	}
+	return ""
+}
+
+type BatchLookupRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Lookups       []*Lookup              `protobuf:"bytes,1,rep,name=lookups,proto3" json:"lookups,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchLookupRequest) Reset() {
+	*x = BatchLookupRequest{}
+	mi := &file_lookup_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchLookupRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchLookupRequest) ProtoMessage() {}
+
+func (x *BatchLookupRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lookup_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchLookupRequest.ProtoReflect.Descriptor instead.
+func (*BatchLookupRequest) Descriptor() ([]byte, []int) {
+	return file_lookup_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BatchLookupRequest) GetLookups() []*Lookup {
+	if x != nil {
+		return x.Lookups
+	}
+	return nil
+}
+
+type BatchLookupResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// One entry per lookup of the request, in the same order.
+	Results       []*SegmentsResponse `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchLookupResponse) Reset() {
+	*x = BatchLookupResponse{}
+	mi := &file_lookup_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchLookupResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchLookupResponse) ProtoMessage() {}
+
+func (x *BatchLookupResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lookup_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchLookupResponse.ProtoReflect.Descriptor instead.
+func (*BatchLookupResponse) Descriptor() ([]byte, []int) {
+	return file_lookup_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *BatchLookupResponse) GetResults() []*SegmentsResponse {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type WatchOrgRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrgKey        string                 `protobuf:"bytes,1,opt,name=org_key,json=orgKey,proto3" json:"org_key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchOrgRequest) Reset() {
+	*x = WatchOrgRequest{}
+	mi := &file_lookup_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchOrgRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchOrgRequest) ProtoMessage() {}
+
+func (x *WatchOrgRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lookup_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchOrgRequest.ProtoReflect.Descriptor instead.
+func (*WatchOrgRequest) Descriptor() ([]byte, []int) {
+	return file_lookup_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *WatchOrgRequest) GetOrgKey() string {
+	if x != nil {
+		return x.OrgKey
+	}
+	return ""
+}
+
+type Rule struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ParamKey      string                 `protobuf:"bytes,1,opt,name=param_key,json=paramKey,proto3" json:"param_key,omitempty"`
+	ParamVal      string                 `protobuf:"bytes,2,opt,name=param_val,json=paramVal,proto3" json:"param_val,omitempty"`
+	SegmentId     string                 `protobuf:"bytes,3,opt,name=segment_id,json=segmentId,proto3" json:"segment_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Rule) Reset() {
+	*x = Rule{}
+	mi := &file_lookup_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Rule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Rule) ProtoMessage() {}
+
+func (x *Rule) ProtoReflect() protoreflect.Message {
+	mi := &file_lookup_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Rule.ProtoReflect.Descriptor instead.
+func (*Rule) Descriptor() ([]byte, []int) {
+	return file_lookup_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Rule) GetParamKey() string {
+	if x != nil {
+		return x.ParamKey
+	}
+	return ""
+}
+
+func (x *Rule) GetParamVal() string {
+	if x != nil {
+		return x.ParamVal
+	}
+	return ""
+}
+
+func (x *Rule) GetSegmentId() string {
+	if x != nil {
+		return x.SegmentId
+	}
+	return ""
+}
+
+type OrgUpdate struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	OrgKey string                 `protobuf:"bytes,1,opt,name=org_key,json=orgKey,proto3" json:"org_key,omitempty"`
+	// Counts the reloads of the data on the server, the first update of a watch carries the current one.
+	Generation uint64 `protobuf:"varint,2,opt,name=generation,proto3" json:"generation,omitempty"`
+	// False if the org is not in the data, `rules` is empty then.
+	Found bool `protobuf:"varint,3,opt,name=found,proto3" json:"found,omitempty"`
+	// All the rules of the org.
+	Rules []*Rule `protobuf:"bytes,4,rep,name=rules,proto3" json:"rules,omitempty"`
+	// The rules which appeared and disappeared since the previous update of this watch,
+	// for the first update `added` holds all the rules.
+	Added         []*Rule `protobuf:"bytes,5,rep,name=added,proto3" json:"added,omitempty"`
+	Removed       []*Rule `protobuf:"bytes,6,rep,name=removed,proto3" json:"removed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OrgUpdate) Reset() {
+	*x = OrgUpdate{}
+	mi := &file_lookup_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OrgUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrgUpdate) ProtoMessage() {}
+
+func (x *OrgUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_lookup_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrgUpdate.ProtoReflect.Descriptor instead.
+func (*OrgUpdate) Descriptor() ([]byte, []int) {
+	return file_lookup_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *OrgUpdate) GetOrgKey() string {
+	if x != nil {
+		return x.OrgKey
+	}
+	return ""
+}
+
+func (x *OrgUpdate) GetGeneration() uint64 {
+	if x != nil {
+		return x.Generation
+	}
+	return 0
+}
+
+func (x *OrgUpdate) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *OrgUpdate) GetRules() []*Rule {
+	if x != nil {
+		return x.Rules
+	}
+	return nil
+}
+
+func (x *OrgUpdate) GetAdded() []*Rule {
+	if x != nil {
+		return x.Added
+	}
+	return nil
+}
+
+func (x *OrgUpdate) GetRemoved() []*Rule {
+	if x != nil {
+		return x.Removed
+	}
+	return nil
+}
+
+var File_lookup_proto protoreflect.FileDescriptor
+
+const file_lookup_proto_rawDesc = "" +
+	"\n" +
+	"\flookup.proto\x12\x0elookupcache.v1\"\x1f\n" +
+	"\rSegmentConfig\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"U\n" +
+	"\x1dGetSegmentForOrgAndKeyRequest\x12\x17\n" +
+	"\aorg_key\x18\x01 \x01(\tR\x06orgKey\x12\x1b\n" +
+	"\tparam_key\x18\x02 \x01(\tR\bparamKey\"x\n" +
+	"#GetSegmentForOrgAndKeyAndValRequest\x12\x17\n" +
+	"\aorg_key\x18\x01 \x01(\tR\x06orgKey\x12\x1b\n" +
+	"\tparam_key\x18\x02 \x01(\tR\bparamKey\x12\x1b\n" +
+	"\tparam_val\x18\x03 \x01(\tR\bparamVal\"M\n" +
+	"\x10SegmentsResponse\x129\n" +
+	"\bsegments\x18\x01 \x03(\v2\x1d.lookupcache.v1.SegmentConfigR\bsegments\"[\n" +
+	"\x06Lookup\x12\x17\n" +
+	"\aorg_key\x18\x01 \x01(\tR\x06orgKey\x12\x1b\n" +
+	"\tparam_key\x18\x02 \x01(\tR\bparamKey\x12\x1b\n" +
+	"\tparam_val\x18\x03 \x01(\tR\bparamVal\"F\n" +
+	"\x12BatchLookupRequest\x120\n" +
+	"\alookups\x18\x01 \x03(\v2\x16.lookupcache.v1.LookupR\alookups\"Q\n" +
+	"\x13BatchLookupResponse\x12:\n" +
+	"\aresults\x18\x01 \x03(\v2 .lookupcache.v1.SegmentsResponseR\aresults\"*\n" +
+	"\x0fWatchOrgRequest\x12\x17\n" +
+	"\aorg_key\x18\x01 \x01(\tR\x06orgKey\"_\n" +
+	"\x04Rule\x12\x1b\n" +
+	"\tparam_key\x18\x01 \x01(\tR\bparamKey\x12\x1b\n" +
+	"\tparam_val\x18\x02 \x01(\tR\bparamVal\x12\x1d\n" +
+	"\n" +
+	"segment_id\x18\x03 \x01(\tR\tsegmentId\"\xe2\x01\n" +
+	"\tOrgUpdate\x12\x17\n" +
+	"\aorg_key\x18\x01 \x01(\tR\x06orgKey\x12\x1e\n" +
+	"\n" +
+	"generation\x18\x02 \x01(\x04R\n" +
+	"generation\x12\x14\n" +
+	"\x05found\x18\x03 \x01(\bR\x05found\x12*\n" +
+	"\x05rules\x18\x04 \x03(\v2\x14.lookupcache.v1.RuleR\x05rules\x12*\n" +
+	"\x05added\x18\x05 \x03(\v2\x14.lookupcache.v1.RuleR\x05added\x12.\n" +
+	"\aremoved\x18\x06 \x03(\v2\x14.lookupcache.v1.RuleR\aremoved2\x93\x03\n" +
+	"\rSegmentLookup\x12i\n" +
+	"\x16GetSegmentForOrgAndKey\x12-.lookupcache.v1.GetSegmentForOrgAndKeyRequest\x1a .lookupcache.v1.SegmentsResponse\x12u\n" +
+	"\x1cGetSegmentForOrgAndKeyAndVal\x123.lookupcache.v1.GetSegmentForOrgAndKeyAndValRequest\x1a .lookupcache.v1.SegmentsResponse\x12V\n" +
+	"\vBatchLookup\x12\".lookupcache.v1.BatchLookupRequest\x1a#.lookupcache.v1.BatchLookupResponse\x12H\n" +
+	"\bWatchOrg\x12\x1f.lookupcache.v1.WatchOrgRequest\x1a\x19.lookupcache.v1.OrgUpdate0\x01B3Z1github.com/lnshi/json-lookup/lookupcache/lookuppbb\x06proto3"
+
+var (
+	file_lookup_proto_rawDescOnce sync.Once
+	file_lookup_proto_rawDescData []byte
+)
+
+func file_lookup_proto_rawDescGZIP() []byte {
+	file_lookup_proto_rawDescOnce.Do(func() {
+		file_lookup_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_lookup_proto_rawDesc), len(file_lookup_proto_rawDesc)))
+	})
+	return file_lookup_proto_rawDescData
+}
+
+var file_lookup_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_lookup_proto_goTypes = []any{
+	(*SegmentConfig)(nil),                       // 0: lookupcache.v1.SegmentConfig
+	(*GetSegmentForOrgAndKeyRequest)(nil),       // 1: lookupcache.v1.GetSegmentForOrgAndKeyRequest
+	(*GetSegmentForOrgAndKeyAndValRequest)(nil), // 2: lookupcache.v1.GetSegmentForOrgAndKeyAndValRequest
+	(*SegmentsResponse)(nil),                    // 3: lookupcache.v1.SegmentsResponse
+	(*Lookup)(nil),                              // 4: lookupcache.v1.Lookup
+	(*BatchLookupRequest)(nil),                  // 5: lookupcache.v1.BatchLookupRequest
+	(*BatchLookupResponse)(nil),                 // 6: lookupcache.v1.BatchLookupResponse
+	(*WatchOrgRequest)(nil),                     // 7: lookupcache.v1.WatchOrgRequest
+	(*Rule)(nil),                                // 8: lookupcache.v1.Rule
+	(*OrgUpdate)(nil),                           // 9: lookupcache.v1.OrgUpdate
+}
+var file_lookup_proto_depIdxs = []int32{
+	0,  // 0: lookupcache.v1.SegmentsResponse.segments:type_name -> lookupcache.v1.SegmentConfig
+	4,  // 1: lookupcache.v1.BatchLookupRequest.lookups:type_name -> lookupcache.v1.Lookup
+	3,  // 2: lookupcache.v1.BatchLookupResponse.results:type_name -> lookupcache.v1.SegmentsResponse
+	8,  // 3: lookupcache.v1.OrgUpdate.rules:type_name -> lookupcache.v1.Rule
+	8,  // 4: lookupcache.v1.OrgUpdate.added:type_name -> lookupcache.v1.Rule
+	8,  // 5: lookupcache.v1.OrgUpdate.removed:type_name -> lookupcache.v1.Rule
+	1,  // 6: lookupcache.v1.SegmentLookup.GetSegmentForOrgAndKey:input_type -> lookupcache.v1.GetSegmentForOrgAndKeyRequest
+	2,  // 7: lookupcache.v1.SegmentLookup.GetSegmentForOrgAndKeyAndVal:input_type -> lookupcache.v1.GetSegmentForOrgAndKeyAndValRequest
+	5,  // 8: lookupcache.v1.SegmentLookup.BatchLookup:input_type -> lookupcache.v1.BatchLookupRequest
+	7,  // 9: lookupcache.v1.SegmentLookup.WatchOrg:input_type -> lookupcache.v1.WatchOrgRequest
+	3,  // 10: lookupcache.v1.SegmentLookup.GetSegmentForOrgAndKey:output_type -> lookupcache.v1.SegmentsResponse
+	3,  // 11: lookupcache.v1.SegmentLookup.GetSegmentForOrgAndKeyAndVal:output_type -> lookupcache.v1.SegmentsResponse
+	6,  // 12: lookupcache.v1.SegmentLookup.BatchLookup:output_type -> lookupcache.v1.BatchLookupResponse
+	9,  // 13: lookupcache.v1.SegmentLookup.WatchOrg:output_type -> lookupcache.v1.OrgUpdate
+	10, // [10:14] is the sub-list for method output_type
+	6,  // [6:10] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_lookup_proto_init() }
+func file_lookup_proto_init() {
+	if File_lookup_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_lookup_proto_rawDesc), len(file_lookup_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_lookup_proto_goTypes,
+		DependencyIndexes: file_lookup_proto_depIdxs,
+		MessageInfos:      file_lookup_proto_msgTypes,
+	}.Build()
+	File_lookup_proto = out.File
+	file_lookup_proto_goTypes = nil
+	file_lookup_proto_depIdxs = nil
+}
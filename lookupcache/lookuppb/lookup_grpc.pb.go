@@ -0,0 +1,251 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: lookup.proto
+
+package lookuppb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SegmentLookup_GetSegmentForOrgAndKey_FullMethodName       = "/lookupcache.v1.SegmentLookup/GetSegmentForOrgAndKey"
+	SegmentLookup_GetSegmentForOrgAndKeyAndVal_FullMethodName = "/lookupcache.v1.SegmentLookup/GetSegmentForOrgAndKeyAndVal"
+	SegmentLookup_BatchLookup_FullMethodName                  = "/lookupcache.v1.SegmentLookup/BatchLookup"
+	SegmentLookup_WatchOrg_FullMethodName                     = "/lookupcache.v1.SegmentLookup/WatchOrg"
+)
+
+// SegmentLookupClient is the client API for SegmentLookup service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// SegmentLookup serves the `LookupCache` interface remotely.
+type SegmentLookupClient interface {
+	// Same as `LookupCache.GetSegmentForOrgAndKey`.
+	GetSegmentForOrgAndKey(ctx context.Context, in *GetSegmentForOrgAndKeyRequest, opts ...grpc.CallOption) (*SegmentsResponse, error)
+	// Same as `LookupCache.GetSegmentForOrgAndKeyAndVal`.
+	GetSegmentForOrgAndKeyAndVal(ctx context.Context, in *GetSegmentForOrgAndKeyAndValRequest, opts ...grpc.CallOption) (*SegmentsResponse, error)
+	// Looks up many (org, key, val) triples in one round trip, the results are in the order of the lookups.
+	BatchLookup(ctx context.Context, in *BatchLookupRequest, opts ...grpc.CallOption) (*BatchLookupResponse, error)
+	// Sends the rules of one org right away, then again after every reload of the data which changed them.
+	WatchOrg(ctx context.Context, in *WatchOrgRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[OrgUpdate], error)
+}
+
+type segmentLookupClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSegmentLookupClient(cc grpc.ClientConnInterface) SegmentLookupClient {
+	return &segmentLookupClient{cc}
+}
+
+func (c *segmentLookupClient) GetSegmentForOrgAndKey(ctx context.Context, in *GetSegmentForOrgAndKeyRequest, opts ...grpc.CallOption) (*SegmentsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SegmentsResponse)
+	err := c.cc.Invoke(ctx, SegmentLookup_GetSegmentForOrgAndKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentLookupClient) GetSegmentForOrgAndKeyAndVal(ctx context.Context, in *GetSegmentForOrgAndKeyAndValRequest, opts ...grpc.CallOption) (*SegmentsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SegmentsResponse)
+	err := c.cc.Invoke(ctx, SegmentLookup_GetSegmentForOrgAndKeyAndVal_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentLookupClient) BatchLookup(ctx context.Context, in *BatchLookupRequest, opts ...grpc.CallOption) (*BatchLookupResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchLookupResponse)
+	err := c.cc.Invoke(ctx, SegmentLookup_BatchLookup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentLookupClient) WatchOrg(ctx context.Context, in *WatchOrgRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[OrgUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SegmentLookup_ServiceDesc.Streams[0], SegmentLookup_WatchOrg_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchOrgRequest, OrgUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SegmentLookup_WatchOrgClient = grpc.ServerStreamingClient[OrgUpdate]
+
+// SegmentLookupServer is the server API for SegmentLookup service.
+// All implementations must embed UnimplementedSegmentLookupServer
+// for forward compatibility.
+//
+// SegmentLookup serves the `LookupCache` interface remotely.
+type SegmentLookupServer interface {
+	// Same as `LookupCache.GetSegmentForOrgAndKey`.
+	GetSegmentForOrgAndKey(context.Context, *GetSegmentForOrgAndKeyRequest) (*SegmentsResponse, error)
+	// Same as `LookupCache.GetSegmentForOrgAndKeyAndVal`.
+	GetSegmentForOrgAndKeyAndVal(context.Context, *GetSegmentForOrgAndKeyAndValRequest) (*SegmentsResponse, error)
+	// Looks up many (org, key, val) triples in one round trip, the results are in the order of the lookups.
+	BatchLookup(context.Context, *BatchLookupRequest) (*BatchLookupResponse, error)
+	// Sends the rules of one org right away, then again after every reload of the data which changed them.
+	WatchOrg(*WatchOrgRequest, grpc.ServerStreamingServer[OrgUpdate]) error
+	mustEmbedUnimplementedSegmentLookupServer()
+}
+
+// UnimplementedSegmentLookupServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSegmentLookupServer struct{}
+
+func (UnimplementedSegmentLookupServer) GetSegmentForOrgAndKey(context.Context, *GetSegmentForOrgAndKeyRequest) (*SegmentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSegmentForOrgAndKey not implemented")
+}
+func (UnimplementedSegmentLookupServer) GetSegmentForOrgAndKeyAndVal(context.Context, *GetSegmentForOrgAndKeyAndValRequest) (*SegmentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSegmentForOrgAndKeyAndVal not implemented")
+}
+func (UnimplementedSegmentLookupServer) BatchLookup(context.Context, *BatchLookupRequest) (*BatchLookupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchLookup not implemented")
+}
+func (UnimplementedSegmentLookupServer) WatchOrg(*WatchOrgRequest, grpc.ServerStreamingServer[OrgUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchOrg not implemented")
+}
+func (UnimplementedSegmentLookupServer) mustEmbedUnimplementedSegmentLookupServer() {}
+func (UnimplementedSegmentLookupServer) testEmbeddedByValue()                       {}
+
+// UnsafeSegmentLookupServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SegmentLookupServer will
+// result in compilation errors.
+type UnsafeSegmentLookupServer interface {
+	mustEmbedUnimplementedSegmentLookupServer()
+}
+
+func RegisterSegmentLookupServer(s grpc.ServiceRegistrar, srv SegmentLookupServer) {
+	// If the following call pancis, it indicates UnimplementedSegmentLookupServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SegmentLookup_ServiceDesc, srv)
+}
+
+func _SegmentLookup_GetSegmentForOrgAndKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSegmentForOrgAndKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentLookupServer).GetSegmentForOrgAndKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentLookup_GetSegmentForOrgAndKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentLookupServer).GetSegmentForOrgAndKey(ctx, req.(*GetSegmentForOrgAndKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentLookup_GetSegmentForOrgAndKeyAndVal_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSegmentForOrgAndKeyAndValRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentLookupServer).GetSegmentForOrgAndKeyAndVal(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentLookup_GetSegmentForOrgAndKeyAndVal_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentLookupServer).GetSegmentForOrgAndKeyAndVal(ctx, req.(*GetSegmentForOrgAndKeyAndValRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentLookup_BatchLookup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchLookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentLookupServer).BatchLookup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentLookup_BatchLookup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentLookupServer).BatchLookup(ctx, req.(*BatchLookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentLookup_WatchOrg_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchOrgRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SegmentLookupServer).WatchOrg(m, &grpc.GenericServerStream[WatchOrgRequest, OrgUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SegmentLookup_WatchOrgServer = grpc.ServerStreamingServer[OrgUpdate]
+
+// SegmentLookup_ServiceDesc is the grpc.ServiceDesc for SegmentLookup service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SegmentLookup_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "lookupcache.v1.SegmentLookup",
+	HandlerType: (*SegmentLookupServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetSegmentForOrgAndKey",
+			Handler:    _SegmentLookup_GetSegmentForOrgAndKey_Handler,
+		},
+		{
+			MethodName: "GetSegmentForOrgAndKeyAndVal",
+			Handler:    _SegmentLookup_GetSegmentForOrgAndKeyAndVal_Handler,
+		},
+		{
+			MethodName: "BatchLookup",
+			Handler:    _SegmentLookup_BatchLookup_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchOrg",
+			Handler:       _SegmentLookup_WatchOrg_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "lookup.proto",
+}
@@ -0,0 +1,113 @@
+package lookuprpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/lnshi/json-lookup/lookupcache"
+	"github.com/lnshi/json-lookup/lookupcache/lookuppb"
+)
+
+// Lookup is one (org, key, val) triple of a `BatchLookup`.
+type Lookup struct {
+	OrgKey   string
+	ParamKey string
+	ParamVal string
+}
+
+// Client looks segments up on a remote `Server`. It implements `lookupcache.LookupCache`,
+// so it can be used wherever a local cache is.
+type Client struct {
+	rpc lookuppb.SegmentLookupClient
+
+	// Timeout bounds each call made through the `LookupCache` methods, 0 means no bound.
+	Timeout time.Duration
+
+	// OnError, if set, is called with the error of every failed call made through the `LookupCache` methods,
+	// which can only report it as finding nothing.
+	OnError func(err error)
+}
+
+var _ lookupcache.LookupCache = (*Client)(nil)
+
+// NewClient returns a client calling the server on the other end of `conn`.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{
+		rpc: lookuppb.NewSegmentLookupClient(conn),
+	}
+}
+
+func (c *Client) GetSegmentForOrgAndKey(orgKey string, paramKey string) []lookupcache.SegmentConfig {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	res, err := c.rpc.GetSegmentForOrgAndKey(ctx, &lookuppb.GetSegmentForOrgAndKeyRequest{OrgKey: orgKey, ParamKey: paramKey})
+	if err != nil {
+		c.failed(err)
+		return []lookupcache.SegmentConfig{}
+	}
+	return fromSegmentsResponse(res)
+}
+
+func (c *Client) GetSegmentForOrgAndKeyAndVal(orgKey string, paramKey string, paramVal string) []lookupcache.SegmentConfig {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	res, err := c.rpc.GetSegmentForOrgAndKeyAndVal(ctx, &lookuppb.GetSegmentForOrgAndKeyAndValRequest{OrgKey: orgKey, ParamKey: paramKey, ParamVal: paramVal})
+	if err != nil {
+		c.failed(err)
+		return []lookupcache.SegmentConfig{}
+	}
+	return fromSegmentsResponse(res)
+}
+
+// BatchLookup looks all of `lookups` up in one round trip, the results are in the order of `lookups`.
+func (c *Client) BatchLookup(ctx context.Context, lookups []Lookup) ([][]lookupcache.SegmentConfig, error) {
+	req := &lookuppb.BatchLookupRequest{
+		Lookups: make([]*lookuppb.Lookup, 0, len(lookups)),
+	}
+	for _, l := range lookups {
+		req.Lookups = append(req.Lookups, &lookuppb.Lookup{OrgKey: l.OrgKey, ParamKey: l.ParamKey, ParamVal: l.ParamVal})
+	}
+
+	res, err := c.rpc.BatchLookup(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	segs := make([][]lookupcache.SegmentConfig, 0, len(res.GetResults()))
+	for _, r := range res.GetResults() {
+		segs = append(segs, fromSegmentsResponse(r))
+	}
+	return segs, nil
+}
+
+// WatchOrg opens a stream of the updates of `orgKey`, it lasts until `ctx` is done.
+func (c *Client) WatchOrg(ctx context.Context, orgKey string) (lookuppb.SegmentLookup_WatchOrgClient, error) {
+	return c.rpc.WatchOrg(ctx, &lookuppb.WatchOrgRequest{OrgKey: orgKey})
+}
+
+// Add non-exported stuffs below.
+
+func (c *Client) context() (context.Context, context.CancelFunc) {
+	if c.Timeout > 0 {
+		return context.WithTimeout(context.Background(), c.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func (c *Client) failed(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	}
+}
+
+func fromSegmentsResponse(res *lookuppb.SegmentsResponse) []lookupcache.SegmentConfig {
+	segs := make([]lookupcache.SegmentConfig, 0, len(res.GetSegments()))
+	for _, seg := range res.GetSegments() {
+		segs = append(segs, lookupcache.SegmentConfig{Id: seg.GetId()})
+	}
+	return segs
+}
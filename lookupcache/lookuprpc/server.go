@@ -0,0 +1,229 @@
+// Package lookuprpc serves segment lookups over gRPC and provides a client which implements
+// `lookupcache.LookupCache`, so callers can swap a local cache for a remote one.
+package lookuprpc
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lnshi/json-lookup/lookupcache"
+	"github.com/lnshi/json-lookup/lookupcache/lookuppb"
+)
+
+// MaxBatchSize is the most lookups a single `BatchLookup` call may carry.
+const MaxBatchSize = 10000
+
+// Server serves the lookups of a `*lookupcache.Cache`, `SetCache` swaps in a reloaded one.
+type Server struct {
+	lookuppb.UnimplementedSegmentLookupServer
+
+	lock       sync.RWMutex
+	cache      *lookupcache.Cache
+	generation uint64
+	watchers   map[chan struct{}]struct{}
+}
+
+// NewServer returns a server over `cache`, which may be nil while the data is still being loaded,
+// lookups fail with `codes.Unavailable` until `SetCache` is called then.
+func NewServer(cache *lookupcache.Cache) *Server {
+	return &Server{
+		cache:    cache,
+		watchers: make(map[chan struct{}]struct{}),
+	}
+}
+
+// SetCache makes the server serve `cache` from now on and has every `WatchOrg` stream
+// push the changes of its org.
+func (s *Server) SetCache(cache *lookupcache.Cache) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.cache = cache
+	s.generation++
+
+	for notify := range s.watchers {
+		// A pending notification already covers this reload.
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *Server) GetSegmentForOrgAndKey(ctx context.Context, req *lookuppb.GetSegmentForOrgAndKeyRequest) (*lookuppb.SegmentsResponse, error) {
+	cache, _ := s.current()
+	if cache == nil {
+		return nil, errNotLoaded
+	}
+	return toSegmentsResponse(cache.GetSegmentForOrgAndKey(req.GetOrgKey(), req.GetParamKey())), nil
+}
+
+func (s *Server) GetSegmentForOrgAndKeyAndVal(ctx context.Context, req *lookuppb.GetSegmentForOrgAndKeyAndValRequest) (*lookuppb.SegmentsResponse, error) {
+	cache, _ := s.current()
+	if cache == nil {
+		return nil, errNotLoaded
+	}
+	return toSegmentsResponse(cache.GetSegmentForOrgAndKeyAndVal(req.GetOrgKey(), req.GetParamKey(), req.GetParamVal())), nil
+}
+
+// BatchLookup runs all the lookups against the same data, even if a reload happens meanwhile.
+func (s *Server) BatchLookup(ctx context.Context, req *lookuppb.BatchLookupRequest) (*lookuppb.BatchLookupResponse, error) {
+	if len(req.GetLookups()) > MaxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d lookups per batch, got %d", MaxBatchSize, len(req.GetLookups()))
+	}
+
+	cache, _ := s.current()
+	if cache == nil {
+		return nil, errNotLoaded
+	}
+
+	res := &lookuppb.BatchLookupResponse{
+		Results: make([]*lookuppb.SegmentsResponse, 0, len(req.GetLookups())),
+	}
+	for _, l := range req.GetLookups() {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		res.Results = append(res.Results, toSegmentsResponse(cache.GetSegmentForOrgAndKeyAndVal(l.GetOrgKey(), l.GetParamKey(), l.GetParamVal())))
+	}
+
+	return res, nil
+}
+
+// WatchOrg sends the rules of the org as soon as the data is loaded, then once per `SetCache` which changed them.
+// Updates of quick successive reloads may be merged into one.
+func (s *Server) WatchOrg(req *lookuppb.WatchOrgRequest, stream lookuppb.SegmentLookup_WatchOrgServer) error {
+	orgKey := req.GetOrgKey()
+	if orgKey == "" {
+		return status.Error(codes.InvalidArgument, "org_key is required")
+	}
+
+	notify := make(chan struct{}, 1)
+	s.lock.Lock()
+	s.watchers[notify] = struct{}{}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.watchers, notify)
+		s.lock.Unlock()
+	}()
+
+	var (
+		sent bool
+		prev map[ruleKey]int
+	)
+
+	// The first pass with loaded data always sends, the following ones only if the rules changed.
+	for {
+		if cache, generation := s.current(); cache != nil {
+			rules, found := orgRules(cache, orgKey)
+			curr := countRules(rules)
+
+			added, removed := diffRules(prev, curr)
+			if !sent || len(added) > 0 || len(removed) > 0 {
+				err := stream.Send(&lookuppb.OrgUpdate{
+					OrgKey:     orgKey,
+					Generation: generation,
+					Found:      found,
+					Rules:      rules,
+					Added:      added,
+					Removed:    removed,
+				})
+				if err != nil {
+					return err
+				}
+				sent, prev = true, curr
+			}
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-notify:
+		}
+	}
+}
+
+// Add non-exported stuffs below.
+
+var errNotLoaded = status.Error(codes.Unavailable, "segment data is not loaded yet")
+
+func (s *Server) current() (*lookupcache.Cache, uint64) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.cache, s.generation
+}
+
+func toSegmentsResponse(segs []lookupcache.SegmentConfig) *lookuppb.SegmentsResponse {
+	res := &lookuppb.SegmentsResponse{
+		Segments: make([]*lookuppb.SegmentConfig, 0, len(segs)),
+	}
+	for _, seg := range segs {
+		res.Segments = append(res.Segments, &lookuppb.SegmentConfig{Id: seg.Id})
+	}
+	return res
+}
+
+type ruleKey struct {
+	paramKey, paramVal, segId string
+}
+
+func orgRules(cache *lookupcache.Cache, orgKey string) ([]*lookuppb.Rule, bool) {
+	paramKeys := cache.ParamKeys(orgKey)
+	if paramKeys == nil {
+		return nil, false
+	}
+
+	rules := make([]*lookuppb.Rule, 0)
+	for _, paramKey := range paramKeys {
+		for _, paramSeg := range cache.ParamSegs(orgKey, paramKey) {
+			rules = append(rules, &lookuppb.Rule{ParamKey: paramKey, ParamVal: paramSeg.ParamVal, SegmentId: paramSeg.SegId})
+		}
+	}
+	return rules, true
+}
+
+// countRules keeps count of every rule, the same rule may be listed more than once in the data.
+func countRules(rules []*lookuppb.Rule) map[ruleKey]int {
+	res := make(map[ruleKey]int, len(rules))
+	for _, rule := range rules {
+		res[ruleKey{rule.GetParamKey(), rule.GetParamVal(), rule.GetSegmentId()}]++
+	}
+	return res
+}
+
+func diffRules(prev, curr map[ruleKey]int) (added, removed []*lookuppb.Rule) {
+	for key, n := range curr {
+		for ; n > prev[key]; n-- {
+			added = append(added, &lookuppb.Rule{ParamKey: key.paramKey, ParamVal: key.paramVal, SegmentId: key.segId})
+		}
+	}
+	for key, n := range prev {
+		for ; n > curr[key]; n-- {
+			removed = append(removed, &lookuppb.Rule{ParamKey: key.paramKey, ParamVal: key.paramVal, SegmentId: key.segId})
+		}
+	}
+	sortRules(added)
+	sortRules(removed)
+	return added, removed
+}
+
+// sortRules orders map-built rule lists, so updates are deterministic.
+func sortRules(rules []*lookuppb.Rule) {
+	sort.Slice(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		if a.GetParamKey() != b.GetParamKey() {
+			return a.GetParamKey() < b.GetParamKey()
+		}
+		if a.GetParamVal() != b.GetParamVal() {
+			return a.GetParamVal() < b.GetParamVal()
+		}
+		return a.GetSegmentId() < b.GetSegmentId()
+	})
+}
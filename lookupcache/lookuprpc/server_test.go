@@ -0,0 +1,201 @@
+package lookuprpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/lnshi/json-lookup/lookupcache"
+	"github.com/lnshi/json-lookup/lookupcache/lookuppb"
+)
+
+const testData = `[
+  {"6lkb2cv": [
+    {"gen": [{"Female": {"segmentId": "dem.g.f"}}, {"Male": {"segmentId": "dem.g.m"}}]},
+    {"sid": [{"": {"segmentId": "dem.life.expat"}}]}
+  ]},
+  {"1a9n4ou": [
+    {"age": [{"18\n19\n20": {"segmentId": "dem.ag.18-20"}}]}
+  ]}
+]`
+
+const testDataReloaded = `[
+  {"6lkb2cv": [
+    {"gen": [{"Female": {"segmentId": "dem.g.female"}}, {"Male": {"segmentId": "dem.g.m"}}]},
+    {"sid": [{"": {"segmentId": "dem.life.expat"}}]}
+  ]},
+  {"1a9n4ou": [
+    {"age": [{"18\n19\n20": {"segmentId": "dem.ag.18-20"}}, {"21\n22": {"segmentId": "dem.ag.21-22"}}]}
+  ]}
+]`
+
+func startServer(t *testing.T, s *Server) *Client {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	lookuppb.RegisterSegmentLookupServer(srv, s)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc.NewClient failed with error %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return NewClient(conn)
+}
+
+func compareSliceOfSegmentConfig(a, b []lookupcache.SegmentConfig) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx].Id != b[idx].Id {
+			return false
+		}
+	}
+	return true
+}
+
+func TestClientIsLookupCache(t *testing.T) {
+	var errs []error
+
+	client := startServer(t, NewServer(lookupcache.New([]byte(testData))))
+	client.Timeout = time.Second
+	client.OnError = func(err error) { errs = append(errs, err) }
+
+	var cache lookupcache.LookupCache = client
+
+	if res := cache.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "gen", "Male"); !compareSliceOfSegmentConfig(res, []lookupcache.SegmentConfig{{Id: "dem.g.m"}}) {
+		t.Errorf("GetSegmentForOrgAndKeyAndVal returned %v, expected [{dem.g.m}]", res)
+	}
+	if res := cache.GetSegmentForOrgAndKey("6lkb2cv", "sid"); !compareSliceOfSegmentConfig(res, []lookupcache.SegmentConfig{{Id: "dem.life.expat"}}) {
+		t.Errorf("GetSegmentForOrgAndKey returned %v, expected [{dem.life.expat}]", res)
+	}
+	if res := cache.GetSegmentForOrgAndKey("nonexistent", "sid"); res == nil || len(res) != 0 {
+		t.Errorf("GetSegmentForOrgAndKey on an unknown org returned %#v, expected an empty slice", res)
+	}
+	if len(errs) != 0 {
+		t.Errorf("lookups reported errors %v", errs)
+	}
+}
+
+func TestNotLoaded(t *testing.T) {
+	var errs []error
+
+	client := startServer(t, NewServer(nil))
+	client.OnError = func(err error) { errs = append(errs, err) }
+
+	if res := client.GetSegmentForOrgAndKey("6lkb2cv", "sid"); res == nil || len(res) != 0 {
+		t.Errorf("GetSegmentForOrgAndKey before loading returned %#v, expected an empty slice", res)
+	}
+	if len(errs) != 1 || status.Code(errs[0]) != codes.Unavailable {
+		t.Errorf("GetSegmentForOrgAndKey before loading reported %v, expected one Unavailable error", errs)
+	}
+}
+
+func TestBatchLookup(t *testing.T) {
+	client := startServer(t, NewServer(lookupcache.New([]byte(testData))))
+
+	res, err := client.BatchLookup(context.Background(), []Lookup{
+		{OrgKey: "6lkb2cv", ParamKey: "gen", ParamVal: "Female"},
+		{OrgKey: "nonexistent", ParamKey: "gen", ParamVal: "Female"},
+		{OrgKey: "1a9n4ou", ParamKey: "age", ParamVal: "19"},
+		{OrgKey: "6lkb2cv", ParamKey: "sid"},
+	})
+	if err != nil {
+		t.Fatalf("BatchLookup failed with error %s", err)
+	}
+
+	expect := [][]lookupcache.SegmentConfig{
+		{{Id: "dem.g.f"}},
+		{},
+		{{Id: "dem.ag.18-20"}},
+		{{Id: "dem.life.expat"}},
+	}
+	if len(res) != len(expect) {
+		t.Fatalf("BatchLookup returned %d results, expected %d", len(res), len(expect))
+	}
+	for idx := range expect {
+		if !compareSliceOfSegmentConfig(res[idx], expect[idx]) {
+			t.Errorf("BatchLookup result %d is %v, expected %v", idx, res[idx], expect[idx])
+		}
+	}
+
+	if _, err := client.BatchLookup(context.Background(), make([]Lookup, MaxBatchSize+1)); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("BatchLookup with too many lookups returned error %v, expected InvalidArgument", err)
+	}
+}
+
+func TestWatchOrg(t *testing.T) {
+	s := NewServer(nil)
+	client := startServer(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchOrg(ctx, "1a9n4ou")
+	if err != nil {
+		t.Fatalf("WatchOrg failed with error %s", err)
+	}
+
+	// Nothing is sent before the data is loaded.
+	s.SetCache(lookupcache.New([]byte(testData)))
+
+	update, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("receiving the first update failed with error %s", err)
+	}
+	if !update.GetFound() || update.GetGeneration() != 1 || len(update.GetRules()) != 1 || len(update.GetAdded()) != 1 || len(update.GetRemoved()) != 0 {
+		t.Errorf("first update is %v, expected generation 1 with the one rule added", update)
+	}
+
+	// Nothing changed for the org, so no update until the next reload which changes it.
+	s.SetCache(lookupcache.New([]byte(testData)))
+	s.SetCache(lookupcache.New([]byte(testDataReloaded)))
+
+	update, err = stream.Recv()
+	if err != nil {
+		t.Fatalf("receiving the second update failed with error %s", err)
+	}
+	if update.GetGeneration() != 3 || len(update.GetRules()) != 2 || len(update.GetRemoved()) != 0 ||
+		len(update.GetAdded()) != 1 || update.GetAdded()[0].GetSegmentId() != "dem.ag.21-22" || update.GetAdded()[0].GetParamKey() != "age" {
+		t.Errorf("second update is %v, expected generation 3 with dem.ag.21-22 added", update)
+	}
+
+	s.SetCache(lookupcache.New([]byte(`[]`)))
+
+	update, err = stream.Recv()
+	if err != nil {
+		t.Fatalf("receiving the third update failed with error %s", err)
+	}
+	if update.GetFound() || len(update.GetRules()) != 0 || len(update.GetRemoved()) != 2 {
+		t.Errorf("third update is %v, expected the org not found with its two rules removed", update)
+	}
+}
+
+func TestWatchOrgRequiresOrgKey(t *testing.T) {
+	client := startServer(t, NewServer(lookupcache.New([]byte(testData))))
+
+	stream, err := client.WatchOrg(context.Background(), "")
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("WatchOrg without an org key returned error %v, expected InvalidArgument", err)
+	}
+}
@@ -0,0 +1,221 @@
+package lookupcache
+
+import (
+	"container/list"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/lnshi/json-lookup/tool/json"
+)
+
+// Matcher decides whether a rule of the data file applies to the value being looked up.
+// `ruleVal` is the value of the rule as written in the data file, escapes not decoded, e.g. `18\n19\n20`.
+type Matcher interface {
+	Match(ruleVal string, paramVal string) bool
+}
+
+// MatcherFunc adapts a plain function to `Matcher`.
+type MatcherFunc func(ruleVal string, paramVal string) bool
+
+func (f MatcherFunc) Match(ruleVal string, paramVal string) bool {
+	return f(ruleVal, paramVal)
+}
+
+// The built-in matchers. Apart from `LegacySubstring` they all compare `paramVal` with the decoded rule value,
+// and those taking the rule value as a pattern never match if it isn't a valid one.
+var (
+	// LegacySubstring is how values have always been matched, and still are by default:
+	// the raw rule value equals `paramVal`, or contains it if `paramVal` isn't empty.
+	LegacySubstring Matcher = legacySubstringMatcher{}
+
+	// Exact matches if the rule value equals `paramVal`.
+	Exact Matcher = exactMatcher{}
+
+	// CaseInsensitive matches if the rule value equals `paramVal` under Unicode case folding.
+	CaseInsensitive Matcher = MatcherFunc(func(ruleVal string, paramVal string) bool {
+		return strings.EqualFold(decodeRuleVal(ruleVal), paramVal)
+	})
+
+	// NewlineSet matches if `paramVal` is one of the lines of the rule value, e.g. `graduate` in `bachelors\ngraduate`.
+	NewlineSet Matcher = newlineSetMatcher{}
+
+	// Prefix matches if `paramVal` starts with the rule value.
+	Prefix Matcher = MatcherFunc(func(ruleVal string, paramVal string) bool {
+		return strings.HasPrefix(paramVal, decodeRuleVal(ruleVal))
+	})
+
+	// Glob matches if `paramVal` matches the rule value as a pattern, where `*` stands for any run of characters,
+	// `?` for any single one and `\` escapes the next.
+	Glob Matcher = MatcherFunc(func(ruleVal string, paramVal string) bool {
+		return matchGlob(decodeRuleVal(ruleVal), paramVal)
+	})
+
+	// Regex matches if the whole of `paramVal` matches the rule value as a regular expression.
+	Regex Matcher = newRegexMatcher(regexCacheSize)
+
+	// NumericRange matches if `paramVal` is a number satisfying the rule value as a numeric predicate, e.g. `18-24`,
+	// see `NumericRulePrefix` for them all.
+	NumericRange Matcher = MatcherFunc(func(ruleVal string, paramVal string) bool {
+		return matchNumeric(decodeRuleVal(ruleVal), paramVal)
+	})
+)
+
+// Option configures a `Cache`.
+type Option func(*Cache)
+
+// WithMatcher makes the cache match values with `m` for the params without a matcher of their own,
+// instead of `LegacySubstring`.
+func WithMatcher(m Matcher) Option {
+	return func(ec *Cache) {
+		ec.matcher = m
+	}
+}
+
+// WithParamMatcher makes the cache match the values of `paramKey` with `m`, e.g. `NumericRange` for `age`.
+func WithParamMatcher(paramKey string, m Matcher) Option {
+	return func(ec *Cache) {
+		ec.paramMatchers[paramKey] = m
+	}
+}
+
+// paramMatcher returns the matcher for the values of `paramKey`.
+func (ec *Cache) paramMatcher(paramKey string) Matcher {
+	if m, ok := ec.paramMatchers[paramKey]; ok {
+		return m
+	}
+	return ec.matcher
+}
+
+// decodeRuleVal returns the rule value with its escapes decoded, as is if that fails.
+func decodeRuleVal(ruleVal string) string {
+	if strings.IndexByte(ruleVal, '\\') == -1 {
+		return ruleVal
+	}
+	if res, err := json.Unescape([]byte(ruleVal)); err == nil {
+		return string(res)
+	}
+	return ruleVal
+}
+
+// The matchers `paramIndex` knows how to look values up for have types of their own.
+type (
+	legacySubstringMatcher struct{}
+	exactMatcher           struct{}
+	newlineSetMatcher      struct{}
+)
+
+func (legacySubstringMatcher) Match(ruleVal string, paramVal string) bool {
+	return ruleVal == paramVal || (paramVal != "" && strings.Index(ruleVal, paramVal) != -1)
+}
+
+func (exactMatcher) Match(ruleVal string, paramVal string) bool {
+	return decodeRuleVal(ruleVal) == paramVal
+}
+
+func (newlineSetMatcher) Match(ruleVal string, paramVal string) bool {
+	for _, line := range strings.Split(decodeRuleVal(ruleVal), "\n") {
+		if line == paramVal {
+			return true
+		}
+	}
+	return false
+}
+
+// regexCacheSize is how many rule values `Regex` keeps compiled, the least recently used are compiled again.
+const regexCacheSize = 1024
+
+// regexMatcher keeps the last `size` rule values matched compiled, so a data file with more of them, or data reloaded
+// again and again, doesn't grow it without bound.
+type regexMatcher struct {
+	size int
+
+	mu       sync.Mutex
+	compiled map[string]*list.Element
+	// `recent` holds the `*regexEntry` of `compiled`, the most recently used first.
+	recent *list.List
+}
+
+type regexEntry struct {
+	ruleVal string
+	// re is nil for an invalid pattern, so it isn't compiled again each time.
+	re *regexp.Regexp
+}
+
+func newRegexMatcher(size int) *regexMatcher {
+	return &regexMatcher{size: size, compiled: make(map[string]*list.Element), recent: list.New()}
+}
+
+func (m *regexMatcher) Match(ruleVal string, paramVal string) bool {
+	re := m.regexp(ruleVal)
+	return re != nil && re.MatchString(paramVal)
+}
+
+// regexp returns `ruleVal` compiled, nil if it isn't a valid pattern.
+func (m *regexMatcher) regexp(ruleVal string) *regexp.Regexp {
+	m.mu.Lock()
+	if elem, ok := m.compiled[ruleVal]; ok {
+		m.recent.MoveToFront(elem)
+		m.mu.Unlock()
+		return elem.Value.(*regexEntry).re
+	}
+	m.mu.Unlock()
+
+	// Compiled out of the lock, two lookups of a new rule value may both compile it.
+	re, err := regexp.Compile(`^(?:` + decodeRuleVal(ruleVal) + `)$`)
+	if err != nil {
+		re = nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.compiled[ruleVal]; !ok {
+		m.compiled[ruleVal] = m.recent.PushFront(&regexEntry{ruleVal: ruleVal, re: re})
+		if m.recent.Len() > m.size {
+			delete(m.compiled, m.recent.Remove(m.recent.Back()).(*regexEntry).ruleVal)
+		}
+	}
+	return re
+}
+
+// matchGlob reports whether `val` matches `pattern`, backtracking to the last `*` on a mismatch.
+func matchGlob(pattern string, val string) bool {
+	patIdx, valIdx := 0, 0
+	starPatIdx, starValIdx := -1, 0
+
+	for valIdx < len(val) {
+		if patIdx < len(pattern) {
+			switch c := pattern[patIdx]; {
+			case c == '*':
+				starPatIdx, starValIdx = patIdx, valIdx
+				patIdx++
+				continue
+			case c == '?':
+				_, size := utf8.DecodeRuneInString(val[valIdx:])
+				patIdx++
+				valIdx += size
+				continue
+			case c == '\\' && patIdx+1 < len(pattern) && pattern[patIdx+1] == val[valIdx]:
+				patIdx += 2
+				valIdx++
+				continue
+			case c != '\\' && c == val[valIdx]:
+				patIdx++
+				valIdx++
+				continue
+			}
+		}
+		// Mismatch, let the last `*` swallow one more byte.
+		if starPatIdx == -1 {
+			return false
+		}
+		starValIdx++
+		patIdx, valIdx = starPatIdx+1, starValIdx
+	}
+
+	for patIdx < len(pattern) && pattern[patIdx] == '*' {
+		patIdx++
+	}
+	return patIdx == len(pattern)
+}
@@ -0,0 +1,107 @@
+package lookupcache
+
+import (
+	"testing"
+)
+
+var MatcherTests = []struct {
+	desc     string
+	matcher  Matcher
+	ruleVal  string
+	paramVal string
+	expect   bool
+}{
+	{desc: "legacy equal", matcher: LegacySubstring, ruleVal: "Male", paramVal: "Male", expect: true},
+	{desc: "legacy substring", matcher: LegacySubstring, ruleVal: "Female", paramVal: "male", expect: true},
+	{desc: "legacy raw escapes", matcher: LegacySubstring, ruleVal: `18\n19\n118`, paramVal: "18", expect: true},
+	{desc: "legacy empty", matcher: LegacySubstring, ruleVal: "Male", paramVal: "", expect: false},
+
+	{desc: "exact", matcher: Exact, ruleVal: "Male", paramVal: "Male", expect: true},
+	{desc: "exact substring", matcher: Exact, ruleVal: "Female", paramVal: "male", expect: false},
+	{desc: "exact decoded", matcher: Exact, ruleVal: `a\/b`, paramVal: "a/b", expect: true},
+	{desc: "exact empty", matcher: Exact, ruleVal: "", paramVal: "", expect: true},
+
+	{desc: "case-insensitive", matcher: CaseInsensitive, ruleVal: "Male", paramVal: "mALE", expect: true},
+	{desc: "case-insensitive substring", matcher: CaseInsensitive, ruleVal: "Female", paramVal: "male", expect: false},
+
+	{desc: "set member", matcher: NewlineSet, ruleVal: `bachelors\ngraduate\nhigh_school`, paramVal: "graduate", expect: true},
+	{desc: "set last member", matcher: NewlineSet, ruleVal: `18\n19\n118`, paramVal: "118", expect: true},
+	{desc: "set not member", matcher: NewlineSet, ruleVal: `18\n19\n118`, paramVal: "11", expect: false},
+	{desc: "set of one", matcher: NewlineSet, ruleVal: "kids", paramVal: "kids", expect: true},
+
+	{desc: "prefix", matcher: Prefix, ruleVal: "edu.", paramVal: "edu.school", expect: true},
+	{desc: "prefix mismatch", matcher: Prefix, ruleVal: "edu.", paramVal: "intr.edu.", expect: false},
+
+	{desc: "glob star", matcher: Glob, ruleVal: "*school*", paramVal: "high_school_2", expect: true},
+	{desc: "glob question mark", matcher: Glob, ruleVal: "1?", paramVal: "19", expect: true},
+	{desc: "glob question mark on a multibyte rune", matcher: Glob, ruleVal: "caf?", paramVal: "café", expect: true},
+	{desc: "glob too short", matcher: Glob, ruleVal: "1?", paramVal: "1", expect: false},
+	{desc: "glob backtracking", matcher: Glob, ruleVal: "a*b*c", paramVal: "abxbyc", expect: true},
+	{desc: "glob mismatch", matcher: Glob, ruleVal: "a*b*c", paramVal: "abxbyd", expect: false},
+	{desc: "glob escaped star", matcher: Glob, ruleVal: `a\\*`, paramVal: "a*", expect: true},
+	{desc: "glob escaped star is literal", matcher: Glob, ruleVal: `a\\*`, paramVal: "ab", expect: false},
+
+	{desc: "regex", matcher: Regex, ruleVal: `1[89]|2[0-4]`, paramVal: "22", expect: true},
+	{desc: "regex whole value", matcher: Regex, ruleVal: `1[89]|2[0-4]`, paramVal: "122", expect: false},
+	{desc: "regex decoded", matcher: Regex, ruleVal: `\\d+`, paramVal: "42", expect: true},
+	{desc: "regex invalid", matcher: Regex, ruleVal: `(`, paramVal: "(", expect: false},
+
+	{desc: "range", matcher: NumericRange, ruleVal: "18-24", paramVal: "22", expect: true},
+	{desc: "range inclusive", matcher: NumericRange, ruleVal: "18-24", paramVal: "24", expect: true},
+	{desc: "range outside", matcher: NumericRange, ruleVal: "18-24", paramVal: "118", expect: false},
+	{desc: "range negative", matcher: NumericRange, ruleVal: "-10--2", paramVal: "-5.5", expect: true},
+	{desc: "range single number", matcher: NumericRange, ruleVal: "65", paramVal: "65.0", expect: true},
+	{desc: "range not a number", matcher: NumericRange, ruleVal: "18-24", paramVal: "twenty", expect: false},
+	{desc: "range not a range", matcher: NumericRange, ruleVal: "kids", paramVal: "1", expect: false},
+}
+
+func TestMatchers(t *testing.T) {
+	for _, test := range MatcherTests {
+		if res := test.matcher.Match(test.ruleVal, test.paramVal); res != test.expect {
+			t.Errorf("%s: matching %q with rule value %q returned %t, expected %t", test.desc, test.paramVal, test.ruleVal, res, test.expect)
+		}
+	}
+}
+
+func TestRegexMatcherBounded(t *testing.T) {
+	m := newRegexMatcher(2)
+	for _, ruleVal := range []string{`a+`, `b+`, `a+`, `c+`} {
+		m.Match(ruleVal, "a")
+	}
+
+	// `b+` is the least recently used.
+	if len(m.compiled) != 2 || m.compiled[`b+`] != nil || m.compiled[`a+`] == nil {
+		t.Errorf("%d rule values kept compiled, expected `a+` and `c+` only", len(m.compiled))
+	}
+	if !m.Match(`b+`, "bb") {
+		t.Errorf("matching with a rule value dropped failed, expected it to be compiled again")
+	}
+}
+
+const matcherTestData = `[
+  {"6lkb2cv": [
+    {"gen": [{"Female": {"segmentId": "dem.g.f"}}, {"Male": {"segmentId": "dem.g.m"}}]},
+    {"age": [{"18-24": {"segmentId": "dem.ag.18-24"}}, {"25-34": {"segmentId": "dem.ag.25-34"}}]}
+  ]}
+]`
+
+func TestCacheMatchers(t *testing.T) {
+	ec := New([]byte(matcherTestData))
+	if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "age", "2"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.ag.18-24"}, {Id: "dem.ag.25-34"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` with the default matcher returned %s, expected [{dem.ag.18-24} {dem.ag.25-34}]", res)
+	}
+
+	ec = New([]byte(matcherTestData), WithMatcher(Exact), WithParamMatcher("age", NumericRange))
+	if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "gen", "male"); len(res) != 0 {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` with `Exact` returned %s, expected nothing", res)
+	}
+	if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "gen", "Male"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.g.m"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` with `Exact` returned %s, expected [{dem.g.m}]", res)
+	}
+	if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "age", "22"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.ag.18-24"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` with `NumericRange` for age returned %s, expected [{dem.ag.18-24}]", res)
+	}
+	if res := ec.GetSegmentsForOrgAndAttributes("6lkb2cv", map[string]string{"gen": "Female", "age": "30"}); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.ag.25-34"}, {Id: "dem.g.f"}}, res) {
+		t.Errorf("`GetSegmentsForOrgAndAttributes` with per param matchers returned %s, expected [{dem.ag.25-34} {dem.g.f}]", res)
+	}
+}
@@ -0,0 +1,37 @@
+package lookupcache
+
+import "errors"
+
+// ErrClosed is returned by the lookups of a cache whose mapped data file has been released by `Close`.
+var ErrClosed = errors.New("lookupcache: cache closed")
+
+// WithMmap makes `NewFromFile` map the data file read-only instead of reading it, on Linux. The data then lives
+// in the page cache, shared with the other processes mapping the file, rather than on the heap for the GC to go
+// through. Elsewhere the file is read as usual.
+//
+// The file must not be modified while mapped, replace it by renaming another file over it instead.
+// Call `Close` once done with the cache to release the mapping, `Reload` keeps it until then.
+func WithMmap() Option {
+	return func(ec *Cache) {
+		ec.mmap = true
+	}
+}
+
+// Close releases the data file mapped by `WithMmap`, the lookups then fail with `ErrClosed`. It must not be called
+// while lookups are in flight, they may still be reading the mapping. It does nothing for a cache whose data isn't
+// mapped.
+func (ec *Cache) Close() error {
+	ec.lock.Lock()
+	unmap := ec.unmap
+	if unmap != nil {
+		// Nothing may be left pointing into the mapping once released.
+		ec.closed = true
+		ec.unmap, ec.data, ec.dir, ec.history = nil, nil, nil, nil
+	}
+	ec.lock.Unlock()
+
+	if unmap == nil {
+		return nil
+	}
+	return unmap()
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package lookupcache
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mapFile maps the file at `path` read-only, `unmap` releases the mapping.
+func mapFile(path string) (data []byte, unmap func() error, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The mapping outlives the file descriptor.
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	size := fi.Size()
+	// An empty file can't be mapped, there is nothing to map anyway.
+	if size == 0 {
+		return []byte{}, nil, nil
+	}
+	if int64(int(size)) != size {
+		return nil, nil, fmt.Errorf("lookupcache: %s is too large to map", path)
+	}
+
+	data, err = syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, &os.PathError{Op: "mmap", Path: path, Err: err}
+	}
+
+	return data, func() error {
+		return syscall.Munmap(data)
+	}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package lookupcache
+
+import (
+	"io/ioutil"
+)
+
+// mapFile reads the file at `path`, there is nothing to release.
+func mapFile(path string) (data []byte, unmap func() error, err error) {
+	data, err = ioutil.ReadFile(path)
+	return data, nil, err
+}
@@ -0,0 +1,77 @@
+package lookupcache
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestMmap(t *testing.T) {
+	ec, err := NewFromFile(DefaultDataFile, WithMmap())
+	if err != nil {
+		t.Fatalf("`NewFromFile` with `WithMmap` failed with error %s", err)
+	}
+	read, err := NewFromFile(DefaultDataFile)
+	if err != nil {
+		t.Fatalf("`NewFromFile` failed with error %s", err)
+	}
+
+	orgKeys, err := ec.OrgKeys()
+	if err != nil {
+		t.Fatalf("`OrgKeys` failed with error %s", err)
+	}
+	for _, orgKey := range orgKeys {
+		expect := read.GetSegmentForOrgAndKeyAndVal(orgKey, "gen", "Female")
+		if res := ec.GetSegmentForOrgAndKeyAndVal(orgKey, "gen", "Female"); !compareSliceOfSegmentConfig(expect, res) {
+			t.Errorf("`GetSegmentForOrgAndKeyAndVal` of %s returned %s, expected %s", orgKey, res, expect)
+		}
+	}
+
+	if err := ec.Close(); err != nil {
+		t.Errorf("`Close` failed with error %s", err)
+	}
+	if err := ec.Close(); err != nil {
+		t.Errorf("`Close` called again failed with error %s", err)
+	}
+
+	// Nothing is read out of the released mapping, whether the org was parsed before or not.
+	for _, orgKey := range []string{orgKeys[0], "nonexistent"} {
+		if _, err := ec.GetSegmentForOrgAndKeyAndValE(orgKey, "gen", "Female"); !errors.Is(err, ErrClosed) {
+			t.Errorf("`GetSegmentForOrgAndKeyAndValE` of %s after `Close` failed with error %v, expected %s", orgKey, err, ErrClosed)
+		}
+		if res := ec.GetSegmentForOrgAndKeyAndVal(orgKey, "gen", "Female"); len(res) != 0 {
+			t.Errorf("`GetSegmentForOrgAndKeyAndVal` of %s after `Close` returned %s, expected nothing", orgKey, res)
+		}
+	}
+	if _, err := ec.OrgKeys(); !errors.Is(err, ErrClosed) {
+		t.Errorf("`OrgKeys` after `Close` failed with error %v, expected %s", err, ErrClosed)
+	}
+
+	if err := read.Close(); err != nil {
+		t.Errorf("`Close` of a cache not mapped failed with error %s", err)
+	}
+}
+
+func TestMmapFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	empty := filepath.Join(dir, "empty.json")
+	if err := ioutil.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatalf("writing the data file failed with error %s", err)
+	}
+	ec, err := NewFromFile(empty, WithMmap())
+	if err != nil {
+		t.Fatalf("`NewFromFile` of an empty file failed with error %s", err)
+	}
+	if res := ec.GetSegmentForOrgAndKey("6lkb2cv", "gen"); len(res) != 0 {
+		t.Errorf("`GetSegmentForOrgAndKey` over an empty file returned %s, expected nothing", res)
+	}
+	if err := ec.Close(); err != nil {
+		t.Errorf("`Close` failed with error %s", err)
+	}
+
+	if _, err := NewFromFile(filepath.Join(dir, "missing.json"), WithMmap()); err == nil {
+		t.Errorf("`NewFromFile` of a missing file succeeded, expected an error")
+	}
+}
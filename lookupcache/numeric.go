@@ -0,0 +1,186 @@
+package lookupcache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NumericRulePrefix marks a rule value of the data file as a numeric predicate, e.g. `num:18-24`.
+// Such a rule matches the values which are numbers satisfying the predicate, whatever the matcher of its param is.
+//
+// The predicates are:
+//
+//	18-24  from 18 to 24, both included
+//	65+    65 and above
+//	>=65   65 and above
+//	>64    above 64
+//	<=17   17 and below
+//	<18    below 18
+//	22     22 only, and so is `=22`
+//
+// The numbers are those of `strconv.ParseFloat`, in exponent notation too, e.g. `num:1e3-1e4`.
+const NumericRulePrefix = "num:"
+
+// NumericRules returns the option adding the rules of the sidecar rules file `data` to the cache.
+// The sidecar is laid out as the data file, and all its rule values are numeric predicates, with or without
+// `NumericRulePrefix`, or expressions with `ExprRulePrefix`. Its rules for an org are added to those of the data file when the org is parsed,
+// those for orgs which aren't in the data file are ignored.
+func NumericRules(data []byte) (Option, error) {
+	sidecar := New(data)
+
+	orgKeys, err := sidecar.OrgKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check all the predicates and expressions now rather than fail to match later.
+	for _, orgKey := range orgKeys {
+		for _, paramKey := range sidecar.ParamKeys(orgKey) {
+			for _, paramSeg := range sidecar.ParamSegs(orgKey, paramKey) {
+				if strings.HasPrefix(paramSeg.ParamVal, ExprRulePrefix) {
+					if _, err := ParseExpr(decodeRuleVal(paramSeg.ParamVal[len(ExprRulePrefix):])); err != nil {
+						return nil, fmt.Errorf("lookupcache: invalid expression %q for %s of org %s: %w", paramSeg.ParamVal, paramKey, orgKey, err)
+					}
+					continue
+				}
+				if _, ok := parseNumericPredicate(strings.TrimPrefix(decodeRuleVal(paramSeg.ParamVal), NumericRulePrefix)); !ok {
+					return nil, fmt.Errorf("lookupcache: invalid numeric predicate %q for %s of org %s", paramSeg.ParamVal, paramKey, orgKey)
+				}
+			}
+		}
+	}
+
+	return func(ec *Cache) {
+		ec.sidecar = sidecar
+	}, nil
+}
+
+// NumericRulesFromFile reads the sidecar rules file at `path` and returns the option adding its rules to the cache.
+func NumericRulesFromFile(path string) (Option, error) {
+	res, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NumericRules(res)
+}
+
+// numericPredicate holds the values between `lo` and `hi`, which are themselves excluded if `loExcl` and `hiExcl`.
+type numericPredicate struct {
+	lo, hi         float64
+	loExcl, hiExcl bool
+}
+
+func (p numericPredicate) match(val float64) bool {
+	if val < p.lo || (p.loExcl && val == p.lo) {
+		return false
+	}
+	if val > p.hi || (p.hiExcl && val == p.hi) {
+		return false
+	}
+	return true
+}
+
+// parseNumericPredicate parses one of the predicates listed by `NumericRulePrefix`.
+func parseNumericPredicate(s string) (numericPredicate, bool) {
+	s = strings.TrimSpace(s)
+
+	for _, op := range []string{">=", "<=", ">", "<", "=", "+"} {
+		var num string
+		switch {
+		case op == "+" && strings.HasSuffix(s, op):
+			num = s[:len(s)-len(op)]
+		case op != "+" && strings.HasPrefix(s, op):
+			num = s[len(op):]
+		default:
+			continue
+		}
+
+		val, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+		if err != nil {
+			return numericPredicate{}, false
+		}
+
+		switch op {
+		case ">=", "+":
+			return numericPredicate{lo: val, hi: math.Inf(1)}, true
+		case ">":
+			return numericPredicate{lo: val, hi: math.Inf(1), loExcl: true}, true
+		case "<=":
+			return numericPredicate{lo: math.Inf(-1), hi: val}, true
+		case "<":
+			return numericPredicate{lo: math.Inf(-1), hi: val, hiExcl: true}, true
+		default:
+			return numericPredicate{lo: val, hi: val}, true
+		}
+	}
+
+	// A `-` at the very start can only be the sign of `lo`, one after an `e` the sign of an exponent, and one after
+	// the range separator the sign of a negative `hi`: the separator is the first `-` left which splits two numbers.
+	for sep := 1; sep < len(s); sep++ {
+		if s[sep] != '-' || s[sep-1] == 'e' || s[sep-1] == 'E' {
+			continue
+		}
+		lo, err := strconv.ParseFloat(strings.TrimSpace(s[:sep]), 64)
+		if err != nil {
+			continue
+		}
+		hi, err := strconv.ParseFloat(strings.TrimSpace(s[sep+1:]), 64)
+		if err != nil {
+			continue
+		}
+		return numericPredicate{lo: lo, hi: hi}, true
+	}
+
+	val, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return numericPredicate{}, false
+	}
+	return numericPredicate{lo: val, hi: val}, true
+}
+
+// matchNumeric reports whether `paramVal` is a number satisfying the predicate `pred`.
+func matchNumeric(pred string, paramVal string) bool {
+	val, err := strconv.ParseFloat(strings.TrimSpace(paramVal), 64)
+	if err != nil {
+		return false
+	}
+	p, ok := parseNumericPredicate(pred)
+	return ok && p.match(val)
+}
+
+// numericRule returns the predicate of the rule value `ruleVal`, if it is a numeric one.
+func numericRule(ruleVal string) (string, bool) {
+	if !strings.HasPrefix(ruleVal, NumericRulePrefix) {
+		return "", false
+	}
+	return decodeRuleVal(ruleVal[len(NumericRulePrefix):]), true
+}
+
+// sidecarRules adds the rules of the sidecar for `orgKey` to `paramSegMap`, interning their param keys and segment ids
+// in `strs`.
+func (ec *Cache) sidecarRules(strs *strTable, orgKey string, paramSegMap map[string]*paramRules) {
+	sidecarEntry, ok := ec.sidecar.org(orgKey)
+	if !ok {
+		return
+	}
+
+	for paramKey, idx := range sidecarEntry.params {
+		paramKey = strs.str(strs.internString(paramKey))
+		rules, ok := paramSegMap[paramKey]
+		if !ok {
+			rules = &paramRules{}
+			paramSegMap[paramKey] = rules
+		}
+
+		for _, seg := range idx.segs() {
+			paramVal := seg.ParamVal
+			if !strings.HasPrefix(paramVal, NumericRulePrefix) && !strings.HasPrefix(paramVal, ExprRulePrefix) {
+				paramVal = NumericRulePrefix + paramVal
+			}
+			rules.add(paramVal, strs.internString(seg.SegId))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package lookupcache
+
+import (
+	"testing"
+)
+
+var NumericPredicateTests = []struct {
+	desc     string
+	pred     string
+	paramVal string
+	expect   bool
+}{
+	{desc: "range", pred: "18-24", paramVal: "22", expect: true},
+	{desc: "range lower bound", pred: "18-24", paramVal: "18", expect: true},
+	{desc: "range below", pred: "18-24", paramVal: "17.5", expect: false},
+	{desc: "negative range", pred: "-10--2", paramVal: "-5.5", expect: true},
+	{desc: "exponent range", pred: "1e3-2.5E3", paramVal: "2000", expect: true},
+	{desc: "negative exponent range", pred: "1e-3-5e-1", paramVal: "0.01", expect: true},
+	{desc: "negative exponent range below", pred: "-1e-3--1e-4", paramVal: "-0.01", expect: false},
+	{desc: "exponent comparison", pred: ">=1e3", paramVal: "1000", expect: true},
+	{desc: "exponent number", pred: "1e-3", paramVal: "0.001", expect: true},
+	{desc: "not a range", pred: "18-", paramVal: "18", expect: false},
+	{desc: "open-ended band", pred: "65+", paramVal: "100", expect: true},
+	{desc: "open-ended band below", pred: "65+", paramVal: "64", expect: false},
+	{desc: "at least", pred: ">=65", paramVal: "65", expect: true},
+	{desc: "above", pred: ">64", paramVal: "64", expect: false},
+	{desc: "at most", pred: "<=17", paramVal: "17", expect: true},
+	{desc: "below", pred: "<18", paramVal: "18", expect: false},
+	{desc: "below negative", pred: "< 18", paramVal: "-3", expect: true},
+	{desc: "equal", pred: "=22", paramVal: "22.0", expect: true},
+	{desc: "single number", pred: "22", paramVal: "23", expect: false},
+	{desc: "not a number", pred: "18-24", paramVal: "", expect: false},
+	{desc: "not a predicate", pred: "18\n19", paramVal: "18", expect: false},
+}
+
+func TestNumericPredicates(t *testing.T) {
+	for _, test := range NumericPredicateTests {
+		if res := matchNumeric(test.pred, test.paramVal); res != test.expect {
+			t.Errorf("%s: matching %q with predicate %q returned %t, expected %t", test.desc, test.paramVal, test.pred, res, test.expect)
+		}
+	}
+}
+
+const numericTestData = `[
+  {"1a9n4ou": [
+    {"age": [{"num:18-24": {"segmentId": "dem.ag.18-24"}}, {"num:>=65": {"segmentId": "dem.ag.65+"}}, {"18\n19\n20": {"segmentId": "dem.ag.18-20"}}]},
+    {"gen": [{"Male": {"segmentId": "dem.g.m"}}]}
+  ]},
+  {"6lkb2cv": [
+    {"gen": [{"Female": {"segmentId": "dem.g.f"}}]}
+  ]}
+]`
+
+const numericTestSidecar = `[
+  {"6lkb2cv": [
+    {"age": [{"25-34": {"segmentId": "dem.ag.25-34"}}, {"num:<18": {"segmentId": "zz_trash"}}]}
+  ]},
+  {"nonexistent": [
+    {"age": [{"65+": {"segmentId": "dem.ag.65+"}}]}
+  ]}
+]`
+
+func TestNumericRules(t *testing.T) {
+	opt, err := NumericRules([]byte(numericTestSidecar))
+	if err != nil {
+		t.Fatalf("`NumericRules` failed with error %s", err)
+	}
+	ec := New([]byte(numericTestData), opt)
+
+	if res := ec.GetSegmentForOrgAndKeyAndVal("1a9n4ou", "age", "22"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.ag.18-24"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` of age 22 returned %s, expected [{dem.ag.18-24}]", res)
+	}
+	// Numeric rules leave the others to the matcher, `LegacySubstring` here.
+	if res := ec.GetSegmentForOrgAndKeyAndVal("1a9n4ou", "age", "19"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.ag.18-24"}, {Id: "dem.ag.18-20"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` of age 19 returned %s, expected [{dem.ag.18-24} {dem.ag.18-20}]", res)
+	}
+	if res := ec.GetSegmentForOrgAndKeyAndVal("1a9n4ou", "age", "70"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.ag.65+"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` of age 70 returned %s, expected [{dem.ag.65+}]", res)
+	}
+
+	// From the sidecar.
+	if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "age", "30"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.ag.25-34"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` of age 30 from the sidecar returned %s, expected [{dem.ag.25-34}]", res)
+	}
+	if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "age", "12"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "zz_trash"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` of age 12 from the sidecar returned %s, expected [{zz_trash}]", res)
+	}
+	if res := ec.RulesForSegment("dem.ag.25-34"); !compareSliceOfRule([]Rule{{OrgKey: "6lkb2cv", ParamKey: "age", ParamVal: "num:25-34"}}, res) {
+		t.Errorf("`RulesForSegment` of a sidecar rule returned %v, expected [{6lkb2cv age num:25-34}]", res)
+	}
+	if res := ec.ParamKeys("nonexistent"); res != nil {
+		t.Errorf("`ParamKeys` of an org only in the sidecar returned %s, expected nil", res)
+	}
+
+	if _, err := NumericRules([]byte(`[{"6lkb2cv": [{"age": [{"18 to 24": {"segmentId": "dem.ag.18-24"}}]}]}]`)); err == nil {
+		t.Errorf("`NumericRules` with an invalid predicate succeeded")
+	}
+	if _, err := NumericRules([]byte(`[{"6lkb2cv": [`)); err == nil {
+		t.Errorf("`NumericRules` with an invalid sidecar succeeded")
+	}
+}
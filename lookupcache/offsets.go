@@ -0,0 +1,105 @@
+package lookupcache
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// WithOffsetIndexFile makes the cache save where the details of every org are in the data to the file at `path`,
+// after scanning the data for them the first time. Caches over the same data created later, in this process or
+// another, read them from there instead of scanning the data again. The file is ignored, and written again,
+// if it is missing, corrupt or not that of the data.
+func WithOffsetIndexFile(path string) Option {
+	return func(ec *Cache) {
+		ec.offsetIndexFile = path
+	}
+}
+
+// offsetIndexVersion is bumped whenever the layout of the offset index file changes.
+const offsetIndexVersion = 1
+
+// offsetIndex is the layout of the offset index file, `Size` and `Checksum` being those of the data it is for.
+type offsetIndex struct {
+	Version  int              `json:"version"`
+	Size     int              `json:"size"`
+	Checksum uint32           `json:"checksum"`
+	Orgs     []offsetIndexOrg `json:"orgs"`
+}
+
+// offsetIndexOrg is a listing of an org, in the order of the data file.
+type offsetIndexOrg struct {
+	Key    string `json:"key"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// readOffsetIndex lists the orgs as the offset index file at `path` tells, if it is that of `data`.
+func (dir *orgDir) readOffsetIndex(path string) bool {
+	res, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	var idx offsetIndex
+	if err := json.Unmarshal(res, &idx); err != nil {
+		return false
+	}
+	if idx.Version != offsetIndexVersion || idx.Size != len(dir.data) || idx.Checksum != crc32.Checksum(dir.data, castagnoli) {
+		return false
+	}
+
+	for _, org := range idx.Orgs {
+		if org.Offset < 0 || org.Length < 0 || org.Offset+org.Length > len(dir.data) {
+			// Can't be, short of a bug.
+			dir.keys, dir.spans, dir.first = dir.keys[:0], nil, make(map[string]int)
+			return false
+		}
+		dir.add(org.Key, orgSpan{offset: org.Offset, length: org.Length})
+	}
+	return true
+}
+
+// writeOffsetIndex saves the directory to the offset index file at `path`, atomically so that a process reading
+// it meanwhile doesn't get half of it.
+func (dir *orgDir) writeOffsetIndex(path string) error {
+	idx := offsetIndex{
+		Version:  offsetIndexVersion,
+		Size:     len(dir.data),
+		Checksum: crc32.Checksum(dir.data, castagnoli),
+		Orgs:     make([]offsetIndexOrg, 0, len(dir.keys)),
+	}
+	for listing, orgKey := range dir.keys {
+		// A JSON string would not hold the key as is.
+		if !utf8.ValidString(orgKey) {
+			return nil
+		}
+		span := dir.spans[listing]
+		idx.Orgs = append(idx.Orgs, offsetIndexOrg{Key: orgKey, Offset: span.offset, Length: span.length})
+	}
+
+	res, err := json.Marshal(&idx)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(res); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,92 @@
+package lookupcache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOffsetIndexFile(t *testing.T) {
+	data, err := ioutil.ReadFile(DefaultDataFile)
+	if err != nil {
+		t.Fatalf("reading the data file failed with error %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "data.json.idx")
+
+	scanned := New(data, WithOffsetIndexFile(path))
+	expectKeys, err := scanned.OrgKeys()
+	if err != nil {
+		t.Fatalf("`OrgKeys` failed with error %s", err)
+	}
+	if scans := atomic.LoadInt64(&scanned.scans); scans != 1 {
+		t.Errorf("the data was scanned %d times, expected once", scans)
+	}
+
+	// Another cache over the same data reads the offsets instead of scanning.
+	ec := New(data, WithOffsetIndexFile(path))
+	orgKeys, err := ec.OrgKeys()
+	if err != nil {
+		t.Fatalf("`OrgKeys` with the offset index failed with error %s", err)
+	}
+	if scans := atomic.LoadInt64(&ec.scans); scans != 0 {
+		t.Errorf("the data was scanned %d times with the offset index, expected never", scans)
+	}
+	if len(orgKeys) != len(expectKeys) {
+		t.Fatalf("`OrgKeys` with the offset index returned %d orgs, expected %d", len(orgKeys), len(expectKeys))
+	}
+
+	scannedDir, _ := scanned.directory()
+	dir, _ := ec.directory()
+	for idx, orgKey := range expectKeys {
+		if orgKeys[idx] != orgKey {
+			t.Errorf("org %d is %s with the offset index, expected %s", idx, orgKeys[idx], orgKey)
+		}
+		expect, _ := scannedDir.details(orgKey)
+		if res, ok := dir.details(orgKey); !ok || !bytes.Equal(expect, res) {
+			t.Errorf("the details of %s are %.20q with the offset index, expected %.20q", orgKey, res, expect)
+		}
+		if expect, res := scanned.GetSegmentForOrgAndKey(orgKey, "gen"), ec.GetSegmentForOrgAndKey(orgKey, "gen"); !compareSliceOfSegmentConfig(expect, res) {
+			t.Errorf("`GetSegmentForOrgAndKey` of %s with the offset index returned %s, expected %s", orgKey, res, expect)
+		}
+	}
+}
+
+var OffsetIndexFileIgnoredTests = []struct {
+	desc  string
+	index []byte
+}{
+	{"garbage", []byte("not an index")},
+	{"other version", []byte(`{"version": 0, "orgs": []}`)},
+	{"other data", nil},
+}
+
+func TestOffsetIndexFileIgnored(t *testing.T) {
+	for _, tt := range OffsetIndexFileIgnoredTests {
+		path := filepath.Join(t.TempDir(), "data.json.idx")
+
+		if tt.index != nil {
+			if err := ioutil.WriteFile(path, tt.index, 0644); err != nil {
+				t.Fatalf("%s: writing the offset index failed with error %s", tt.desc, err)
+			}
+		} else {
+			New([]byte(rulesTestDataReloaded), WithOffsetIndexFile(path)).OrgKeys()
+		}
+
+		ec := New([]byte(rulesTestData), WithOffsetIndexFile(path))
+		if res := ec.GetSegmentForOrgAndKey("1a9n4ou", "edu"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "intr.edu"}}, res) {
+			t.Errorf("%s: `GetSegmentForOrgAndKey` returned %s, expected [{intr.edu}]", tt.desc, res)
+		}
+		if scans := atomic.LoadInt64(&ec.scans); scans != 1 {
+			t.Errorf("%s: the data was scanned %d times, expected once", tt.desc, scans)
+		}
+
+		// Written again for this data.
+		ec = New([]byte(rulesTestData), WithOffsetIndexFile(path))
+		ec.OrgKeys()
+		if scans := atomic.LoadInt64(&ec.scans); scans != 0 {
+			t.Errorf("%s: the data was scanned %d times once the offset index was written again, expected never", tt.desc, scans)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package lookupcache
+
+import (
+	"sort"
+)
+
+// Rule is one (org, param key, param value) entry of the data file, which emits a segment.
+type Rule struct {
+	OrgKey   string
+	ParamKey string
+	ParamVal string
+}
+
+// RulesForSegment returns every rule which can emit the segment `id`, across all the orgs of the data file,
+// sorted by org, param key and then param value. It parses all the orgs not looked up yet on its first call.
+// A cache with a capacity doesn't keep the rules by segment, it goes through all the orgs every call instead.
+func (ec *Cache) RulesForSegment(id string) []Rule {
+	var rules []Rule
+	if ec.bounded() {
+		rules = ec.scanRules(id)
+	} else {
+		ec.parseAll()
+
+		ec.lock.RLock()
+		rules = make([]Rule, len(ec.segRules[id]))
+		copy(rules, ec.segRules[id])
+		ec.lock.RUnlock()
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].OrgKey != rules[j].OrgKey {
+			return rules[i].OrgKey < rules[j].OrgKey
+		}
+		if rules[i].ParamKey != rules[j].ParamKey {
+			return rules[i].ParamKey < rules[j].ParamKey
+		}
+		return rules[i].ParamVal < rules[j].ParamVal
+	})
+
+	return rules
+}
+
+// indexOrg adds the rules of `orgKey` to `segRules`, `ec.lock` must be held for writing.
+func (ec *Cache) indexOrg(orgKey string, params map[string]*paramIndex) {
+	for paramKey, idx := range params {
+		for _, seg := range idx.segs() {
+			ec.segRules[seg.SegId] = append(ec.segRules[seg.SegId], Rule{OrgKey: orgKey, ParamKey: paramKey, ParamVal: seg.ParamVal})
+		}
+	}
+}
+
+// unindexOrg removes the rules of `orgKey` from `segRules`, `ec.lock` must be held for writing.
+func (ec *Cache) unindexOrg(orgKey string, params map[string]*paramIndex) {
+	segIds := make(map[string]bool)
+	for _, idx := range params {
+		for _, seg := range idx.segs() {
+			segIds[seg.SegId] = true
+		}
+	}
+
+	for segId := range segIds {
+		rules := make([]Rule, 0, len(ec.segRules[segId]))
+		for _, rule := range ec.segRules[segId] {
+			if rule.OrgKey != orgKey {
+				rules = append(rules, rule)
+			}
+		}
+		if len(rules) == 0 {
+			delete(ec.segRules, segId)
+		} else {
+			ec.segRules[segId] = rules
+		}
+	}
+}
+
+// scanRules returns the rules emitting the segment `id` of every org, see `eachOrg`.
+func (ec *Cache) scanRules(id string) []Rule {
+	rules := make([]Rule, 0)
+
+	ec.eachOrg(func(orgKey string, entry *orgEntry, err error) {
+		if err != nil {
+			return
+		}
+
+		for paramKey, idx := range entry.params {
+			for _, seg := range idx.segs() {
+				if seg.SegId == id {
+					rules = append(rules, Rule{OrgKey: orgKey, ParamKey: paramKey, ParamVal: seg.ParamVal})
+				}
+			}
+		}
+	})
+
+	return rules
+}
@@ -0,0 +1,94 @@
+package lookupcache
+
+import (
+	"testing"
+)
+
+const rulesTestData = `[
+  {"6lkb2cv": [
+    {"gen": [{"Female": {"segmentId": "dem.g.f"}}, {"Male": {"segmentId": "dem.g.m"}}]},
+    {"edu": [{"college": {"segmentId": "intr.edu"}}]}
+  ]},
+  {"1a9n4ou": [
+    {"sub": [{"school\nuniversity": {"segmentId": "intr.edu"}}]},
+    {"edu": [{"": {"segmentId": "intr.edu"}}]}
+  ]}
+]`
+
+const rulesTestDataReloaded = `[
+  {"6lkb2cv": [
+    {"gen": [{"Female": {"segmentId": "dem.g.f"}}]}
+  ]},
+  {"1a9n4ou": [
+    {"edu": [{"": {"segmentId": "intr.edu"}}]}
+  ]}
+]`
+
+func compareSliceOfRule(a, b []Rule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRulesForSegment(t *testing.T) {
+	expect := []Rule{
+		{OrgKey: "1a9n4ou", ParamKey: "edu", ParamVal: ""},
+		{OrgKey: "1a9n4ou", ParamKey: "sub", ParamVal: `school\nuniversity`},
+		{OrgKey: "6lkb2cv", ParamKey: "edu", ParamVal: "college"},
+	}
+
+	ec := New([]byte(rulesTestData))
+	if res := ec.RulesForSegment("intr.edu"); !compareSliceOfRule(expect, res) {
+		t.Errorf("`RulesForSegment` returned %v, expected %v", res, expect)
+	}
+
+	// Orgs already parsed by lookups are indexed once only.
+	ec = New([]byte(rulesTestData))
+	ec.GetSegmentForOrgAndKey("1a9n4ou", "edu")
+	if res := ec.RulesForSegment("intr.edu"); !compareSliceOfRule(expect, res) {
+		t.Errorf("`RulesForSegment` after a lookup returned %v, expected %v", res, expect)
+	}
+	ec.GetSegmentForOrgAndKey("6lkb2cv", "edu")
+	if res := ec.RulesForSegment("intr.edu"); !compareSliceOfRule(expect, res) {
+		t.Errorf("`RulesForSegment` called again returned %v, expected %v", res, expect)
+	}
+
+	if res := ec.RulesForSegment("nonexistent"); len(res) != 0 {
+		t.Errorf("`RulesForSegment` of an unknown segment returned %v, expected nothing", res)
+	}
+
+	ec.Reload([]byte(rulesTestDataReloaded))
+	if res := ec.RulesForSegment("intr.edu"); !compareSliceOfRule(expect[:1], res) {
+		t.Errorf("`RulesForSegment` after `Reload` returned %v, expected %v", res, expect[:1])
+	}
+	if res := ec.RulesForSegment("dem.g.m"); len(res) != 0 {
+		t.Errorf("`RulesForSegment` of a segment removed by `Reload` returned %v, expected nothing", res)
+	}
+	if res := ec.GetSegmentForOrgAndKey("6lkb2cv", "edu"); len(res) != 0 {
+		t.Errorf("`GetSegmentForOrgAndKey` of a param removed by `Reload` returned %v, expected nothing", res)
+	}
+}
+
+func TestRulesForSegmentOfDataFile(t *testing.T) {
+	res := Ec.RulesForSegment("intr.edu")
+	if len(res) != 16 {
+		t.Errorf("`Ec.RulesForSegment` returned %d rules, expected 16", len(res))
+	}
+	for _, rule := range res {
+		found := false
+		for _, seg := range Ec.GetSegmentForOrgAndKeyAndVal(rule.OrgKey, rule.ParamKey, rule.ParamVal) {
+			if seg.Id == "intr.edu" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("rule %v returned by `Ec.RulesForSegment` doesn't emit intr.edu", rule)
+		}
+	}
+}
@@ -0,0 +1,546 @@
+package lookupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SegmentSource is where a cache created by `NewFromSource` gets its rules from, so that they can be stored
+// elsewhere than in a single data file without the lookups noticing.
+type SegmentSource interface {
+	// OrgKeys lists the keys of the orgs of the source.
+	OrgKeys() ([]string, error)
+	// Org returns the rules of the org `orgKey` by param, in order, nil if there is no such org.
+	// The values are raw, as they would be written in a data file, escapes not decoded.
+	Org(orgKey string) (map[string][]ParamSeg, error)
+	// Watch calls `changed` every time the source changes, until `ctx` is done, it then returns `ctx.Err()`.
+	Watch(ctx context.Context, changed func()) error
+}
+
+// VersionedSource is a `SegmentSource` which also tells the version of each of its orgs, so that `ReloadChanged`
+// only parses again the orgs whose version changed.
+type VersionedSource interface {
+	SegmentSource
+	// OrgVersions returns the versions of the orgs of the source by key, a version changes whenever the rules
+	// of its org do.
+	OrgVersions() (map[string]string, error)
+}
+
+// NewFromSource returns a cache over the rules of `src`, an org is fetched from it the first time it is looked up
+// and the orgs are listed the first time the directory is needed, see `WatchSource` to pick its changes up.
+// Snapshot and offset index files don't apply to such a cache, its data being that of `src`.
+func NewFromSource(src SegmentSource, opts ...Option) *Cache {
+	ec := newCache(opts)
+	ec.src = src
+	ec.start()
+	return ec
+}
+
+// WatchSource picks the changes of the source of a cache created by `NewFromSource` up with `ReloadChanged` whenever
+// it changes, until `ctx` is done. It then returns `ctx.Err()`, or what went wrong watching.
+func (ec *Cache) WatchSource(ctx context.Context) error {
+	if ec.src == nil {
+		return errors.New("lookupcache: not a cache of a source")
+	}
+	return ec.src.Watch(ctx, func() {
+		if err := ec.ReloadChanged(); err != nil {
+			// Better fetch everything again than keep what may be stale. The data of such a cache is always nil.
+			ec.Reload(nil)
+		}
+	})
+}
+
+// ReloadChanged picks the changes of the source of a cache created by `NewFromSource` up. With a `VersionedSource`,
+// only the orgs whose version changed are dropped: those kept parsed are parsed again first and swapped in
+// all at once, the others are left as they are. Otherwise everything fetched is dropped, as by `Reload`.
+// The strings interned for the orgs dropped are released once they are most of the string table, see
+// `compactStrings`.
+func (ec *Cache) ReloadChanged() error {
+	if ec.src == nil {
+		return errors.New("lookupcache: not a cache of a source")
+	}
+	if _, ok := ec.src.(VersionedSource); !ok {
+		ec.Reload(nil)
+		return nil
+	}
+
+	ec.reloading.Lock()
+	defer ec.reloading.Unlock()
+
+	dir, gen := ec.directory()
+	if dir.err != nil || dir.versions == nil {
+		ec.Reload(nil)
+		return nil
+	}
+
+	next := newOrgDir(nil)
+	next.listSource(ec.src)
+	if next.err != nil {
+		return next.err
+	}
+	ec.addSourceOrgs(next)
+	close(next.done)
+
+	changed := make(map[string]bool)
+	for orgKey, version := range next.versions {
+		if prev, ok := dir.versions[orgKey]; !ok || prev != version {
+			changed[orgKey] = true
+		}
+	}
+	for orgKey := range dir.versions {
+		if _, ok := next.versions[orgKey]; !ok {
+			changed[orgKey] = true
+		}
+	}
+
+	ec.lock.RLock()
+	parsed := make([]string, 0)
+	for orgKey := range changed {
+		if _, ok := ec.orgs[orgKey]; ok {
+			if _, ok := next.first[orgKey]; ok {
+				parsed = append(parsed, orgKey)
+			}
+		}
+	}
+	ec.lock.RUnlock()
+
+	entries := make(map[string]*orgEntry, len(parsed))
+	for _, orgKey := range parsed {
+		// Left to its next lookup if it can't be parsed now, e.g. as its file is being written.
+		if entry, err := ec.parseOrg(orgKey, nil); err == nil {
+			entries[orgKey] = entry
+		}
+	}
+
+	ec.lock.Lock()
+	defer ec.lock.Unlock()
+
+	if ec.gen != gen {
+		// Reloaded meanwhile, everything was dropped already.
+		return nil
+	}
+
+	if len(changed) > 0 {
+		ec.retire()
+		if ec.historySize > 1 && !ec.bounded() {
+			// The orgs of the version retired are those of `orgs` as they were.
+			orgs := make(map[string]*orgEntry, len(ec.orgs))
+			for orgKey, entry := range ec.orgs {
+				orgs[orgKey] = entry
+			}
+			ec.orgs = orgs
+		}
+	}
+
+	for orgKey := range changed {
+		prev, ok := ec.orgs[orgKey]
+		if !ok {
+			continue
+		}
+		ec.bytes -= prev.size
+		if !ec.bounded() {
+			ec.unindexOrg(orgKey, prev.params)
+		}
+
+		entry, ok := entries[orgKey]
+		if !ok {
+			delete(ec.orgs, orgKey)
+			if ec.bounded() {
+				ec.evictor.Removed(orgKey)
+			}
+			continue
+		}
+		// Tracked by the evictor as it was.
+		ec.orgs[orgKey] = entry
+		ec.bytes += entry.size
+		if !ec.bounded() {
+			ec.indexOrg(orgKey, entry.params)
+		}
+	}
+
+	for orgKey := range next.first {
+		if _, ok := ec.orgs[orgKey]; !ok {
+			ec.complete = false
+			break
+		}
+	}
+	ec.dir = next
+	ec.inflight = make(map[string]*orgCall)
+	// Parses in flight may be of the previous versions, and orgs found missing may have been added.
+	ec.gen++
+	ec.negative.reset(ec.gen)
+	ec.compactStrings()
+
+	if ec.loadMode == Eager {
+		ec.startLoad()
+	}
+	return nil
+}
+
+// minCompactStrs is the size of the string table from which `compactStrings` looks for strings no longer used.
+const minCompactStrs = 1024
+
+// compactStrings replaces the string table of a cache without a capacity with one of the strings its orgs still use,
+// if those are no more than half of it, copying the orgs over to it. The strings used are only counted once the
+// table has doubled since they last were. The parses in flight must be of a previous generation, not to be kept
+// with strings of the old table. `ec.lock` must be held for writing.
+func (ec *Cache) compactStrings() {
+	size := ec.strs.len()
+	if ec.bounded() || size < minCompactStrs || size < 2*ec.liveStrs {
+		return
+	}
+
+	live := make(map[string]struct{})
+	for _, entry := range ec.orgs {
+		for paramKey, idx := range entry.params {
+			live[paramKey] = struct{}{}
+			for _, segId := range idx.rules.segIds {
+				live[idx.strs.str(segId)] = struct{}{}
+			}
+		}
+	}
+	ec.liveStrs = len(live)
+	if 2*len(live) > size {
+		return
+	}
+
+	strs := newStrTable()
+	orgs := make(map[string]*orgEntry, len(ec.orgs))
+	for orgKey, entry := range ec.orgs {
+		orgs[orgKey] = copyOrg(strs, orgKey, entry)
+		ec.bytes += orgs[orgKey].size - entry.size
+	}
+	// A new map, the previous one may be that of the version retired.
+	ec.orgs, ec.strs, ec.liveStrs = orgs, strs, strs.len()
+}
+
+// listSource lists the orgs of `src` in `dir`, they have no details in the data, along with their versions
+// if `src` is a `VersionedSource`.
+func (dir *orgDir) listSource(src SegmentSource) {
+	orgKeys, err := src.OrgKeys()
+	if err != nil {
+		dir.err = err
+		return
+	}
+	if vs, ok := src.(VersionedSource); ok {
+		// Listed before the orgs are fetched, a version may only be older than the rules fetched.
+		if dir.versions, err = vs.OrgVersions(); err != nil {
+			dir.err = err
+			return
+		}
+	}
+	for _, orgKey := range orgKeys {
+		dir.add(orgKey, orgSpan{offset: -1})
+	}
+}
+
+// fetchOrg fetches the rules of `orgKey` from the source, interning their param keys and segment ids in `strs`.
+func (ec *Cache) fetchOrg(strs *strTable, orgKey string) (map[string]*paramRules, error) {
+	segMap, err := ec.src.Org(orgKey)
+	if err != nil {
+		return nil, err
+	}
+	if segMap == nil {
+		return nil, fmt.Errorf("org %s gone from the source", orgKey)
+	}
+
+	paramMap := make(map[string]*paramRules, len(segMap))
+	for paramKey, segs := range segMap {
+		rules := &paramRules{}
+		for _, seg := range segs {
+			rules.add(seg.ParamVal, strs.internString(seg.SegId))
+		}
+		paramMap[strs.str(strs.internString(paramKey))] = rules
+	}
+	return paramMap, nil
+}
+
+// DefaultPollInterval is how often the sources of this package look for changes while watched.
+const DefaultPollInterval = time.Second
+
+// NewJSONFileSource returns the source of the data file at `path`, which is read again once changed.
+func NewJSONFileSource(path string) SegmentSource {
+	return NewFSSource(os.DirFS(filepath.Dir(path)), filepath.Base(path))
+}
+
+// NewDirSource returns the source of the directory `dir` holding a file per org, see `NewFSSource`.
+func NewDirSource(dir string) SegmentSource {
+	return NewFSSource(os.DirFS(dir), ".")
+}
+
+// NewFSSource returns the source of `name` in `fsys`, e.g. an `embed.FS`. `name` is a data file, or a directory
+// holding a file per org named after its key, `<orgKey>.json`, which holds the details of the org as the data file
+// would, `[{"<paramKey>": [<seg>, ...]}, ...]`.
+// Changes are looked for every `DefaultPollInterval` while the source is watched, from the modification times
+// and sizes of the files. The version of an org is a checksum of its details, that of a file is only computed
+// again once its modification time or size changed, so that `ReloadChanged` doesn't parse again an org whose file
+// was merely touched.
+func NewFSSource(fsys fs.FS, name string) SegmentSource {
+	return &fsSource{fsys: fsys, name: name, poll: DefaultPollInterval}
+}
+
+// fsSource is the source of a data file or a directory of a file per org in `fsys`.
+// The data file is read by the first call, and again by those after it changed.
+type fsSource struct {
+	fsys fs.FS
+	name string
+	poll time.Duration
+
+	lock     sync.Mutex
+	stamp    string
+	dir      *orgDir
+	versions map[string]string
+	// `sums` are the checksums of the files of a directory, by name, as of their modification times and sizes.
+	sums map[string]fileSum
+}
+
+var _ VersionedSource = (*fsSource)(nil)
+
+// fileSum is the checksum of a file as of its modification time and size.
+type fileSum struct {
+	modTime int64
+	size    int64
+	crc     uint32
+}
+
+func (s *fsSource) OrgKeys() ([]string, error) {
+	info, err := fs.Stat(s.fsys, s.name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return s.orgFiles()
+	}
+
+	dir, err := s.dataDir()
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), dir.keys...), nil
+}
+
+// orgFiles lists the orgs of the directory, in the order of their keys.
+func (s *fsSource) orgFiles() ([]string, error) {
+	entries, err := fs.ReadDir(s.fsys, s.name)
+	if err != nil {
+		return nil, err
+	}
+
+	orgKeys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			orgKeys = append(orgKeys, strings.TrimSuffix(entry.Name(), ".json"))
+		}
+	}
+	sort.Strings(orgKeys)
+	return orgKeys, nil
+}
+
+// dataDir returns the directory of the data file, reading it again if it changed.
+func (s *fsSource) dataDir() (*orgDir, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stamp, err := s.currentStamp()
+	if err != nil {
+		return nil, err
+	}
+	if s.dir != nil && stamp == s.stamp {
+		return s.dir, nil
+	}
+
+	data, err := fs.ReadFile(s.fsys, s.name)
+	if err != nil {
+		return nil, err
+	}
+	dir := newOrgDir(data)
+	dir.scan()
+	close(dir.done)
+	if dir.err != nil {
+		return nil, dir.err
+	}
+
+	versions := make(map[string]string, len(dir.first))
+	for orgKey := range dir.first {
+		orgDetails, _ := dir.details(orgKey)
+		versions[orgKey] = fmt.Sprint(crc32.Checksum(orgDetails, castagnoli))
+	}
+
+	s.stamp, s.dir, s.versions = stamp, dir, versions
+	return dir, nil
+}
+
+func (s *fsSource) OrgVersions() (map[string]string, error) {
+	info, err := fs.Stat(s.fsys, s.name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return s.fileVersions()
+	}
+
+	if _, err := s.dataDir(); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.versions, nil
+}
+
+// fileVersions returns the checksums of the files of the directory by org, reading only the files which changed.
+func (s *fsSource) fileVersions() (map[string]string, error) {
+	entries, err := fs.ReadDir(s.fsys, s.name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sums := make(map[string]fileSum, len(entries))
+	versions := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed meanwhile.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sum, ok := s.sums[entry.Name()]
+		if !ok || sum.modTime != info.ModTime().UnixNano() || sum.size != info.Size() {
+			// Written to after `Info`, its modification time changes again and it is read again next time.
+			data, err := fs.ReadFile(s.fsys, path.Join(s.name, entry.Name()))
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			sum = fileSum{modTime: info.ModTime().UnixNano(), size: info.Size(), crc: crc32.Checksum(data, castagnoli)}
+		}
+		sums[entry.Name()] = sum
+		versions[strings.TrimSuffix(entry.Name(), ".json")] = fmt.Sprint(sum.crc)
+	}
+	s.sums = sums
+	return versions, nil
+}
+
+func (s *fsSource) Org(orgKey string) (map[string][]ParamSeg, error) {
+	info, err := fs.Stat(s.fsys, s.name)
+	if err != nil {
+		return nil, err
+	}
+
+	var orgDetails []byte
+	if info.IsDir() {
+		// A key which isn't a file name can't be that of a file.
+		if strings.ContainsAny(orgKey, `/\`) || orgKey == "" || orgKey == "." || orgKey == ".." {
+			return nil, nil
+		}
+		orgDetails, err = fs.ReadFile(s.fsys, path.Join(s.name, orgKey+".json"))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Read again if it changed since, as by `OrgKeys`.
+		dir, err := s.dataDir()
+		if err != nil {
+			return nil, err
+		}
+
+		var ok bool
+		if orgDetails, ok = dir.details(orgKey); !ok {
+			return nil, nil
+		}
+	}
+
+	strs := newStrTable()
+	paramMap, err := parseOrgDetails(strs, orgDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	segMap := make(map[string][]ParamSeg, len(paramMap))
+	for paramKey, rules := range paramMap {
+		segs := make([]ParamSeg, 0, rules.len())
+		for rule, val := range rules.vals {
+			segs = append(segs, ParamSeg{ParamVal: val, SegId: strs.str(rules.segIds[rule])})
+		}
+		segMap[paramKey] = segs
+	}
+	return segMap, nil
+}
+
+func (s *fsSource) Watch(ctx context.Context, changed func()) error {
+	s.lock.Lock()
+	stamp, err := s.currentStamp()
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.poll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		s.lock.Lock()
+		res, err := s.currentStamp()
+		s.lock.Unlock()
+		// Possibly being replaced, it is looked at again next time.
+		if err != nil || res == stamp {
+			continue
+		}
+		stamp = res
+		changed()
+	}
+}
+
+// currentStamp sums up the modification times and sizes of the files of the source, `s.lock` must be held.
+func (s *fsSource) currentStamp() (string, error) {
+	info, err := fs.Stat(s.fsys, s.name)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return fmt.Sprintf("%d %d", info.ModTime().UnixNano(), info.Size()), nil
+	}
+
+	entries, err := fs.ReadDir(s.fsys, s.name)
+	if err != nil {
+		return "", err
+	}
+	h := crc32.New(castagnoli)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %d %d\n", entry.Name(), info.ModTime().UnixNano(), info.Size())
+	}
+	return fmt.Sprint(h.Sum32()), nil
+}
@@ -0,0 +1,276 @@
+package lookupcache
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//go:embed testdata/orgs
+var testOrgFiles embed.FS
+
+// TestJSONFileSource checks that a cache of the source of the data file finds what `Ec` finds.
+func TestJSONFileSource(t *testing.T) {
+	ec := NewFromSource(NewJSONFileSource(DefaultDataFile))
+
+	orgKeys, err := ec.OrgKeys()
+	if err != nil {
+		t.Fatalf("`OrgKeys` failed with error %s", err)
+	}
+	expect, _ := Ec.OrgKeys()
+	if len(orgKeys) != len(expect) {
+		t.Fatalf("`OrgKeys` returned %d orgs, expected %d", len(orgKeys), len(expect))
+	}
+
+	for _, orgKey := range orgKeys {
+		for _, paramKey := range Ec.ParamKeys(orgKey) {
+			res, expect := ec.ParamSegs(orgKey, paramKey), Ec.ParamSegs(orgKey, paramKey)
+			if len(res) != len(expect) {
+				t.Fatalf("`ParamSegs` of %s of %s returned %v, expected %v", paramKey, orgKey, res, expect)
+			}
+			for idx := range res {
+				if res[idx] != expect[idx] {
+					t.Fatalf("`ParamSegs` of %s of %s returned %v, expected %v", paramKey, orgKey, res, expect)
+				}
+			}
+		}
+	}
+
+	for _, test := range GetSegmentForOrgAndKeyAndValBasicTests {
+		if res := ec.GetSegmentForOrgAndKeyAndVal(test.orgKey, test.paramKey, test.paramVal); !compareSliceOfSegmentConfig(test.expect, res) {
+			t.Errorf("%s: `GetSegmentForOrgAndKeyAndVal` returned %s, expected %s", test.desc, res, test.expect)
+		}
+	}
+}
+
+func TestDirSources(t *testing.T) {
+	for desc, src := range map[string]SegmentSource{
+		"directory": NewDirSource("testdata/orgs"),
+		"embedded":  NewFSSource(testOrgFiles, "testdata/orgs"),
+	} {
+		ec := NewFromSource(src)
+
+		if res, err := ec.OrgKeys(); err != nil || len(res) != 2 || res[0] != "1a9n4ou" || res[1] != "6lkb2cv" {
+			t.Errorf("%s: `OrgKeys` returned %s and %v, expected [1a9n4ou 6lkb2cv]", desc, res, err)
+		}
+		if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "age", "19"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.ag.18-20"}}, res) {
+			t.Errorf("%s: `GetSegmentForOrgAndKeyAndVal` returned %s, expected [{dem.ag.18-20}]", desc, res)
+		}
+		if res := ec.GetSegmentForOrgAndKeyAndVal("1a9n4ou", "edu", "college"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.edu.c"}}, res) {
+			t.Errorf("%s: `GetSegmentForOrgAndKeyAndVal` returned %s, expected [{dem.edu.c}]", desc, res)
+		}
+		for _, orgKey := range []string{"nonexistent", "../orgs/6lkb2cv", ""} {
+			if res := ec.ParamKeys(orgKey); res != nil {
+				t.Errorf("%s: `ParamKeys` of %q returned %s, expected nil", desc, orgKey, res)
+			}
+		}
+	}
+}
+
+func TestWatchSource(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.json")
+	if err := ioutil.WriteFile(path, []byte(`[{"6lkb2cv": [{"gen": [{"Female": {"segmentId": "dem.g.f"}}]}]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ec := NewFromSource(&fsSource{fsys: os.DirFS(dir), name: "data.json", poll: 10 * time.Millisecond})
+	if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "gen", "Female"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.g.f"}}, res) {
+		t.Fatalf("`GetSegmentForOrgAndKeyAndVal` returned %s, expected [{dem.g.f}]", res)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watched := make(chan error)
+	go func() { watched <- ec.WatchSource(ctx) }()
+
+	// Give the watch the time to look at the file as it is.
+	time.Sleep(50 * time.Millisecond)
+	if err := ioutil.WriteFile(path, []byte(`[{"6lkb2cv": [{"gen": [{"Female": {"segmentId": "dem.g.female"}}]}]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "gen", "Female")
+		if compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.g.female"}}, res) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("`GetSegmentForOrgAndKeyAndVal` still returned %s after the change", res)
+		}
+	}
+
+	cancel()
+	if err := <-watched; err != context.Canceled {
+		t.Errorf("`WatchSource` returned %v, expected %v", err, context.Canceled)
+	}
+
+	if err := New(nil).WatchSource(context.Background()); err == nil {
+		t.Errorf("`WatchSource` of a cache without a source succeeded")
+	}
+}
+
+func TestReloadChanged(t *testing.T) {
+	dir := t.TempDir()
+	writeOrg := func(orgKey, details string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, orgKey+".json"), []byte(details), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeOrg("1a9n4ou", `[{"edu": [{"college": {"segmentId": "dem.edu.c"}}]}]`)
+	writeOrg("6lkb2cv", `[{"gen": [{"Female": {"segmentId": "dem.g.f"}}]}]`)
+	writeOrg("7ahk3pz", `[{"gen": [{"Male": {"segmentId": "dem.g.m"}}]}]`)
+
+	ec := NewFromSource(NewDirSource(dir))
+	for _, orgKey := range []string{"1a9n4ou", "6lkb2cv", "7ahk3pz"} {
+		if res := ec.ParamKeys(orgKey); len(res) != 1 {
+			t.Fatalf("`ParamKeys` of %s returned %s, expected a single param", orgKey, res)
+		}
+	}
+
+	// One shard changed, one merely touched, one removed and one added.
+	writeOrg("6lkb2cv", `[{"gen": [{"Female": {"segmentId": "dem.g.female"}}]}]`)
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "1a9n4ou.json"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "7ahk3pz.json")); err != nil {
+		t.Fatal(err)
+	}
+	writeOrg("9xcv2kd", `[{"edu": [{"phd": {"segmentId": "dem.edu.p"}}]}]`)
+
+	if err := ec.ReloadChanged(); err != nil {
+		t.Fatalf("`ReloadChanged` failed with error %s", err)
+	}
+	// Only the changed shard kept parsed is parsed again.
+	if res := ec.Stats().Loads; res != 4 {
+		t.Errorf("%d orgs parsed, expected 4", res)
+	}
+
+	if res := ec.GetSegmentForOrgAndKeyAndVal("6lkb2cv", "gen", "Female"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.g.female"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` returned %s, expected [{dem.g.female}]", res)
+	}
+	if res := ec.GetSegmentForOrgAndKeyAndVal("1a9n4ou", "edu", "college"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.edu.c"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` returned %s, expected [{dem.edu.c}]", res)
+	}
+	if res := ec.Stats().Loads; res != 4 {
+		t.Errorf("%d orgs parsed after the lookups, expected 4", res)
+	}
+
+	if res := ec.ParamKeys("7ahk3pz"); res != nil {
+		t.Errorf("`ParamKeys` of a removed shard returned %s, expected nil", res)
+	}
+	if res := ec.GetSegmentForOrgAndKeyAndVal("9xcv2kd", "edu", "phd"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "dem.edu.p"}}, res) {
+		t.Errorf("`GetSegmentForOrgAndKeyAndVal` of an added shard returned %s, expected [{dem.edu.p}]", res)
+	}
+	if res, err := ec.OrgKeys(); err != nil || len(res) != 3 || res[2] != "9xcv2kd" {
+		t.Errorf("`OrgKeys` returned %s and %v, expected [1a9n4ou 6lkb2cv 9xcv2kd]", res, err)
+	}
+
+	if res := ec.RulesForSegment("dem.g.female"); len(res) != 1 || res[0].OrgKey != "6lkb2cv" {
+		t.Errorf("`RulesForSegment` returned %v, expected the rule of 6lkb2cv", res)
+	}
+	if res := ec.RulesForSegment("dem.g.m"); len(res) != 0 {
+		t.Errorf("`RulesForSegment` returned %v for the segment of a removed shard, expected nothing", res)
+	}
+}
+
+func TestReloadChangedBounded(t *testing.T) {
+	dir := t.TempDir()
+	for _, orgKey := range []string{"1a9n4ou", "6lkb2cv", "7ahk3pz"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, orgKey+".json"), []byte(`[{"gen": [{"Female": {"segmentId": "dem.g.f"}}]}]`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ec := NewFromSource(NewDirSource(dir), WithMaxOrgs(2))
+	ec.GetSegmentForOrgAndKey("1a9n4ou", "gen")
+	ec.GetSegmentForOrgAndKey("6lkb2cv", "gen")
+
+	if err := os.Remove(filepath.Join(dir, "1a9n4ou.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ec.ReloadChanged(); err != nil {
+		t.Fatalf("`ReloadChanged` failed with error %s", err)
+	}
+
+	// The org removed isn't picked as a victim, 6lkb2cv is kept along with the org added.
+	ec.GetSegmentForOrgAndKey("7ahk3pz", "gen")
+	if res := ec.Stats(); res.Orgs != 2 || res.Evictions != 0 {
+		t.Errorf("`Stats` returned %+v, expected 2 orgs and no evictions", res)
+	}
+	if _, ok := ec.orgs["6lkb2cv"]; !ok {
+		t.Errorf("6lkb2cv isn't kept parsed")
+	}
+}
+
+// churnSource is a `VersionedSource` of a single org, whose segment ids all change with its version.
+type churnSource struct {
+	version int
+}
+
+func (s *churnSource) OrgKeys() ([]string, error) {
+	return []string{"1a9n4ou"}, nil
+}
+
+func (s *churnSource) Org(orgKey string) (map[string][]ParamSeg, error) {
+	segs := make([]ParamSeg, 0, 100)
+	for val := 0; val < 100; val++ {
+		segs = append(segs, ParamSeg{ParamVal: fmt.Sprint(val), SegId: fmt.Sprintf("seg.%d.%d", s.version, val)})
+	}
+	return map[string][]ParamSeg{"age": segs}, nil
+}
+
+func (s *churnSource) Watch(ctx context.Context, changed func()) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *churnSource) OrgVersions() (map[string]string, error) {
+	return map[string]string{"1a9n4ou": fmt.Sprint(s.version)}, nil
+}
+
+// TestReloadChangedStrings checks that the strings of the orgs changed don't pile up in the string table.
+func TestReloadChangedStrings(t *testing.T) {
+	src := &churnSource{}
+	ec := NewFromSource(src)
+
+	for version := 0; version < 100; version++ {
+		src.version = version
+		if err := ec.ReloadChanged(); err != nil {
+			t.Fatalf("`ReloadChanged` failed with error %s", err)
+		}
+		expect := []SegmentConfig{{Id: fmt.Sprintf("seg.%d.42", version)}}
+		if res := ec.GetSegmentForOrgAndKeyAndVal("1a9n4ou", "age", "42"); !compareSliceOfSegmentConfig(expect, res) {
+			t.Fatalf("`GetSegmentForOrgAndKeyAndVal` of version %d returned %s, expected %s", version, res, expect)
+		}
+		if res := ec.strs.len(); res >= 2*minCompactStrs {
+			t.Fatalf("the string table holds %d strings after %d reloads, the org only 101", res, version+1)
+		}
+	}
+}
+
+// TestJSONFileSourceChanged checks that an org is fetched from the data file as it is now, not as it was listed.
+func TestJSONFileSourceChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	if err := ioutil.WriteFile(path, []byte(`[{"6lkb2cv": [{"gen": [{"Female": {"segmentId": "dem.g.f"}}]}]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := NewJSONFileSource(path)
+	if _, err := src.OrgKeys(); err != nil {
+		t.Fatalf("`OrgKeys` failed with error %s", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(`[{"6lkb2cv": [{"gen": [{"Female": {"segmentId": "dem.g.female"}}]}]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := src.Org("6lkb2cv")
+	if err != nil || len(res["gen"]) != 1 || res["gen"][0].SegId != "dem.g.female" {
+		t.Errorf("`Org` returned %v and %v, expected the rules of the file as changed", res, err)
+	}
+}
@@ -0,0 +1,352 @@
+package lookupcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// The snapshot file, all integers but those of the header and the trailer being uvarints:
+//
+//	magic      8 bytes, `snapshotMagic`
+//	version    uint32, `snapshotVersion`
+//	data size  uint64, the size of the data file it was built from
+//	data crc   uint32, the CRC-32C of that data file
+//	rules size uint64, the size of the sidecar rules file of `NumericRules` the cache had, 0 without one
+//	rules crc  uint32, the CRC-32C of that file
+//	strings    count, then the length and bytes of every string, which the rest refers to by index
+//	listings   count, then the key, offset and length of the details of every org as listed in the data file
+//	orgs       count, then for every org its key and number of params, for every param its key and number of rules,
+//	           for every rule its value and segment id
+//	trailer    uint32, the CRC-32C of all the above
+//
+// Fixed size integers are little endian.
+const (
+	snapshotMagic   = "JLCSNAP\x00"
+	snapshotVersion = 2
+)
+
+var (
+	// ErrSnapshotStale is returned by `SnapshotError` when the snapshot file isn't that of the data of the cache,
+	// or of its numeric rules.
+	ErrSnapshotStale = errors.New("lookupcache: snapshot of other data")
+	// ErrSnapshotCorrupt is returned by `SnapshotError` when the snapshot file isn't a valid one of this version.
+	ErrSnapshotCorrupt = errors.New("lookupcache: corrupt snapshot")
+)
+
+// WithSnapshotFile makes the cache read the orgs parsed from the snapshot file at `path`, written by
+// `WriteSnapshot`, rather than parse them out of the data, and again on every `Reload`. The snapshot is ignored
+// if it can't be read or isn't that of the data, the data is then parsed as usual, see `SnapshotError`.
+// It must have been written by a cache with the same `NumericRules`, the rules of which it holds, it is stale
+// otherwise.
+func WithSnapshotFile(path string) Option {
+	return func(ec *Cache) {
+		ec.snapshotFile = path
+	}
+}
+
+// SnapshotError returns why the snapshot file of `WithSnapshotFile` wasn't used for the current data,
+// nil if it was or there is none.
+func (ec *Cache) SnapshotError() error {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	return ec.snapshotErr
+}
+
+// WriteSnapshot writes all the orgs of the data, parsed, to `w`, to be read back by `WithSnapshotFile`.
+// It fails if any part of the data doesn't parse.
+func (ec *Cache) WriteSnapshot(w io.Writer) error {
+	if len(ec.sources) > 0 || ec.src != nil {
+		return errors.New("lookupcache: no snapshot of several sources, or of a source other than a data file")
+	}
+
+	var errs []error
+	orgKeys := make([]string, 0)
+	entries := make(map[string]*orgEntry)
+
+	dir := ec.eachOrg(func(orgKey string, entry *orgEntry, err error) {
+		if err != nil {
+			errs = append(errs, &OrgError{OrgKey: orgKey, Err: err})
+			return
+		}
+		orgKeys = append(orgKeys, orgKey)
+		entries[orgKey] = entry
+	})
+	if dir.err != nil {
+		errs = append(errs, dir.err)
+	}
+	if len(errs) > 0 {
+		return &LoadError{Errs: errs}
+	}
+
+	sw := newSnapshotWriter()
+
+	// The strings go first, they are all known once the rest is laid out.
+	var body []byte
+	body = binary.AppendUvarint(body, uint64(len(dir.keys)))
+	for listing, orgKey := range dir.keys {
+		span := dir.spans[listing]
+		body = sw.appendString(body, orgKey)
+		body = binary.AppendUvarint(body, uint64(span.offset))
+		body = binary.AppendUvarint(body, uint64(span.length))
+	}
+
+	body = binary.AppendUvarint(body, uint64(len(orgKeys)))
+	for _, orgKey := range orgKeys {
+		params := entries[orgKey].params
+
+		paramKeys := make([]string, 0, len(params))
+		for paramKey := range params {
+			paramKeys = append(paramKeys, paramKey)
+		}
+		sort.Strings(paramKeys)
+
+		body = sw.appendString(body, orgKey)
+		body = binary.AppendUvarint(body, uint64(len(paramKeys)))
+		for _, paramKey := range paramKeys {
+			segs := params[paramKey].segs()
+			body = sw.appendString(body, paramKey)
+			body = binary.AppendUvarint(body, uint64(len(segs)))
+			for _, seg := range segs {
+				body = sw.appendString(body, seg.ParamVal)
+				body = sw.appendString(body, seg.SegId)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(snapshotMagic)
+	binary.Write(&buf, binary.LittleEndian, uint32(snapshotVersion))
+	binary.Write(&buf, binary.LittleEndian, uint64(len(dir.data)))
+	binary.Write(&buf, binary.LittleEndian, crc32.Checksum(dir.data, castagnoli))
+	rulesSize, rulesCrc := ec.rulesFingerprint()
+	binary.Write(&buf, binary.LittleEndian, rulesSize)
+	binary.Write(&buf, binary.LittleEndian, rulesCrc)
+
+	var count [binary.MaxVarintLen64]byte
+	buf.Write(count[:binary.PutUvarint(count[:], uint64(len(sw.strs)))])
+	for _, str := range sw.strs {
+		buf.Write(count[:binary.PutUvarint(count[:], uint64(len(str)))])
+		buf.WriteString(str)
+	}
+	buf.Write(body)
+	binary.Write(&buf, binary.LittleEndian, crc32.Checksum(buf.Bytes(), castagnoli))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// snapshotWriter interns the strings of a snapshot.
+type snapshotWriter struct {
+	strs []string
+	idxs map[string]uint64
+}
+
+func newSnapshotWriter() *snapshotWriter {
+	return &snapshotWriter{idxs: make(map[string]uint64)}
+}
+
+// appendString appends the index of `str` in the strings of the snapshot to `body`.
+func (sw *snapshotWriter) appendString(body []byte, str string) []byte {
+	idx, ok := sw.idxs[str]
+	if !ok {
+		idx = uint64(len(sw.strs))
+		sw.strs = append(sw.strs, str)
+		sw.idxs[str] = idx
+	}
+	return binary.AppendUvarint(body, idx)
+}
+
+// snapshot is what a snapshot file holds, the directory and the orgs of the data, whose strings are those of `strs`.
+type snapshot struct {
+	strs    *strTable
+	dir     *orgDir
+	orgKeys []string
+	entries []*orgEntry
+}
+
+// readSnapshotFile reads the snapshot file at `path` for `data`, and the sidecar rules file of size `rulesSize`
+// and CRC-32C `rulesCrc`, see `rulesFingerprint`.
+func readSnapshotFile(path string, data []byte, rulesSize uint64, rulesCrc uint32) (*snapshot, error) {
+	res, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	const headerLen, trailerLen = len(snapshotMagic) + 4 + 8 + 4 + 8 + 4, 4
+	if len(res) < headerLen+trailerLen || string(res[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, ErrSnapshotCorrupt
+	}
+	if binary.LittleEndian.Uint32(res[len(snapshotMagic):]) != snapshotVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrSnapshotCorrupt, binary.LittleEndian.Uint32(res[len(snapshotMagic):]))
+	}
+	if binary.LittleEndian.Uint32(res[len(res)-trailerLen:]) != crc32.Checksum(res[:len(res)-trailerLen], castagnoli) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt)
+	}
+	if binary.LittleEndian.Uint64(res[len(snapshotMagic)+4:]) != uint64(len(data)) ||
+		binary.LittleEndian.Uint32(res[len(snapshotMagic)+12:]) != crc32.Checksum(data, castagnoli) {
+		return nil, ErrSnapshotStale
+	}
+	if binary.LittleEndian.Uint64(res[len(snapshotMagic)+16:]) != rulesSize ||
+		binary.LittleEndian.Uint32(res[len(snapshotMagic)+24:]) != rulesCrc {
+		return nil, fmt.Errorf("%w: built with other numeric rules", ErrSnapshotStale)
+	}
+
+	sr := &snapshotReader{buf: res[headerLen : len(res)-trailerLen]}
+
+	strs := make([]string, sr.count())
+	for idx := range strs {
+		strs[idx] = string(sr.bytes(sr.count()))
+	}
+	sr.strs = strs
+
+	// The ids of the strings are their indices in the snapshot.
+	snap := &snapshot{strs: newStrTableOf(strs), dir: newOrgDir(data)}
+	close(snap.dir.done)
+	for listing, listings := 0, sr.count(); listing < listings; listing++ {
+		orgKey, offset, length := sr.str(), sr.uvarint(), sr.uvarint()
+		if offset > uint64(len(data)) || length > uint64(len(data))-offset {
+			sr.fail()
+		}
+		if sr.err != nil {
+			return nil, sr.err
+		}
+		snap.dir.add(orgKey, orgSpan{offset: int(offset), length: int(length)})
+	}
+
+	for org, orgs := 0, sr.count(); org < orgs && sr.err == nil; org++ {
+		orgKey := sr.str()
+		params := make(map[string]*paramRules)
+		for param, paramCount := 0, sr.count(); param < paramCount && sr.err == nil; param++ {
+			rules := &paramRules{}
+			params[sr.str()] = rules
+			for seg, segCount := 0, sr.count(); seg < segCount && sr.err == nil; seg++ {
+				rules.add(sr.str(), sr.id())
+			}
+		}
+		if sr.err != nil {
+			break
+		}
+		snap.orgKeys = append(snap.orgKeys, orgKey)
+		snap.entries = append(snap.entries, newOrgEntry(snap.strs, orgKey, params))
+	}
+	if sr.err == nil && len(sr.buf) > 0 {
+		sr.fail()
+	}
+	if sr.err != nil {
+		return nil, sr.err
+	}
+
+	return snap, nil
+}
+
+// snapshotReader reads the body of a snapshot, the first error sticks and makes all the reads return zero values.
+type snapshotReader struct {
+	buf  []byte
+	strs []string
+	err  error
+}
+
+func (sr *snapshotReader) fail() {
+	if sr.err == nil {
+		sr.err = fmt.Errorf("%w: truncated or malformed", ErrSnapshotCorrupt)
+	}
+	sr.buf = nil
+}
+
+func (sr *snapshotReader) uvarint() uint64 {
+	val, n := binary.Uvarint(sr.buf)
+	if n <= 0 {
+		sr.fail()
+		return 0
+	}
+	sr.buf = sr.buf[n:]
+	return val
+}
+
+// count reads a count or a length, which can't be larger than what is left to read.
+func (sr *snapshotReader) count() int {
+	val := sr.uvarint()
+	if val > uint64(len(sr.buf)) {
+		sr.fail()
+		return 0
+	}
+	return int(val)
+}
+
+func (sr *snapshotReader) bytes(n int) []byte {
+	if n > len(sr.buf) {
+		sr.fail()
+		return nil
+	}
+	res := sr.buf[:n]
+	sr.buf = sr.buf[n:]
+	return res
+}
+
+func (sr *snapshotReader) str() string {
+	id := sr.id()
+	if sr.err != nil {
+		return ""
+	}
+	return sr.strs[id]
+}
+
+// id reads the index of a string.
+func (sr *snapshotReader) id() uint32 {
+	idx := sr.uvarint()
+	if idx >= uint64(len(sr.strs)) {
+		sr.fail()
+		return 0
+	}
+	return uint32(idx)
+}
+
+// readSnapshot reads the snapshot file for `data`, if any.
+func (ec *Cache) readSnapshot(data []byte) (*snapshot, error) {
+	if ec.snapshotFile == "" {
+		return nil, nil
+	}
+	if len(ec.sources) > 0 || ec.src != nil {
+		return nil, fmt.Errorf("%w: it holds the data only, not the other sources", ErrSnapshotStale)
+	}
+	rulesSize, rulesCrc := ec.rulesFingerprint()
+	return readSnapshotFile(ec.snapshotFile, data, rulesSize, rulesCrc)
+}
+
+// rulesFingerprint returns the size and CRC-32C of the sidecar rules file of the cache, zeros without one.
+func (ec *Cache) rulesFingerprint() (uint64, uint32) {
+	if ec.sidecar == nil {
+		return 0, 0
+	}
+	return uint64(len(ec.sidecar.data)), crc32.Checksum(ec.sidecar.data, castagnoli)
+}
+
+// restoreSnapshot keeps the orgs of `snap` parsed if it could be read, `ec.lock` must be held for writing.
+func (ec *Cache) restoreSnapshot(snap *snapshot, err error) {
+	ec.snapshotErr = err
+	if err != nil || snap == nil {
+		return
+	}
+
+	if !ec.bounded() {
+		ec.strs = snap.strs
+	}
+	ec.dir = snap.dir
+	// A cache with a capacity may evict some of them on the way.
+	ec.complete = !ec.bounded()
+	for idx, orgKey := range snap.orgKeys {
+		entry := snap.entries[idx]
+		if ec.bounded() {
+			// Not to keep the strings of all the orgs of the snapshot, see `parseOrg`.
+			entry = ownStrings(orgKey, entry)
+		}
+		ec.addOrg(orgKey, entry)
+	}
+}
@@ -0,0 +1,192 @@
+package lookupcache
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+)
+
+func TestSnapshot(t *testing.T) {
+	data, err := ioutil.ReadFile(DefaultDataFile)
+	if err != nil {
+		t.Fatalf("reading the data file failed with error %s", err)
+	}
+
+	parsed := New(data)
+	var buf bytes.Buffer
+	if err := parsed.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("`WriteSnapshot` failed with error %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "data.snap")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("writing the snapshot failed with error %s", err)
+	}
+
+	ec := New(data, WithSnapshotFile(path))
+	if err := ec.SnapshotError(); err != nil {
+		t.Fatalf("the snapshot wasn't used: %s", err)
+	}
+
+	orgKeys, err := ec.OrgKeys()
+	if err != nil {
+		t.Fatalf("`OrgKeys` failed with error %s", err)
+	}
+	expectKeys, _ := parsed.OrgKeys()
+	if len(orgKeys) != len(expectKeys) {
+		t.Fatalf("`OrgKeys` returned %d orgs, expected %d", len(orgKeys), len(expectKeys))
+	}
+	for idx, orgKey := range expectKeys {
+		if orgKeys[idx] != orgKey {
+			t.Errorf("org %d is %s, expected %s", idx, orgKeys[idx], orgKey)
+		}
+		for _, paramKey := range parsed.ParamKeys(orgKey) {
+			expect, res := parsed.ParamSegs(orgKey, paramKey), ec.ParamSegs(orgKey, paramKey)
+			if len(expect) != len(res) {
+				t.Errorf("%s of %s has %d rules, expected %d", paramKey, orgKey, len(res), len(expect))
+				continue
+			}
+			for segIdx := range expect {
+				if expect[segIdx] != res[segIdx] {
+					t.Errorf("rule %d of %s of %s is %v, expected %v", segIdx, paramKey, orgKey, res[segIdx], expect[segIdx])
+				}
+			}
+		}
+	}
+	if expect, res := parsed.RulesForSegment("dem.g.f"), ec.RulesForSegment("dem.g.f"); !compareSliceOfRule(expect, res) {
+		t.Errorf("`RulesForSegment` returned %v, expected %v", res, expect)
+	}
+
+	// Nothing parsed, nor even scanned.
+	if parses, scans := atomic.LoadInt64(&ec.parses), atomic.LoadInt64(&ec.scans); parses != 0 || scans != 0 {
+		t.Errorf("%d orgs were parsed and the data scanned %d times, expected none", parses, scans)
+	}
+
+	// Same strings, same memory.
+	segIds := make(map[string]*byte)
+	for _, orgKey := range orgKeys {
+		for _, paramKey := range ec.ParamKeys(orgKey) {
+			for _, seg := range ec.ParamSegs(orgKey, paramKey) {
+				if data, ok := segIds[seg.SegId]; ok && data != unsafe.StringData(seg.SegId) {
+					t.Errorf("the segment id %s of %s of %s isn't interned", seg.SegId, paramKey, orgKey)
+				}
+				segIds[seg.SegId] = unsafe.StringData(seg.SegId)
+			}
+		}
+	}
+
+	// Evicted orgs are parsed again from the data.
+	bounded := New(data, WithSnapshotFile(path), WithMaxOrgs(10))
+	if expect, res := parsed.GetSegmentForOrgAndKey("6lkb2cv", "gen"), bounded.GetSegmentForOrgAndKey("6lkb2cv", "gen"); !compareSliceOfSegmentConfig(expect, res) {
+		t.Errorf("`GetSegmentForOrgAndKey` of an evicted org returned %s, expected %s", res, expect)
+	}
+}
+
+var SnapshotFallbackTests = []struct {
+	desc    string
+	corrupt func(snap []byte) []byte
+	expect  error
+}{
+	{"stale", nil, ErrSnapshotStale},
+	{"truncated", func(snap []byte) []byte { return snap[:len(snap)/2] }, ErrSnapshotCorrupt},
+	{"flipped bit", func(snap []byte) []byte { snap[len(snap)/2] ^= 1; return snap }, ErrSnapshotCorrupt},
+	{"other version", func(snap []byte) []byte { snap[len(snapshotMagic)]++; return snap }, ErrSnapshotCorrupt},
+	{"not a snapshot", func(snap []byte) []byte { return []byte(rulesTestData) }, ErrSnapshotCorrupt},
+}
+
+func TestSnapshotFallback(t *testing.T) {
+	for _, tt := range SnapshotFallbackTests {
+		var buf bytes.Buffer
+		if err := New([]byte(rulesTestData)).WriteSnapshot(&buf); err != nil {
+			t.Fatalf("%s: `WriteSnapshot` failed with error %s", tt.desc, err)
+		}
+		snap, data := buf.Bytes(), []byte(rulesTestData)
+		if tt.corrupt != nil {
+			snap = tt.corrupt(snap)
+		} else {
+			data = []byte(rulesTestDataReloaded)
+		}
+
+		path := filepath.Join(t.TempDir(), "data.snap")
+		if err := ioutil.WriteFile(path, snap, 0644); err != nil {
+			t.Fatalf("%s: writing the snapshot failed with error %s", tt.desc, err)
+		}
+
+		ec := New(data, WithSnapshotFile(path))
+		if err := ec.SnapshotError(); !errors.Is(err, tt.expect) {
+			t.Errorf("%s: `SnapshotError` returned %v, expected %v", tt.desc, err, tt.expect)
+		}
+		if res := ec.GetSegmentForOrgAndKey("1a9n4ou", "edu"); !compareSliceOfSegmentConfig([]SegmentConfig{{Id: "intr.edu"}}, res) {
+			t.Errorf("%s: `GetSegmentForOrgAndKey` returned %s, expected [{intr.edu}]", tt.desc, res)
+		}
+	}
+}
+
+// TestSnapshotRules checks that a snapshot is only read by a cache with the numeric rules it was written with.
+func TestSnapshotRules(t *testing.T) {
+	withRules := func(data string) Option {
+		opt, err := NumericRules([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return opt
+	}
+	rules := withRules(`[{"1a9n4ou": [{"age": [{"num:18-24": {"segmentId": "dem.ag.18-24"}}]}]}]`)
+
+	var buf bytes.Buffer
+	if err := New([]byte(rulesTestData), rules).WriteSnapshot(&buf); err != nil {
+		t.Fatalf("`WriteSnapshot` failed with error %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "data.snap")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for desc, tt := range map[string]struct {
+		opts   []Option
+		expect error
+	}{
+		"same rules":  {opts: []Option{rules}},
+		"no rules":    {expect: ErrSnapshotStale},
+		"other rules": {opts: []Option{withRules(`[{"1a9n4ou": [{"age": [{"num:25-34": {"segmentId": "dem.ag.25-34"}}]}]}]`)}, expect: ErrSnapshotStale},
+	} {
+		ec := New([]byte(rulesTestData), append(tt.opts, WithSnapshotFile(path))...)
+		if err := ec.SnapshotError(); !errors.Is(err, tt.expect) {
+			t.Errorf("%s: `SnapshotError` returned %v, expected %v", desc, err, tt.expect)
+		}
+	}
+}
+
+func TestSnapshotReload(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New([]byte(rulesTestDataReloaded)).WriteSnapshot(&buf); err != nil {
+		t.Fatalf("`WriteSnapshot` failed with error %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "data.snap")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("writing the snapshot failed with error %s", err)
+	}
+
+	ec := New([]byte(rulesTestData), WithSnapshotFile(path))
+	if err := ec.SnapshotError(); !errors.Is(err, ErrSnapshotStale) {
+		t.Errorf("`SnapshotError` returned %v, expected `ErrSnapshotStale`", err)
+	}
+
+	ec.Reload([]byte(rulesTestDataReloaded))
+	if err := ec.SnapshotError(); err != nil {
+		t.Errorf("`SnapshotError` after reloading the data of the snapshot returned %v, expected nil", err)
+	}
+	if res := ec.RulesForSegment("intr.edu"); len(res) != 1 {
+		t.Errorf("`RulesForSegment` returned %v, expected 1 rule", res)
+	}
+}
+
+func TestWriteSnapshotInvalidData(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New([]byte(`[{"6lkb2cv": [{"gen": [{"Female": {"id": "dem.g.f"}}]}]}]`)).WriteSnapshot(&buf); err == nil {
+		t.Errorf("`WriteSnapshot` of invalid data succeeded, expected an error")
+	}
+}
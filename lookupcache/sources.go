@@ -0,0 +1,208 @@
+package lookupcache
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// MergeMode tells how the rules of a source for a param combine with those of the sources before it.
+type MergeMode int
+
+const (
+	// Override replaces the rules of a param by those of the source, if it has any but tombstones.
+	Override MergeMode = iota
+	// Append adds the rules of the source to those of a param, but those it already has.
+	Append
+)
+
+// TombstonePrefix marks a rule of a source, other than the first, as deleting the rule of the sources before it
+// with the rest of the value and the same segment id, e.g. `del:Female` emitting `dem.g.f` deletes the rule `Female`
+// emitting `dem.g.f`. A param left without rules is deleted too.
+const TombstonePrefix = "del:"
+
+// Source is a data file merged with others by `NewFromSources`.
+type Source struct {
+	// Name is what the segments of its rules are reported to come from, see `GetSegmentForOrgAndKeyAndValWithSource`.
+	Name string
+	Data []byte
+	// Mode is how its rules combine with those of the sources before it, it doesn't matter for the first one.
+	Mode MergeMode
+}
+
+// source is a source merged over the data of a cache, its directory is scanned once and for all.
+type source struct {
+	name string
+	mode MergeMode
+	dir  *orgDir
+}
+
+// SourcedSegment is a segment found by `GetSegmentForOrgAndKeyAndValWithSource`, together with the name of
+// the source of the rule which produced it.
+type SourcedSegment struct {
+	SegmentConfig
+	Source string
+}
+
+// NewFromSources returns a cache over the data files `sources`, in order of precedence from the lowest.
+// The first one is the data of the cache, which `Reload` replaces, the rules of the others are merged with its rules
+// per org and param as the org is parsed, and an org can be in any of them.
+// The sources but the first are scanned right away, an error is returned if one of them isn't valid.
+// A cache with several sources doesn't read or write snapshots, which only hold the data.
+func NewFromSources(sources []Source, opts ...Option) (*Cache, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("lookupcache: no source")
+	}
+	if len(sources) > math.MaxUint16+1 {
+		return nil, fmt.Errorf("lookupcache: %d sources, at most %d", len(sources), math.MaxUint16+1)
+	}
+
+	ec := newCache(opts)
+	ec.data = sources[0].Data
+	ec.sourceNames = []string{sources[0].Name}
+	for _, src := range sources[1:] {
+		dir := newOrgDir(src.Data)
+		dir.scan()
+		close(dir.done)
+		if dir.err != nil {
+			return nil, fmt.Errorf("lookupcache: source %s: %w", src.Name, dir.err)
+		}
+
+		ec.sources = append(ec.sources, &source{name: src.Name, mode: src.Mode, dir: dir})
+		ec.sourceNames = append(ec.sourceNames, src.Name)
+	}
+
+	ec.start()
+	return ec, nil
+}
+
+// GetSegmentForOrgAndKeyAndValWithSource is `GetSegmentForOrgAndKeyAndVal`, also telling which source the rule
+// producing each segment comes from. A cache created otherwise than by `NewFromSources` has a single source,
+// named "".
+func (ec *Cache) GetSegmentForOrgAndKeyAndValWithSource(orgKey string, paramKey string, paramVal string) []SourcedSegment {
+	if orgKey == "" || paramKey == "" {
+		return []SourcedSegment{}
+	}
+
+	entry, ok := ec.org(orgKey)
+	if !ok {
+		return []SourcedSegment{}
+	}
+
+	idx, ok := entry.params[paramKey]
+	if !ok {
+		return []SourcedSegment{}
+	}
+
+	rules := idx.matchRules(ec.paramMatcher(paramKey), paramVal)
+	res := make([]SourcedSegment, 0, len(rules))
+	for _, rule := range rules {
+		res = append(res, SourcedSegment{
+			SegmentConfig: SegmentConfig{Id: idx.strs.str(idx.rules.segIds[rule])},
+			Source:        ec.sourceName(idx.rules.source(int(rule))),
+		})
+	}
+	return res
+}
+
+// sourceName returns the name of the source of index `source`.
+func (ec *Cache) sourceName(source int) string {
+	if source >= len(ec.sourceNames) {
+		return ""
+	}
+	return ec.sourceNames[source]
+}
+
+// addSourceOrgs lists the orgs of the sources which aren't in the data in `dir`, the directory of the data.
+// They have no details in the data.
+func (ec *Cache) addSourceOrgs(dir *orgDir) {
+	for _, src := range ec.sources {
+		for _, orgKey := range src.dir.keys {
+			if _, ok := dir.first[orgKey]; !ok {
+				dir.add(orgKey, orgSpan{offset: -1})
+			}
+		}
+	}
+}
+
+// mergeSources merges the rules of the sources for `orgKey` into `paramMap`, the rules of the org in the data,
+// one source after the other. Their param keys and segment ids are interned in `strs`.
+func (ec *Cache) mergeSources(strs *strTable, orgKey string, paramMap map[string]*paramRules) error {
+	for srcIdx, src := range ec.sources {
+		orgDetails, ok := src.dir.details(orgKey)
+		if !ok {
+			continue
+		}
+
+		srcParamMap, err := parseOrgDetails(strs, orgDetails)
+		if err != nil {
+			return fmt.Errorf("source %s: %w", src.name, err)
+		}
+
+		for paramKey, srcRules := range srcParamMap {
+			rules, ok := paramMap[paramKey]
+			if !ok {
+				rules = &paramRules{}
+			}
+			before := rules.len()
+			mergeRules(rules, srcRules, src.mode, srcIdx+1)
+
+			switch {
+			case rules.len() > 0:
+				paramMap[paramKey] = rules
+			case before > 0:
+				// All deleted by tombstones.
+				delete(paramMap, paramKey)
+			}
+		}
+	}
+	return nil
+}
+
+// knownRule is a rule of value `val` emitting the segment of id `segId`.
+type knownRule struct {
+	val   string
+	segId uint32
+}
+
+// mergeRules merges `srcRules`, the rules of a param in the source `source`, into `rules`, those of the param
+// in the sources before it.
+func mergeRules(rules *paramRules, srcRules *paramRules, mode MergeMode, source int) {
+	var tombstones, adds []int
+	for rule, val := range srcRules.vals {
+		if strings.HasPrefix(val, TombstonePrefix) {
+			tombstones = append(tombstones, rule)
+		} else {
+			adds = append(adds, rule)
+		}
+	}
+
+	if mode == Override && len(adds) > 0 {
+		*rules = paramRules{}
+	}
+
+	for _, rule := range tombstones {
+		rules.remove(strings.TrimPrefix(srcRules.vals[rule], TombstonePrefix), srcRules.segIds[rule])
+	}
+
+	// The rules there already.
+	var known map[knownRule]struct{}
+	if mode == Append {
+		known = make(map[knownRule]struct{}, rules.len())
+		for rule, val := range rules.vals {
+			known[knownRule{val, rules.segIds[rule]}] = struct{}{}
+		}
+	}
+
+	for _, rule := range adds {
+		val, segId := srcRules.vals[rule], srcRules.segIds[rule]
+		if known != nil {
+			if _, ok := known[knownRule{val, segId}]; ok {
+				continue
+			}
+			known[knownRule{val, segId}] = struct{}{}
+		}
+		rules.addFrom(val, segId, source)
+	}
+}
@@ -0,0 +1,138 @@
+package lookupcache
+
+import (
+	"testing"
+)
+
+const sourcesTestBase = `[
+  {"1a9n4ou": [
+    {"gen": [{"Female": {"segmentId": "dem.g.f"}}, {"Male": {"segmentId": "dem.g.m"}}]},
+    {"edu": [{"college": {"segmentId": "dem.edu.c"}}, {"graduate": {"segmentId": "dem.edu.g"}}]},
+    {"sub": [{"kids": {"segmentId": "intr.kids"}}]}
+  ]},
+  {"6lkb2cv": [
+    {"gen": [{"Female": {"segmentId": "dem.g.f"}}]}
+  ]}
+]`
+
+// sourcesTestRegion overrides the rules of its params.
+const sourcesTestRegion = `[
+  {"1a9n4ou": [
+    {"gen": [{"Female": {"segmentId": "eu.g.f"}}]},
+    {"sub": [{"del:kids": {"segmentId": "intr.kids"}}]}
+  ]},
+  {"eu0only": [
+    {"gen": [{"Male": {"segmentId": "eu.g.m"}}]}
+  ]}
+]`
+
+// sourcesTestExtra appends to the rules of its params.
+const sourcesTestExtra = `[
+  {"1a9n4ou": [
+    {"edu": [{"college": {"segmentId": "dem.edu.c"}}, {"phd": {"segmentId": "dem.edu.p"}}, {"del:graduate": {"segmentId": "dem.edu.g"}}]},
+    {"gen": [{"Female": {"segmentId": "extra.g.f"}}]}
+  ]}
+]`
+
+var SourcesTests = []struct {
+	desc     string
+	orgKey   string
+	paramKey string
+	paramVal string
+	expect   []SourcedSegment
+}{
+	{
+		desc: "overridden", orgKey: "1a9n4ou", paramKey: "gen", paramVal: "Female",
+		expect: []SourcedSegment{{SegmentConfig{Id: "eu.g.f"}, "eu"}, {SegmentConfig{Id: "extra.g.f"}, "extra"}},
+	},
+	{
+		desc: "overridden away", orgKey: "1a9n4ou", paramKey: "gen", paramVal: "Male",
+		expect: []SourcedSegment{},
+	},
+	{
+		desc: "appended", orgKey: "1a9n4ou", paramKey: "edu", paramVal: "",
+		expect: []SourcedSegment{},
+	},
+	{
+		desc: "appended once", orgKey: "1a9n4ou", paramKey: "edu", paramVal: "college",
+		expect: []SourcedSegment{{SegmentConfig{Id: "dem.edu.c"}, "global"}},
+	},
+	{
+		desc: "appended new", orgKey: "1a9n4ou", paramKey: "edu", paramVal: "phd",
+		expect: []SourcedSegment{{SegmentConfig{Id: "dem.edu.p"}, "extra"}},
+	},
+	{
+		desc: "tombstone", orgKey: "1a9n4ou", paramKey: "edu", paramVal: "graduate",
+		expect: []SourcedSegment{},
+	},
+	{
+		desc: "untouched org", orgKey: "6lkb2cv", paramKey: "gen", paramVal: "Female",
+		expect: []SourcedSegment{{SegmentConfig{Id: "dem.g.f"}, "global"}},
+	},
+	{
+		desc: "org of a source only", orgKey: "eu0only", paramKey: "gen", paramVal: "Male",
+		expect: []SourcedSegment{{SegmentConfig{Id: "eu.g.m"}, "eu"}},
+	},
+}
+
+func newSourcesTestCache(t *testing.T, opts ...Option) *Cache {
+	ec, err := NewFromSources([]Source{
+		{Name: "global", Data: []byte(sourcesTestBase)},
+		{Name: "eu", Data: []byte(sourcesTestRegion), Mode: Override},
+		{Name: "extra", Data: []byte(sourcesTestExtra), Mode: Append},
+	}, opts...)
+	if err != nil {
+		t.Fatalf("`NewFromSources` failed with error %s", err)
+	}
+	return ec
+}
+
+func TestSources(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithLoadMode(Eager)}} {
+		ec := newSourcesTestCache(t, opts...)
+
+		for _, test := range SourcesTests {
+			res := ec.GetSegmentForOrgAndKeyAndValWithSource(test.orgKey, test.paramKey, test.paramVal)
+			if len(res) != len(test.expect) {
+				t.Errorf("%s: `GetSegmentForOrgAndKeyAndValWithSource` returned %v, expected %v", test.desc, res, test.expect)
+				continue
+			}
+			for idx := range res {
+				if res[idx] != test.expect[idx] {
+					t.Errorf("%s: `GetSegmentForOrgAndKeyAndValWithSource` returned %v, expected %v", test.desc, res, test.expect)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestSourcesParams(t *testing.T) {
+	ec := newSourcesTestCache(t)
+
+	// All the rules of `sub` are deleted.
+	if res := ec.ParamKeys("1a9n4ou"); len(res) != 2 || res[0] != "edu" || res[1] != "gen" {
+		t.Errorf("`ParamKeys` returned %s, expected [edu gen]", res)
+	}
+
+	res, err := ec.OrgKeys()
+	if err != nil || len(res) != 3 || res[2] != "eu0only" {
+		t.Errorf("`OrgKeys` returned %s and %v, expected [1a9n4ou 6lkb2cv eu0only]", res, err)
+	}
+
+	// A single source is named "".
+	if res := New([]byte(sourcesTestBase)).GetSegmentForOrgAndKeyAndValWithSource("6lkb2cv", "gen", "Female"); len(res) != 1 || res[0].Source != "" {
+		t.Errorf("`GetSegmentForOrgAndKeyAndValWithSource` of a single source returned %v, expected [{{dem.g.f} }]", res)
+	}
+}
+
+func TestSourcesInvalid(t *testing.T) {
+	if _, err := NewFromSources(nil); err == nil {
+		t.Errorf("`NewFromSources` without sources succeeded")
+	}
+
+	_, err := NewFromSources([]Source{{Name: "global", Data: []byte(sourcesTestBase)}, {Name: "broken", Data: []byte(`[{"1a9n4ou" [`)}})
+	if err == nil {
+		t.Errorf("`NewFromSources` with an invalid source succeeded")
+	}
+}
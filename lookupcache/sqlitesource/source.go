@@ -0,0 +1,239 @@
+// Package sqlitesource keeps the rules of a cache in a SQLite database file, it implements
+// `lookupcache.SegmentSource` for `lookupcache.NewFromSource`.
+//
+// Unlike the rest of the repository, it depends on github.com/mattn/go-sqlite3, which takes cgo and a C compiler
+// to build, `CGO_ENABLED=1`. Without cgo the package builds but `Open` fails.
+package sqlitesource
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/lnshi/json-lookup/lookupcache"
+)
+
+// The orgs are listed in `orgs` in order, their rules in `rules`, in order too. A rule without a value and
+// a segment id stands for a param without rules.
+const schema = `
+CREATE TABLE IF NOT EXISTS orgs (
+	org_key  TEXT PRIMARY KEY,
+	position INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS rules (
+	org_key    TEXT NOT NULL,
+	param_key  TEXT NOT NULL,
+	param_val  TEXT,
+	segment_id TEXT,
+	position   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS rules_org ON rules (org_key, position);
+`
+
+// Source is the source of the rules of the SQLite database file it was opened on.
+type Source struct {
+	db *sql.DB
+
+	// PollInterval is how often `Watch` looks for changes, `lookupcache.DefaultPollInterval` by default.
+	PollInterval time.Duration
+}
+
+var _ lookupcache.SegmentSource = (*Source)(nil)
+
+// Open opens the SQLite database file at `path`, creating it and its tables if need be.
+func Open(path string) (*Source, error) {
+	// A URI, so `path` is escaped: `?` and `#` would otherwise start its query and its fragment.
+	dsn := &url.URL{Scheme: "file", Path: filepath.ToSlash(path), RawQuery: "_busy_timeout=5000"}
+	db, err := sql.Open("sqlite3", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Source{db: db, PollInterval: lookupcache.DefaultPollInterval}, nil
+}
+
+// Close closes the database.
+func (s *Source) Close() error {
+	return s.db.Close()
+}
+
+func (s *Source) OrgKeys() ([]string, error) {
+	rows, err := s.db.Query(`SELECT org_key FROM orgs ORDER BY position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgKeys := make([]string, 0)
+	for rows.Next() {
+		var orgKey string
+		if err := rows.Scan(&orgKey); err != nil {
+			return nil, err
+		}
+		orgKeys = append(orgKeys, orgKey)
+	}
+	return orgKeys, rows.Err()
+}
+
+func (s *Source) Org(orgKey string) (map[string][]lookupcache.ParamSeg, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// Only read from, the rules must be those of the org listed.
+	defer tx.Rollback()
+
+	var position int64
+	err = tx.QueryRow(`SELECT position FROM orgs WHERE org_key = ?`, orgKey).Scan(&position)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT param_key, param_val, segment_id FROM rules WHERE org_key = ? ORDER BY position`, orgKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	segMap := make(map[string][]lookupcache.ParamSeg)
+	for rows.Next() {
+		var paramKey string
+		var paramVal, segId sql.NullString
+		if err := rows.Scan(&paramKey, &paramVal, &segId); err != nil {
+			return nil, err
+		}
+
+		if _, ok := segMap[paramKey]; !ok {
+			segMap[paramKey] = make([]lookupcache.ParamSeg, 0)
+		}
+		if paramVal.Valid && segId.Valid {
+			segMap[paramKey] = append(segMap[paramKey], lookupcache.ParamSeg{ParamVal: paramVal.String, SegId: segId.String})
+		}
+	}
+	return segMap, rows.Err()
+}
+
+// Watch looks for changes made to the database from other connections, or processes, every `PollInterval`.
+func (s *Source) Watch(ctx context.Context, changed func()) error {
+	// `data_version` only changes with the commits of other connections than the one asking.
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	dataVersion := func() (int64, error) {
+		var res int64
+		err := conn.QueryRowContext(ctx, `PRAGMA data_version`).Scan(&res)
+		return res, err
+	}
+
+	version, err := dataVersion()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		res, err := dataVersion()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if res != version {
+			version = res
+			changed()
+		}
+	}
+}
+
+// Import replaces the rules of the database by those of `src`, in a single transaction, e.g. to move the rules of
+// a data file, `lookupcache.NewJSONFileSource`, into the database.
+func (s *Source) Import(src lookupcache.SegmentSource) error {
+	orgKeys, err := src.OrgKeys()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM rules; DELETE FROM orgs`); err != nil {
+		return err
+	}
+
+	insertOrg, err := tx.Prepare(`INSERT OR IGNORE INTO orgs (org_key, position) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertOrg.Close()
+	insertRule, err := tx.Prepare(`INSERT INTO rules (org_key, param_key, param_val, segment_id, position) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertRule.Close()
+
+	for orgPosition, orgKey := range orgKeys {
+		res, err := insertOrg.Exec(orgKey, orgPosition)
+		if err != nil {
+			return err
+		}
+		// Listed twice, only the first listing counts, as in a data file.
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+
+		segMap, err := src.Org(orgKey)
+		if err != nil {
+			return err
+		}
+
+		paramKeys := make([]string, 0, len(segMap))
+		for paramKey := range segMap {
+			paramKeys = append(paramKeys, paramKey)
+		}
+		sort.Strings(paramKeys)
+
+		position := 0
+		for _, paramKey := range paramKeys {
+			if len(segMap[paramKey]) == 0 {
+				if _, err := insertRule.Exec(orgKey, paramKey, nil, nil, position); err != nil {
+					return err
+				}
+				position++
+			}
+			for _, seg := range segMap[paramKey] {
+				if _, err := insertRule.Exec(orgKey, paramKey, seg.ParamVal, seg.SegId, position); err != nil {
+					return err
+				}
+				position++
+			}
+		}
+	}
+
+	return tx.Commit()
+}
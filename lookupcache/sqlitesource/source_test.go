@@ -0,0 +1,125 @@
+package sqlitesource
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lnshi/json-lookup/lookupcache"
+)
+
+const testDataFile = "../../data/data.json"
+
+// TestImport checks that a cache of the database the data file is imported into finds what one of the data file finds.
+func TestImport(t *testing.T) {
+	src, err := Open(filepath.Join(t.TempDir(), "rules.db"))
+	if err != nil {
+		t.Fatalf("`Open` failed with error %s", err)
+	}
+	defer src.Close()
+
+	if err := src.Import(lookupcache.NewJSONFileSource(testDataFile)); err != nil {
+		t.Fatalf("`Import` failed with error %s", err)
+	}
+
+	expect, err := lookupcache.NewFromFile(testDataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec := lookupcache.NewFromSource(src)
+
+	orgKeys, err := ec.OrgKeys()
+	if err != nil {
+		t.Fatalf("`OrgKeys` failed with error %s", err)
+	}
+	if expectKeys, _ := expect.OrgKeys(); len(orgKeys) != len(expectKeys) {
+		t.Fatalf("`OrgKeys` returned %d orgs, expected %d", len(orgKeys), len(expectKeys))
+	}
+
+	for _, orgKey := range orgKeys {
+		paramKeys := ec.ParamKeys(orgKey)
+		if expectKeys := expect.ParamKeys(orgKey); len(paramKeys) != len(expectKeys) {
+			t.Fatalf("`ParamKeys` of %s returned %s, expected %s", orgKey, paramKeys, expectKeys)
+		}
+
+		for _, paramKey := range paramKeys {
+			res, expectSegs := ec.ParamSegs(orgKey, paramKey), expect.ParamSegs(orgKey, paramKey)
+			if len(res) != len(expectSegs) {
+				t.Fatalf("`ParamSegs` of %s of %s returned %v, expected %v", paramKey, orgKey, res, expectSegs)
+			}
+			for idx := range res {
+				if res[idx] != expectSegs[idx] {
+					t.Fatalf("`ParamSegs` of %s of %s returned %v, expected %v", paramKey, orgKey, res, expectSegs)
+				}
+			}
+		}
+	}
+
+	if res, err := src.Org("nonexistent"); res != nil || err != nil {
+		t.Errorf("`Org` of an unknown org returned %v and %v, expected nothing", res, err)
+	}
+}
+
+// TestOpenPath checks that `Open` opens the file at the path it is given, whatever the characters in it.
+func TestOpenPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules?mode=memory#1 .db")
+	src, err := Open(path)
+	if err != nil {
+		t.Fatalf("`Open` failed with error %s", err)
+	}
+	defer src.Close()
+
+	if err := src.Import(lookupcache.NewJSONFileSource(testDataFile)); err != nil {
+		t.Fatalf("`Import` failed with error %s", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("the database isn't at %s: %s", path, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.db")
+	src, err := Open(path)
+	if err != nil {
+		t.Fatalf("`Open` failed with error %s", err)
+	}
+	defer src.Close()
+	src.PollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changed := make(chan struct{}, 1)
+	watched := make(chan error)
+	go func() {
+		watched <- src.Watch(ctx, func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	// Another process writing to the database.
+	other, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := other.Import(lookupcache.NewJSONFileSource(testDataFile)); err != nil {
+		t.Fatalf("`Import` failed with error %s", err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("`Watch` didn't notice the import")
+	}
+
+	cancel()
+	if err := <-watched; err != context.Canceled {
+		t.Errorf("`Watch` returned %v, expected %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,178 @@
+package lookupcache
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// strTable interns the strings of the orgs of a cache, or of a single org of a cache with a capacity, the param keys
+// and segment ids repeating across orgs are held once, and referred to by a small integer id. The rule values are
+// mostly distinct, they aren't interned, see `paramRules`.
+// Looking a string up by id takes no lock, only interning does. Strings are never removed, the table goes away with
+// the orgs referring to it, or is replaced once most of its strings are no longer used, see `compactStrings`.
+type strTable struct {
+	lock sync.Mutex
+	// `sorted` holds the ids sorted by string, but those of the strings added since it was last sorted, which are in
+	// `recent`. The ids of a string are found by a binary search there, a map of them all would take several times
+	// the memory of the ids.
+	sorted []uint32
+	recent map[string]uint32
+	// `strs` is only ever appended to, a reader holding an id also sees the string of it.
+	strs atomic.Pointer[[]string]
+}
+
+// minRecentStrs is the number of strings added from which they are sorted in with the others, past a quarter of
+// those. Each string is sorted in a few times only as the table grows.
+const minRecentStrs = 64
+
+func newStrTable() *strTable {
+	t := &strTable{recent: make(map[string]uint32)}
+	t.strs.Store(new([]string))
+	return t
+}
+
+// newStrTableOf returns the table of the distinct strings `strs`, their ids being their indices.
+func newStrTableOf(strs []string) *strTable {
+	t := &strTable{recent: make(map[string]uint32)}
+	t.strs.Store(&strs)
+	t.sortIds()
+	return t
+}
+
+// intern returns the id of the string of `b`, adding it if it isn't there yet.
+func (t *strTable) intern(b []byte) uint32 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// No string is allocated for the lookup.
+	strs := *t.strs.Load()
+	at := sort.Search(len(t.sorted), func(i int) bool { return strs[t.sorted[i]] >= string(b) })
+	if at < len(t.sorted) && strs[t.sorted[at]] == string(b) {
+		return t.sorted[at]
+	}
+	if id, ok := t.recent[string(b)]; ok {
+		return id
+	}
+	return t.add(string(b))
+}
+
+// internString returns the id of `str`, adding it if it isn't there yet.
+func (t *strTable) internString(str string) uint32 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if id, ok := t.find(str); ok {
+		return id
+	}
+	return t.add(str)
+}
+
+// find returns the id of `str`, if it is there, `t.lock` must be held.
+func (t *strTable) find(str string) (uint32, bool) {
+	strs := *t.strs.Load()
+	at := sort.Search(len(t.sorted), func(i int) bool { return strs[t.sorted[i]] >= str })
+	if at < len(t.sorted) && strs[t.sorted[at]] == str {
+		return t.sorted[at], true
+	}
+	id, ok := t.recent[str]
+	return id, ok
+}
+
+// add adds `str`, `t.lock` must be held.
+func (t *strTable) add(str string) uint32 {
+	strs := *t.strs.Load()
+	id := uint32(len(strs))
+	// Readers of the previous slice never go past its length, so appending in place is fine.
+	strs = append(strs, str)
+	t.strs.Store(&strs)
+
+	t.recent[str] = id
+	if len(t.recent) >= minRecentStrs && len(t.recent) > len(t.sorted)/4 {
+		t.sortIds()
+	}
+	return id
+}
+
+// sortIds sorts the ids of all the strings into `sorted`, emptying `recent`, `t.lock` must be held if the table
+// is shared already.
+func (t *strTable) sortIds() {
+	strs := *t.strs.Load()
+	sorted := make([]uint32, len(strs))
+	for id := range sorted {
+		sorted[id] = uint32(id)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return strs[sorted[i]] < strs[sorted[j]] })
+
+	t.sorted = sorted
+	t.recent = make(map[string]uint32)
+}
+
+// len returns the number of strings of the table.
+func (t *strTable) len() int {
+	return len(*t.strs.Load())
+}
+
+// str returns the string of `id`.
+func (t *strTable) str(id uint32) string {
+	return (*t.strs.Load())[id]
+}
+
+// paramRules are the rules of a param, in the order of the data file: rule `i` has the raw value `vals[i]`
+// and emits the segment `segIds[i]`, an id in the string table of the org. Few values repeat, interning them
+// would take more memory than it saves.
+type paramRules struct {
+	vals   []string
+	segIds []uint32
+	// `sources` holds the index of the source of every rule, see `NewFromSources`, nil while they are all
+	// from the data.
+	sources []uint16
+}
+
+func (r *paramRules) add(val string, segId uint32) {
+	r.addFrom(val, segId, 0)
+}
+
+// addFrom adds a rule of the source `source`.
+func (r *paramRules) addFrom(val string, segId uint32, source int) {
+	if source != 0 && r.sources == nil {
+		r.sources = make([]uint16, len(r.vals), cap(r.vals))
+	}
+	r.vals = append(r.vals, val)
+	r.segIds = append(r.segIds, segId)
+	if r.sources != nil {
+		r.sources = append(r.sources, uint16(source))
+	}
+}
+
+// source returns the index of the source of rule `rule`.
+func (r *paramRules) source(rule int) int {
+	if r.sources == nil {
+		return 0
+	}
+	return int(r.sources[rule])
+}
+
+func (r *paramRules) len() int {
+	return len(r.vals)
+}
+
+// remove removes the rules of value `val` emitting `segId`.
+func (r *paramRules) remove(val string, segId uint32) {
+	kept := 0
+	for rule := range r.vals {
+		if r.vals[rule] == val && r.segIds[rule] == segId {
+			continue
+		}
+		r.vals[kept], r.segIds[kept] = r.vals[rule], r.segIds[rule]
+		if r.sources != nil {
+			r.sources[kept] = r.sources[rule]
+		}
+		kept++
+	}
+
+	r.vals, r.segIds = r.vals[:kept], r.segIds[:kept]
+	if r.sources != nil {
+		r.sources = r.sources[:kept]
+	}
+}
@@ -2,9 +2,41 @@ package json
 
 import (
 	"errors"
+	"fmt"
 )
 
 var (
 	InvalidJson      = errors.New("tool.json: provided json data is invalid")
 	JsonPathNotFound = errors.New("tool.json: json path not found")
 )
+
+// SyntaxError tells where in the input the json turned out to be invalid.
+// `Offset` is the 0 based byte offset, `Line` and `Column` are 1 based and count bytes.
+// It matches `InvalidJson` with `errors.Is`.
+type SyntaxError struct {
+	Offset int
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("tool.json: %d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return InvalidJson
+}
+
+func newSyntaxError(data []byte, offset int, msg string) *SyntaxError {
+	line, column := 1, 1
+	for _, char := range data[:offset] {
+		if char == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return &SyntaxError{Offset: offset, Line: line, Column: column, Msg: msg}
+}
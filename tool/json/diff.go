@@ -0,0 +1,490 @@
+package json
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeOp is the kind of one `Change`, named after the RFC 6902 operations.
+type ChangeOp string
+
+const (
+	OpAdd     ChangeOp = "add"
+	OpRemove  ChangeOp = "remove"
+	OpReplace ChangeOp = "replace"
+	OpMove    ChangeOp = "move"
+)
+
+// Change is one difference found by `Diff`.
+//  1. `Path` is a JSON Pointer (RFC 6901), keys are used as they are written in the source, escapes are not decoded
+//  2. `From` is the raw old value, nil for `OpAdd` and `OpMove`
+//  3. `To` is the raw new value, nil for `OpRemove` and `OpMove`
+//  4. `FromPath` is the JSON Pointer of the element moved to `Path` by `OpMove`, empty for the other ops
+//
+// String values are kept quoted in `From` and `To`, so both are always valid json.
+type Change struct {
+	Op       ChangeOp
+	Path     string
+	From     []byte
+	To       []byte
+	FromPath string
+}
+
+// ArrayMatch decides how the elements of two arrays are paired before being compared.
+type ArrayMatch struct {
+	keyed bool
+	field string
+}
+
+// Positional pairs array elements by index, a trailing surplus on either side is reported as removed or added.
+var Positional = ArrayMatch{}
+
+// KeyedBySoleMember pairs elements which are single member objects by the name of that member,
+// which is how the segment file nests its orgs, params and param values:
+//
+//	[{"6lkb2cv": [{"gen": [{"Male": {...}}]}]}]
+var KeyedBySoleMember = ArrayMatch{keyed: true}
+
+// KeyedByField pairs object elements by the value of their `field` member.
+func KeyedByField(field string) ArrayMatch {
+	return ArrayMatch{keyed: true, field: field}
+}
+
+type DiffOption func(*differ)
+
+// WithArrayMatch sets how every array is diffed, `Positional` if not provided.
+func WithArrayMatch(m ArrayMatch) DiffOption {
+	return func(d *differ) {
+		d.arrays = m
+	}
+}
+
+// WithArrayMatchAt sets how the arrays located by `pattern` are diffed, it takes precedence over `WithArrayMatch`.
+// `pattern` is a JSON Pointer in which a "*" segment stands for any single key or index, e.g. "/*/6lkb2cv".
+func WithArrayMatchAt(pattern string, m ArrayMatch) DiffOption {
+	return func(d *differ) {
+		d.arraysAt = append(d.arraysAt, arrayMatchAt{pattern: strings.Split(pattern, "/"), m: m})
+	}
+}
+
+// Diff compares the json documents `a` and `b` structurally and returns the changes turning `a` into `b`.
+// Applying the changes in order, e.g. through `Patch`, reproduces `b`. The elements of keyed arrays present on both
+// sides but in another order in `b` are moved there, as few of them as can be, before being compared.
+func Diff(a, b []byte, opts ...DiffOption) ([]Change, error) {
+	d := &differ{}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	na, err := parseTopLevelNode(a)
+	if err != nil {
+		return nil, err
+	}
+	nb, err := parseTopLevelNode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.diff("", na, nb); err != nil {
+		return nil, err
+	}
+	return d.changes, nil
+}
+
+// Patch renders `changes` as an RFC 6902 json patch document.
+func Patch(changes []Change) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteByte('[')
+	for idx, c := range changes {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`{"op":"`)
+		buf.WriteString(string(c.Op))
+		// `Path` is built from raw keys, which are already in their escaped form.
+		buf.WriteString(`","path":"`)
+		buf.WriteString(c.Path)
+		buf.WriteByte('"')
+		switch c.Op {
+		case OpRemove:
+		case OpMove:
+			buf.WriteString(`,"from":"`)
+			buf.WriteString(c.FromPath)
+			buf.WriteByte('"')
+		default:
+			buf.WriteString(`,"value":`)
+			buf.Write(c.To)
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(']')
+
+	return buf.Bytes()
+}
+
+// Add non-exported stuffs below.
+
+type arrayMatchAt struct {
+	pattern []string
+	m       ArrayMatch
+}
+
+type differ struct {
+	arrays   ArrayMatch
+	arraysAt []arrayMatchAt
+	changes  []Change
+}
+
+// node is a json value as handed out by the iterators, strings come without their quotes.
+type node struct {
+	raw []byte
+	str bool
+}
+
+func (n node) kind() byte {
+	if n.str {
+		return '"'
+	}
+	if len(n.raw) > 0 && (n.raw[0] == '{' || n.raw[0] == '[') {
+		return n.raw[0]
+	}
+	return 0
+}
+
+func (n node) json() []byte {
+	if n.str {
+		res := make([]byte, 0, len(n.raw)+2)
+		res = append(res, '"')
+		res = append(res, n.raw...)
+		return append(res, '"')
+	}
+	return n.raw
+}
+
+func (d *differ) diff(path string, a, b node) error {
+	if a.kind() != b.kind() {
+		d.changes = append(d.changes, Change{Op: OpReplace, Path: path, From: a.json(), To: b.json()})
+		return nil
+	}
+
+	switch a.kind() {
+	case '{':
+		return d.diffObject(path, a.raw, b.raw)
+	case '[':
+		return d.diffArray(path, a.raw, b.raw)
+	default:
+		if !bytes.Equal(a.raw, b.raw) {
+			d.changes = append(d.changes, Change{Op: OpReplace, Path: path, From: a.json(), To: b.json()})
+		}
+		return nil
+	}
+}
+
+func (d *differ) diffObject(path string, a, b []byte) error {
+	aKeys, aVals, err := objectMembers(a)
+	if err != nil {
+		return err
+	}
+	bKeys, bVals, err := objectMembers(b)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range aKeys {
+		if bVal, ok := bVals[key]; ok {
+			if err := d.diff(path+"/"+escapePointerToken(key), aVals[key], bVal); err != nil {
+				return err
+			}
+		} else {
+			d.changes = append(d.changes, Change{Op: OpRemove, Path: path + "/" + escapePointerToken(key), From: aVals[key].json()})
+		}
+	}
+	for _, key := range bKeys {
+		if _, ok := aVals[key]; !ok {
+			d.changes = append(d.changes, Change{Op: OpAdd, Path: path + "/" + escapePointerToken(key), To: bVals[key].json()})
+		}
+	}
+
+	return nil
+}
+
+func (d *differ) diffArray(path string, a, b []byte) error {
+	aElems, err := arrayElements(a)
+	if err != nil {
+		return err
+	}
+	bElems, err := arrayElements(b)
+	if err != nil {
+		return err
+	}
+
+	m := d.arrayMatchFor(path)
+
+	if !m.keyed {
+		common := len(aElems)
+		if len(bElems) < common {
+			common = len(bElems)
+		}
+		for idx := 0; idx < common; idx++ {
+			if err := d.diff(path+"/"+strconv.Itoa(idx), aElems[idx], bElems[idx]); err != nil {
+				return err
+			}
+		}
+		// Remove from the end, so the indexes of the following removals stay valid.
+		for idx := len(aElems) - 1; idx >= common; idx-- {
+			d.changes = append(d.changes, Change{Op: OpRemove, Path: path + "/" + strconv.Itoa(idx), From: aElems[idx].json()})
+		}
+		for idx := common; idx < len(bElems); idx++ {
+			d.changes = append(d.changes, Change{Op: OpAdd, Path: path + "/" + strconv.Itoa(idx), To: bElems[idx].json()})
+		}
+		return nil
+	}
+
+	aKeys, bKeys := m.keys(aElems), m.keys(bElems)
+
+	aIdxByKey := make(map[string]int, len(aKeys))
+	for idx, key := range aKeys {
+		aIdxByKey[key] = idx
+	}
+	bIdxByKey := make(map[string]int, len(bKeys))
+	for idx, key := range bKeys {
+		bIdxByKey[key] = idx
+	}
+
+	// Removals go first and from the end, afterwards the array only holds the elements kept from `a`.
+	for idx := len(aElems) - 1; idx >= 0; idx-- {
+		if _, ok := bIdxByKey[aKeys[idx]]; !ok {
+			d.changes = append(d.changes, Change{Op: OpRemove, Path: path + "/" + strconv.Itoa(idx), From: aElems[idx].json()})
+		}
+	}
+
+	// Then the kept elements are moved into their order in `b`, and compared where they end up.
+	var kept, target []string
+	for _, key := range aKeys {
+		if _, ok := bIdxByKey[key]; ok {
+			kept = append(kept, key)
+		}
+	}
+	for _, key := range bKeys {
+		if _, ok := aIdxByKey[key]; ok {
+			target = append(target, key)
+		}
+	}
+	d.moveInto(path, kept, target)
+
+	for keptIdx, key := range target {
+		if err := d.diff(path+"/"+strconv.Itoa(keptIdx), aElems[aIdxByKey[key]], bElems[bIdxByKey[key]]); err != nil {
+			return err
+		}
+	}
+
+	for idx, key := range bKeys {
+		if _, ok := aIdxByKey[key]; !ok {
+			d.changes = append(d.changes, Change{Op: OpAdd, Path: path + "/" + strconv.Itoa(idx), To: bElems[idx].json()})
+		}
+	}
+
+	return nil
+}
+
+// moveInto adds the moves turning the array at `path`, whose elements are keyed `current`, into one keyed `target`,
+// the same keys in another order. Those of the longest run already in order stay, each other one is moved right
+// after the element it follows in `target`.
+func (d *differ) moveInto(path string, current, target []string) {
+	currentIdx := make(map[string]int, len(current))
+	for idx, key := range current {
+		currentIdx[key] = idx
+	}
+	order := make([]int, len(target))
+	for idx, key := range target {
+		order[idx] = currentIdx[key]
+	}
+	stays := longestIncreasing(order)
+
+	current = append([]string(nil), current...)
+	for idx, key := range target {
+		if stays[idx] {
+			continue
+		}
+
+		from := indexOf(current, key)
+		current = append(current[:from], current[from+1:]...)
+		to := 0
+		if idx > 0 {
+			to = indexOf(current, target[idx-1]) + 1
+		}
+		current = append(current[:to], append([]string{key}, current[to:]...)...)
+
+		if from != to {
+			d.changes = append(d.changes, Change{Op: OpMove, Path: path + "/" + strconv.Itoa(to), FromPath: path + "/" + strconv.Itoa(from)})
+		}
+	}
+}
+
+// longestIncreasing marks the elements of one of the longest increasing subsequences of `seq`.
+func longestIncreasing(seq []int) []bool {
+	// `tails[n]` is the index of the smallest last element of an increasing subsequence of length n+1 so far,
+	// and `prev` the index of the element before each in its subsequence.
+	tails := make([]int, 0, len(seq))
+	prev := make([]int, len(seq))
+	for idx, val := range seq {
+		n := sort.Search(len(tails), func(i int) bool { return seq[tails[i]] >= val })
+		if n > 0 {
+			prev[idx] = tails[n-1]
+		} else {
+			prev[idx] = -1
+		}
+		if n == len(tails) {
+			tails = append(tails, idx)
+		} else {
+			tails[n] = idx
+		}
+	}
+
+	res := make([]bool, len(seq))
+	if len(tails) > 0 {
+		for idx := tails[len(tails)-1]; idx != -1; idx = prev[idx] {
+			res[idx] = true
+		}
+	}
+	return res
+}
+
+func indexOf(keys []string, key string) int {
+	for idx, k := range keys {
+		if k == key {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (d *differ) arrayMatchFor(path string) ArrayMatch {
+	segments := strings.Split(path, "/")
+
+	for _, at := range d.arraysAt {
+		if len(at.pattern) != len(segments) {
+			continue
+		}
+		matched := true
+		for idx, segment := range at.pattern {
+			if segment != "*" && segment != segments[idx] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return at.m
+		}
+	}
+
+	return d.arrays
+}
+
+// keys returns the matching key of every element, the n-th occurrence of a repeated key is suffixed by n,
+// so repeated keys are paired in the order they show up.
+// Elements which cannot be keyed are keyed by their own content.
+func (m ArrayMatch) keys(elems []node) []string {
+	res := make([]string, len(elems))
+	seen := make(map[string]int)
+
+	for idx, elem := range elems {
+		key := "v" + string(elem.kind()) + string(elem.raw)
+
+		if elem.kind() == '{' {
+			if memberKeys, memberVals, err := objectMembers(elem.raw); err == nil {
+				if m.field == "" && len(memberKeys) == 1 {
+					key = "k" + memberKeys[0]
+				} else if val, ok := memberVals[m.field]; m.field != "" && ok {
+					key = "f" + string(val.kind()) + string(val.raw)
+				}
+			}
+		}
+
+		if n := seen[key]; n > 0 {
+			res[idx] = key + "#" + strconv.Itoa(n)
+		} else {
+			res[idx] = key
+		}
+		seen[key]++
+	}
+
+	return res
+}
+
+func objectMembers(obj []byte) (keys []string, vals map[string]node, err error) {
+	ch := make(chan *Kv)
+	go IterateObject(ch, obj)
+
+	vals = make(map[string]node)
+
+	// Always drain the channel, so the iterator goroutine can terminate.
+	for kv := range ch {
+		if kv.Err != nil {
+			err = kv.Err
+			continue
+		}
+		key := string(kv.K)
+		if _, ok := vals[key]; !ok {
+			keys = append(keys, key)
+		}
+		vals[key] = node{raw: kv.V, str: kv.Str}
+	}
+
+	return keys, vals, err
+}
+
+func arrayElements(arr []byte) (elems []node, err error) {
+	ch := make(chan *V)
+	go IterateArray(ch, arr)
+
+	for v := range ch {
+		if v.Err != nil {
+			err = v.Err
+			continue
+		}
+		elems = append(elems, node{raw: v.V, str: v.Str})
+	}
+
+	return elems, err
+}
+
+func parseTopLevelNode(data []byte) (node, error) {
+	start := traverseToNextVisibleChar(data)
+	if start == -1 {
+		return node{}, InvalidJson
+	}
+	data = data[start:]
+
+	switch data[0] {
+	case '"':
+		traversedQty := traverseToStrEnd(data[1:])
+		if traversedQty == -1 || traverseToNextVisibleChar(data[traversedQty+1:]) != -1 {
+			return node{}, InvalidJson
+		}
+		return node{raw: data[1:traversedQty], str: true}, nil
+	case '{', '[':
+		traversedQty := traverseToArrOrObjEnd(data, data[0])
+		if traversedQty == -1 || traverseToNextVisibleChar(data[traversedQty:]) != -1 {
+			return node{}, InvalidJson
+		}
+		return node{raw: data[:traversedQty]}, nil
+	default:
+		traversedQty := traverseToSimpleSeqEnd(data)
+		if traversedQty == -1 {
+			// A simple sequence running to the very end of `data`.
+			traversedQty = len(data)
+		}
+		if traverseToNextVisibleChar(data[traversedQty:]) != -1 {
+			return node{}, InvalidJson
+		}
+		return node{raw: data[:traversedQty]}, nil
+	}
+}
+
+func escapePointerToken(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
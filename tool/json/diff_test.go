@@ -0,0 +1,254 @@
+package json
+
+import (
+	encjson "encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Test cases for `Diff`
+
+var DiffTests = []struct {
+	desc   string
+	a, b   []byte
+	opts   []DiffOption
+	expect []Change
+}{
+	{
+		desc: "Same document in different formats",
+		a:    []byte(`{"a":[0,true,"leonard"],"b":{"c":null}}`),
+		b: []byte(`  {  "b" : {"c":null},
+                       "a": [0, true, "leonard"]  }  `),
+		expect: []Change{},
+	}, {
+		desc: "Object members added, removed and replaced",
+		a:    []byte(`{"a":1,"b":"leonard","c":{"d":true}}`),
+		b:    []byte(`{"b":"miao","c":{"d":true,"e":{}},"f":[]}`),
+		expect: []Change{
+			{Op: OpRemove, Path: "/a", From: []byte(`1`)},
+			{Op: OpReplace, Path: "/b", From: []byte(`"leonard"`), To: []byte(`"miao"`)},
+			{Op: OpAdd, Path: "/c/e", To: []byte(`{}`)},
+			{Op: OpAdd, Path: "/f", To: []byte(`[]`)},
+		},
+	}, {
+		desc: "A string and a number with the same text are different",
+		a:    []byte(`{"a":"233"}`),
+		b:    []byte(`{"a":233}`),
+		expect: []Change{
+			{Op: OpReplace, Path: "/a", From: []byte(`"233"`), To: []byte(`233`)},
+		},
+	}, {
+		desc: "Positional array diff",
+		a:    []byte(`[1,2,3,4]`),
+		b:    []byte(`[1,5]`),
+		expect: []Change{
+			{Op: OpReplace, Path: "/1", From: []byte(`2`), To: []byte(`5`)},
+			{Op: OpRemove, Path: "/3", From: []byte(`4`)},
+			{Op: OpRemove, Path: "/2", From: []byte(`3`)},
+		},
+	}, {
+		desc: "Keys are escaped as JSON Pointer tokens",
+		a:    []byte(`{"a/b":{"~c":1}}`),
+		b:    []byte(`{"a/b":{"~c":2}}`),
+		expect: []Change{
+			{Op: OpReplace, Path: "/a~1b/~0c", From: []byte(`1`), To: []byte(`2`)},
+		},
+	}, {
+		desc: "Segment file style arrays keyed by their sole member",
+		a: []byte(`[{"org1":[{"gen":[{"Female":{"segmentId":"dem.g.f"}},{"Male":{"segmentId":"dem.g.m"}}]}]},
+                    {"org2":[{"sid":[{"":{"segmentId":"dem.life.expat"}}]}]}]`),
+		b: []byte(`[{"org0":[]},
+                    {"org1":[{"gen":[{"Male":{"segmentId":"dem.g.male"}}]}]}]`),
+		opts: []DiffOption{WithArrayMatch(KeyedBySoleMember)},
+		expect: []Change{
+			{Op: OpRemove, Path: "/1", From: []byte(`{"org2":[{"sid":[{"":{"segmentId":"dem.life.expat"}}]}]}`)},
+			{Op: OpRemove, Path: "/0/org1/0/gen/0", From: []byte(`{"Female":{"segmentId":"dem.g.f"}}`)},
+			{Op: OpReplace, Path: "/0/org1/0/gen/0/Male/segmentId", From: []byte(`"dem.g.m"`), To: []byte(`"dem.g.male"`)},
+			{Op: OpAdd, Path: "/0", To: []byte(`{"org0":[]}`)},
+		},
+	}, {
+		desc: "Arrays keyed by field only where the pattern matches",
+		a:    []byte(`{"x":[{"id":1,"v":"a"},{"id":2,"v":"b"}],"y":[1,2]}`),
+		b:    []byte(`{"x":[{"id":2,"v":"c"}],"y":[2]}`),
+		opts: []DiffOption{WithArrayMatchAt("/x", KeyedByField("id"))},
+		expect: []Change{
+			{Op: OpRemove, Path: "/x/0", From: []byte(`{"id":1,"v":"a"}`)},
+			{Op: OpReplace, Path: "/x/0/v", From: []byte(`"b"`), To: []byte(`"c"`)},
+			{Op: OpReplace, Path: "/y/0", From: []byte(`1`), To: []byte(`2`)},
+			{Op: OpRemove, Path: "/y/1", From: []byte(`2`)},
+		},
+	}, {
+		desc: "Keyed array elements moved around are moved, then compared",
+		a:    []byte(`[{"org1":1},{"org2":2}]`),
+		b:    []byte(`[{"org2":3},{"org1":1},{"org3":4}]`),
+		opts: []DiffOption{WithArrayMatch(KeyedBySoleMember)},
+		expect: []Change{
+			{Op: OpMove, Path: "/0", FromPath: "/1"},
+			{Op: OpReplace, Path: "/0/org2", From: []byte(`2`), To: []byte(`3`)},
+			{Op: OpAdd, Path: "/2", To: []byte(`{"org3":4}`)},
+		},
+	}, {
+		desc: "Only the keyed array elements out of order are moved",
+		a:    []byte(`[{"a":1},{"b":2},{"c":3},{"d":4},{"e":5}]`),
+		b:    []byte(`[{"b":2},{"c":3},{"e":5},{"d":4},{"a":1}]`),
+		opts: []DiffOption{WithArrayMatch(KeyedBySoleMember)},
+		expect: []Change{
+			{Op: OpMove, Path: "/3", FromPath: "/4"},
+			{Op: OpMove, Path: "/4", FromPath: "/0"},
+		},
+	}, {
+		desc: "Different kinds at the top level",
+		a:    []byte(`{}`),
+		b:    []byte(`"leonard"`),
+		expect: []Change{
+			{Op: OpReplace, Path: "", From: []byte(`{}`), To: []byte(`"leonard"`)},
+		},
+	},
+}
+
+func TestDiff(t *testing.T) {
+	for _, test := range DiffTests {
+		res, err := Diff(test.a, test.b, test.opts...)
+		if err != nil {
+			t.Errorf("Diff(%s) failed with error %s", test.desc, err)
+			continue
+		}
+
+		if len(res) != len(test.expect) {
+			t.Errorf("Diff(%s) returned %d changes, expected %d: %q", test.desc, len(res), len(test.expect), res)
+			continue
+		}
+		for idx, c := range res {
+			e := test.expect[idx]
+			if c.Op != e.Op || c.Path != e.Path || c.FromPath != e.FromPath || string(c.From) != string(e.From) || string(c.To) != string(e.To) {
+				t.Errorf("Diff(%s) change %d is %s %q %q %s -> %s, expected %s %q %q %s -> %s", test.desc, idx, c.Op, c.Path, c.FromPath, c.From, c.To, e.Op, e.Path, e.FromPath, e.From, e.To)
+			}
+		}
+
+		// The changes turn `a` into `b`, whatever they are.
+		if res, expect := applyChanges(t, test.a, res), decodeJson(t, test.b); !reflect.DeepEqual(res, expect) {
+			t.Errorf("Diff(%s) patched `a` into %v, expected %v", test.desc, res, expect)
+		}
+	}
+}
+
+func TestDiffRoundTrip(t *testing.T) {
+	a := []byte(`[{"org1":[{"gen":[{"Female":1},{"Male":2}]}]},{"org2":[]},{"org3":[{"sid":[{"":3}]}]},{"org4":[]}]`)
+	b := []byte(`[{"org4":[]},{"org3":[{"sid":[{"":4}]}]},{"org5":[]},{"org1":[{"gen":[{"Male":2},{"Other":5},{"Female":1}]}]}]`)
+
+	changes, err := Diff(a, b, WithArrayMatch(KeyedBySoleMember))
+	if err != nil {
+		t.Fatalf("Diff failed with error %s", err)
+	}
+	if res, expect := applyChanges(t, a, changes), decodeJson(t, b); !reflect.DeepEqual(res, expect) {
+		t.Errorf("Diff patched `a` into %v, expected %v, the changes are %q", res, expect, changes)
+	}
+}
+
+// applyChanges applies `changes` to the document `doc` as RFC 6902 says, and returns it decoded.
+func applyChanges(t *testing.T, doc []byte, changes []Change) interface{} {
+	root := decodeJson(t, doc)
+
+	for _, c := range changes {
+		var val interface{}
+		switch c.Op {
+		case OpMove:
+			val = pointerOp(t, &root, c.FromPath, OpRemove, nil)
+			c.Op = OpAdd
+		case OpAdd, OpReplace:
+			val = decodeJson(t, c.To)
+		}
+		pointerOp(t, &root, c.Path, c.Op, val)
+	}
+	return root
+}
+
+// pointerOp adds, removes or replaces the value at `path` of `*root` and returns the value removed or replaced.
+func pointerOp(t *testing.T, root *interface{}, path string, op ChangeOp, val interface{}) interface{} {
+	if path == "" {
+		old := *root
+		*root = val
+		return old
+	}
+
+	tokens := strings.Split(path[1:], "/")
+	last := strings.Replace(strings.Replace(tokens[len(tokens)-1], "~1", "/", -1), "~0", "~", -1)
+	parent := root
+	for _, token := range tokens[:len(tokens)-1] {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch p := (*parent).(type) {
+		case map[string]interface{}:
+			child := p[token]
+			parent = &child
+			defer func(key string, child *interface{}) { p[key] = *child }(token, parent)
+		case []interface{}:
+			idx, _ := strconv.Atoi(token)
+			parent = &p[idx]
+		}
+	}
+
+	switch p := (*parent).(type) {
+	case map[string]interface{}:
+		old := p[last]
+		if op == OpRemove {
+			delete(p, last)
+		} else {
+			p[last] = val
+		}
+		return old
+	case []interface{}:
+		idx, err := strconv.Atoi(last)
+		if err != nil || idx < 0 || idx > len(p) || (op != OpAdd && idx == len(p)) {
+			t.Fatalf("%s of index %s of an array of %d elements", op, last, len(p))
+		}
+		var old interface{}
+		switch op {
+		case OpAdd:
+			p = append(p[:idx], append([]interface{}{val}, p[idx:]...)...)
+		case OpRemove:
+			old = p[idx]
+			p = append(p[:idx], p[idx+1:]...)
+		default:
+			old, p[idx] = p[idx], val
+		}
+		*parent = p
+		return old
+	}
+	t.Fatalf("%s of %s, which isn't in an object nor an array", op, path)
+	return nil
+}
+
+func decodeJson(t *testing.T, doc []byte) interface{} {
+	var res interface{}
+	if err := encjson.Unmarshal(doc, &res); err != nil {
+		t.Fatalf("decoding %s failed with error %s", doc, err)
+	}
+	return res
+}
+
+func TestDiffInvalidJson(t *testing.T) {
+	if _, err := Diff([]byte(`{"a":`), []byte(`{}`)); err != InvalidJson {
+		t.Errorf("Diff on invalid json returned error %v, expected %v", err, InvalidJson)
+	}
+	if _, err := Diff([]byte(`{"a":[1,2}`), []byte(`{"a":[]}`)); err != InvalidJson {
+		t.Errorf("Diff on invalid nested json returned error %v, expected %v", err, InvalidJson)
+	}
+}
+
+// Test cases for `Patch`
+
+func TestPatch(t *testing.T) {
+	changes := []Change{
+		{Op: OpRemove, Path: "/a", From: []byte(`1`)},
+		{Op: OpReplace, Path: "/b", From: []byte(`"leonard"`), To: []byte(`"miao"`)},
+		{Op: OpAdd, Path: "/c/0", To: []byte(`{"d":null}`)},
+		{Op: OpMove, Path: "/c/0", FromPath: "/c/1"},
+	}
+	expect := `[{"op":"remove","path":"/a"},{"op":"replace","path":"/b","value":"miao"},{"op":"add","path":"/c/0","value":{"d":null}},{"op":"move","path":"/c/0","from":"/c/1"}]`
+
+	if res := Patch(changes); string(res) != expect {
+		t.Errorf("Patch returned %s, expected %s", res, expect)
+	}
+}
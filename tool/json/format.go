@@ -0,0 +1,352 @@
+package json
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+type FormatOption func(*formatter)
+
+// SortKeys makes `Indent` and `Compact` emit the members of every object ordered by their raw keys.
+func SortKeys() FormatOption {
+	return func(f *formatter) {
+		f.sortKeys = true
+	}
+}
+
+// Indent validates `data` and reformats it with one member or element per line,
+// each line starts with `prefix` followed by one copy of `indent` per nesting level.
+// Empty objects and arrays stay on one line: `{}`, `[]`.
+// Invalid input is reported as a `*SyntaxError` telling where the problem is.
+func Indent(data []byte, prefix, indent string, opts ...FormatOption) ([]byte, error) {
+	f := &formatter{data: data, pretty: true, prefix: prefix, indent: indent}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f.format()
+}
+
+// Compact validates `data` and reformats it without any insignificant white space.
+// Invalid input is reported as a `*SyntaxError` telling where the problem is.
+func Compact(data []byte, opts ...FormatOption) ([]byte, error) {
+	f := &formatter{data: data}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f.format()
+}
+
+// Add non-exported stuffs below.
+
+// formatter is a strict recursive descent parser which writes the tokens it accepts straight to `out`.
+// Strings and numbers are copied as they are, escapes are validated but not decoded.
+type formatter struct {
+	data []byte
+	idx  int
+	out  bytes.Buffer
+
+	pretty         bool
+	prefix, indent string
+	sortKeys       bool
+}
+
+func (f *formatter) format() ([]byte, error) {
+	f.out.Grow(len(f.data))
+
+	if f.pretty {
+		f.out.WriteString(f.prefix)
+	}
+	if err := f.value(0); err != nil {
+		return nil, err
+	}
+
+	f.skipWhiteSpaces()
+	if f.idx < len(f.data) {
+		return nil, f.errorf("invalid character %q after top-level value", f.data[f.idx])
+	}
+
+	return f.out.Bytes(), nil
+}
+
+func (f *formatter) value(depth int) error {
+	f.skipWhiteSpaces()
+	if f.idx >= len(f.data) {
+		return f.errorf("unexpected end of input, expecting a value")
+	}
+
+	switch c := f.data[f.idx]; {
+	case c == '{':
+		return f.object(depth)
+	case c == '[':
+		return f.array(depth)
+	case c == '"':
+		return f.str()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return f.number()
+	case c == 't':
+		return f.literal("true")
+	case c == 'f':
+		return f.literal("false")
+	case c == 'n':
+		return f.literal("null")
+	default:
+		return f.errorf("invalid character %q looking for beginning of value", c)
+	}
+}
+
+func (f *formatter) object(depth int) error {
+	objStart := f.out.Len()
+
+	// Skip '{'
+	f.idx++
+	f.out.WriteByte('{')
+
+	f.skipWhiteSpaces()
+	if f.idx < len(f.data) && f.data[f.idx] == '}' {
+		f.idx++
+		f.out.WriteByte('}')
+		return nil
+	}
+
+	type member struct {
+		key, text []byte
+	}
+	var members []member
+
+	for {
+		memberStart := f.out.Len()
+
+		f.newLine(depth + 1)
+
+		f.skipWhiteSpaces()
+		if f.idx >= len(f.data) {
+			return f.errorf("unexpected end of input, expecting an object key")
+		}
+		if f.data[f.idx] != '"' {
+			return f.errorf("invalid character %q looking for beginning of object key", f.data[f.idx])
+		}
+		keyStart := f.idx
+		if err := f.str(); err != nil {
+			return err
+		}
+		key := f.data[keyStart:f.idx]
+
+		f.skipWhiteSpaces()
+		if f.idx >= len(f.data) {
+			return f.errorf("unexpected end of input, expecting ':'")
+		}
+		if f.data[f.idx] != ':' {
+			return f.errorf("invalid character %q after object key", f.data[f.idx])
+		}
+		f.idx++
+		f.out.WriteByte(':')
+		if f.pretty {
+			f.out.WriteByte(' ')
+		}
+
+		if err := f.value(depth + 1); err != nil {
+			return err
+		}
+
+		if f.sortKeys {
+			members = append(members, member{key: key, text: append([]byte(nil), f.out.Bytes()[memberStart:]...)})
+		}
+
+		f.skipWhiteSpaces()
+		if f.idx >= len(f.data) {
+			return f.errorf("unexpected end of input, expecting ',' or '}'")
+		}
+		if c := f.data[f.idx]; c == ',' {
+			f.idx++
+			f.out.WriteByte(',')
+			continue
+		} else if c != '}' {
+			return f.errorf("invalid character %q after object value", c)
+		}
+		f.idx++
+		break
+	}
+
+	if f.sortKeys {
+		sort.SliceStable(members, func(i, j int) bool {
+			return bytes.Compare(members[i].key, members[j].key) < 0
+		})
+
+		f.out.Truncate(objStart + 1)
+		for idx, m := range members {
+			if idx > 0 {
+				f.out.WriteByte(',')
+			}
+			f.out.Write(m.text)
+		}
+	}
+
+	f.newLine(depth)
+	f.out.WriteByte('}')
+
+	return nil
+}
+
+func (f *formatter) array(depth int) error {
+	// Skip '['
+	f.idx++
+	f.out.WriteByte('[')
+
+	f.skipWhiteSpaces()
+	if f.idx < len(f.data) && f.data[f.idx] == ']' {
+		f.idx++
+		f.out.WriteByte(']')
+		return nil
+	}
+
+	for {
+		f.newLine(depth + 1)
+
+		if err := f.value(depth + 1); err != nil {
+			return err
+		}
+
+		f.skipWhiteSpaces()
+		if f.idx >= len(f.data) {
+			return f.errorf("unexpected end of input, expecting ',' or ']'")
+		}
+		if c := f.data[f.idx]; c == ',' {
+			f.idx++
+			f.out.WriteByte(',')
+			continue
+		} else if c != ']' {
+			return f.errorf("invalid character %q after array element", c)
+		}
+		f.idx++
+		break
+	}
+
+	f.newLine(depth)
+	f.out.WriteByte(']')
+
+	return nil
+}
+
+func (f *formatter) str() error {
+	start := f.idx
+
+	// Skip the opening '"'
+	f.idx++
+
+	for f.idx < len(f.data) {
+		switch c := f.data[f.idx]; {
+		case c == '"':
+			f.idx++
+			f.out.Write(f.data[start:f.idx])
+			return nil
+		case c == '\\':
+			f.idx++
+			if f.idx >= len(f.data) {
+				return f.errorf("unexpected end of input in string escape")
+			}
+			switch f.data[f.idx] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				f.idx++
+			case 'u':
+				f.idx++
+				for n := 0; n < 4; n++ {
+					if f.idx >= len(f.data) {
+						return f.errorf("unexpected end of input in string escape")
+					}
+					if !isHexDigit(f.data[f.idx]) {
+						return f.errorf("invalid character %q in \\u escape", f.data[f.idx])
+					}
+					f.idx++
+				}
+			default:
+				return f.errorf("invalid escape character %q in string", f.data[f.idx])
+			}
+		case c < 0x20:
+			return f.errorf("invalid control character %q in string", c)
+		default:
+			f.idx++
+		}
+	}
+
+	return f.errorf("unexpected end of input, string is not terminated")
+}
+
+func (f *formatter) number() error {
+	start := f.idx
+
+	if f.data[f.idx] == '-' {
+		f.idx++
+	}
+
+	// Integer part: a single '0' or a non zero leading digit.
+	if f.idx < len(f.data) && f.data[f.idx] == '0' {
+		f.idx++
+	} else if !f.digits() {
+		return f.errorf("invalid number, expecting a digit")
+	}
+
+	if f.idx < len(f.data) && f.data[f.idx] == '.' {
+		f.idx++
+		if !f.digits() {
+			return f.errorf("invalid number, expecting a digit after '.'")
+		}
+	}
+
+	if f.idx < len(f.data) && (f.data[f.idx] == 'e' || f.data[f.idx] == 'E') {
+		f.idx++
+		if f.idx < len(f.data) && (f.data[f.idx] == '+' || f.data[f.idx] == '-') {
+			f.idx++
+		}
+		if !f.digits() {
+			return f.errorf("invalid number, expecting a digit in exponent")
+		}
+	}
+
+	f.out.Write(f.data[start:f.idx])
+	return nil
+}
+
+func (f *formatter) digits() bool {
+	start := f.idx
+	for f.idx < len(f.data) && f.data[f.idx] >= '0' && f.data[f.idx] <= '9' {
+		f.idx++
+	}
+	return f.idx > start
+}
+
+func (f *formatter) literal(lit string) error {
+	if !bytes.HasPrefix(f.data[f.idx:], []byte(lit)) {
+		return f.errorf("invalid literal, expecting %q", lit)
+	}
+	f.idx += len(lit)
+	f.out.WriteString(lit)
+	return nil
+}
+
+func (f *formatter) newLine(depth int) {
+	if !f.pretty {
+		return
+	}
+	f.out.WriteByte('\n')
+	f.out.WriteString(f.prefix)
+	for n := 0; n < depth; n++ {
+		f.out.WriteString(f.indent)
+	}
+}
+
+func (f *formatter) skipWhiteSpaces() {
+	if traversedQty := traverseToNextVisibleChar(f.data[f.idx:]); traversedQty == -1 {
+		f.idx = len(f.data)
+	} else {
+		f.idx += traversedQty
+	}
+}
+
+func (f *formatter) errorf(format string, args ...interface{}) error {
+	return newSyntaxError(f.data, f.idx, fmt.Sprintf(format, args...))
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,138 @@
+package json
+
+import (
+	"errors"
+	"testing"
+)
+
+// Test cases for `Indent` and `Compact`
+
+var FormatTests = []struct {
+	desc          string
+	paramData     []byte
+	sortKeys      bool
+	expectIndent  string
+	expectCompact string
+}{
+	{
+		desc: "Input json is in arbitrary bad format",
+		paramData: []byte(`    {   "a" :   {
+                          "b"
+                          :
+                          {         "c":[0,true,false,null        ,"leonard"]},
+                          "c": {
+                            "leonard":   -1.5e+3
+                          }
+                          },"c":    "leo nard"    }    `),
+		expectIndent: `{
+  "a": {
+    "b": {
+      "c": [
+        0,
+        true,
+        false,
+        null,
+        "leonard"
+      ]
+    },
+    "c": {
+      "leonard": -1.5e+3
+    }
+  },
+  "c": "leo nard"
+}`,
+		expectCompact: `{"a":{"b":{"c":[0,true,false,null,"leonard"]},"c":{"leonard":-1.5e+3}},"c":"leo nard"}`,
+	}, {
+		desc:          "Empty structures and escapes are kept as they are",
+		paramData:     []byte(` [ {  }, [ ], "bachelors\ngraduate \"é\"" ] `),
+		expectIndent:  "[\n  {},\n  [],\n  \"bachelors\\ngraduate \\\"é\\\"\"\n]",
+		expectCompact: `[{},[],"bachelors\ngraduate \"é\""]`,
+	}, {
+		desc:          "Keys sorted at every level",
+		paramData:     []byte(`{"b":{"z":1,"y":[{"d":0,"c":0}]},"a":null,"":true}`),
+		sortKeys:      true,
+		expectIndent:  "{\n  \"\": true,\n  \"a\": null,\n  \"b\": {\n    \"y\": [\n      {\n        \"c\": 0,\n        \"d\": 0\n      }\n    ],\n    \"z\": 1\n  }\n}",
+		expectCompact: `{"":true,"a":null,"b":{"y":[{"c":0,"d":0}],"z":1}}`,
+	}, {
+		desc:          "Top level simple sequence",
+		paramData:     []byte("\n  233\n"),
+		expectIndent:  `233`,
+		expectCompact: `233`,
+	},
+}
+
+func TestFormat(t *testing.T) {
+	for _, test := range FormatTests {
+		var opts []FormatOption
+		if test.sortKeys {
+			opts = append(opts, SortKeys())
+		}
+
+		if res, err := Indent(test.paramData, "", "  ", opts...); err != nil || string(res) != test.expectIndent {
+			t.Errorf("Indent(%s) returned %s, expected %s, and err is %v", test.desc, res, test.expectIndent, err)
+		}
+		if res, err := Compact(test.paramData, opts...); err != nil || string(res) != test.expectCompact {
+			t.Errorf("Compact(%s) returned %s, expected %s, and err is %v", test.desc, res, test.expectCompact, err)
+		}
+	}
+}
+
+var FormatInvalidTests = []struct {
+	desc      string
+	paramData []byte
+	line      int
+	column    int
+}{
+	{
+		desc:      "Empty input",
+		paramData: []byte(`   `),
+		line:      1,
+		column:    4,
+	}, {
+		desc: "Missing comma between members",
+		paramData: []byte(`{
+  "a": 1
+  "b": 2
+}`),
+		line:   3,
+		column: 3,
+	}, {
+		desc:      "Trailing comma in array",
+		paramData: []byte(`[1, 2,]`),
+		line:      1,
+		column:    7,
+	}, {
+		desc:      "Leading zero in number",
+		paramData: []byte(`[01]`),
+		line:      1,
+		column:    3,
+	}, {
+		desc:      "Unknown escape in string",
+		paramData: []byte(`{"a":"\x"}`),
+		line:      1,
+		column:    8,
+	}, {
+		desc:      "Garbage after top level value",
+		paramData: []byte("{}\n}"),
+		line:      2,
+		column:    1,
+	},
+}
+
+func TestFormatInvalid(t *testing.T) {
+	for _, test := range FormatInvalidTests {
+		_, err := Compact(test.paramData)
+
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Compact(%s) returned error %v, expected a *SyntaxError", test.desc, err)
+			continue
+		}
+		if !errors.Is(err, InvalidJson) {
+			t.Errorf("Compact(%s) returned error %v, expected it to match InvalidJson", test.desc, err)
+		}
+		if syntaxErr.Line != test.line || syntaxErr.Column != test.column {
+			t.Errorf("Compact(%s) failed at %d:%d, expected %d:%d: %s", test.desc, syntaxErr.Line, syntaxErr.Column, test.line, test.column, err)
+		}
+	}
+}
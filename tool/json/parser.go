@@ -1,12 +1,17 @@
 package json
 
+// V is a value handed out by `GetByKeyPath` and `IterateArray`.
+// `Str` tells a string value, whose quotes are stripped off `V`, from any other value.
 type V struct {
 	V   []byte
+	Str bool
 	Err error
 }
 
+// Kv is an object member handed out by `IterateObject`, `Str` is as for `V`.
 type Kv struct {
 	K, V []byte
+	Str  bool
 	Err  error
 }
 
@@ -37,7 +42,8 @@ func GetByKeyPath(ch chan<- *V, data []byte, keys ...string) {
 					}
 				} else {
 					ch <- &V{
-						V: data[startIdx+1 : startIdx+traversedQty],
+						V:   data[startIdx+1 : startIdx+traversedQty],
+						Str: true,
 					}
 				}
 			case '[', '{':
@@ -125,7 +131,8 @@ func IterateArray(ch chan<- *V, data []byte, keys ...string) {
 				return
 			} else {
 				ch <- &V{
-					V: target[idx+1 : idx+traversedQty],
+					V:   target[idx+1 : idx+traversedQty],
+					Str: true,
 				}
 				idx += traversedQty + 1
 			}
@@ -200,6 +207,15 @@ func IterateObject(ch chan<- *Kv, data []byte, keys ...string) {
 		if key == nil {
 			// Wait for a key
 			switch target[idx] {
+			case '}':
+				// handle last '}', which is also the whole structure of an empty object: `{  }`
+				if idx != len(target)-1 {
+					ch <- &Kv{
+						Err: InvalidJson,
+					}
+					return
+				}
+				idx++
 			case '"':
 				if traversedQty := traverseToStrEnd(target[idx+1:]); traversedQty == -1 {
 					ch <- &Kv{
@@ -245,8 +261,9 @@ func IterateObject(ch chan<- *Kv, data []byte, keys ...string) {
 					}
 
 					ch <- &Kv{
-						K: key,
-						V: target[idx+1 : idx+traversedQty],
+						K:   key,
+						V:   target[idx+1 : idx+traversedQty],
+						Str: true,
 					}
 
 					idx += traversedQty + innerTraversedQty + 2
@@ -335,8 +352,10 @@ func findTargetForIterator(data []byte, targetStartSign byte, keys ...string) (t
 			}
 			if innerTraversedQty := traverseToArrOrObjEnd(data[traversedQty:], targetStartSign); innerTraversedQty == -1 {
 				return nil, InvalidJson
+			} else {
+				// Leave out whatever follows the structure, e.g. the trailing new line of a file.
+				target = data[traversedQty : traversedQty+innerTraversedQty]
 			}
-			target = data[traversedQty:]
 		}
 	}
 
@@ -353,7 +372,6 @@ func traverseToNextValidColonForObjKey(data []byte) int {
 		default:
 			return -1
 		}
-		idx++
 	}
 	return -1
 }
@@ -373,8 +391,12 @@ func traverseToNextValidCommaForObjVal(data []byte) int {
 }
 
 func traverseToStrEnd(data []byte) int {
-	for idx, char := range data {
-		if char == '"' {
+	for idx := 0; idx < len(data); idx++ {
+		switch data[idx] {
+		case '\\':
+			// The escaped char, a '"' among others, doesn't end the string.
+			idx++
+		case '"':
 			return idx + 1
 		}
 	}
@@ -145,6 +145,14 @@ var IterateArrayTests = []struct {
 			[]byte(`666`),
 			[]byte(`null`),
 		},
+	}, {
+		desc:      "Iterate over a json style array followed by white spaces, like a file ending with a new line",
+		paramData: []byte("[\"leonard\", {}]\n  "),
+		keyPath:   []string{},
+		expect: [][]byte{
+			[]byte(`leonard`),
+			[]byte(`{}`),
+		},
 	},
 }
 
@@ -252,6 +260,12 @@ var IterateObjectTests = []struct {
 			[]byte(`[null,1,"leonard"]`),
 			[]byte(`666`),
 		},
+	}, {
+		desc:      "Iterate over an empty json object",
+		paramData: []byte(`  {   }  `),
+		keyPath:   []string{},
+		expectKey: [][]byte{},
+		expectVal: [][]byte{},
 	},
 }
 
@@ -282,6 +296,38 @@ func TestIterateObject(t *testing.T) {
 	}
 }
 
+// Test cases for `Str`, which tells string values from the others
+
+func TestStrValues(t *testing.T) {
+	data := []byte(`{"a":"leonard","b":"","c":233,"d":["233",233,"",{}],"e":null}`)
+
+	for key, expect := range map[string]bool{"a": true, "b": true, "c": false, "d": false, "e": false} {
+		ch := make(chan *V)
+		go GetByKeyPath(ch, data, key)
+		if res := <-ch; res.Err != nil || res.Str != expect {
+			t.Errorf("GetByKeyPath(%s) returned Str %t and err %v, expected %t", key, res.Str, res.Err, expect)
+		}
+	}
+
+	arrCh := make(chan *V)
+	go IterateArray(arrCh, data, "d")
+	idx := 0
+	for res := range arrCh {
+		if expect := idx%2 == 0; res.Err != nil || res.Str != expect {
+			t.Errorf("IterateArray called back with %s, Str %t and err %v, expected Str %t", res.V, res.Str, res.Err, expect)
+		}
+		idx++
+	}
+
+	objCh := make(chan *Kv)
+	go IterateObject(objCh, data)
+	for res := range objCh {
+		if expect := string(res.K) == "a" || string(res.K) == "b"; res.Err != nil || res.Str != expect {
+			t.Errorf("IterateObject called back with key %s, Str %t and err %v, expected Str %t", res.K, res.Str, res.Err, expect)
+		}
+	}
+}
+
 /////////////////////////////// Put internal funcs test cases below ///////////////////////////////
 
 // Test cases for `traverseToStrEnd`
@@ -299,6 +345,14 @@ var traverseToStrEndTests = []struct {
 		desc:      "With some prefixes, white spaces in middle, and suffixes",
 		paramData: []byte(`  high_ school  "`),
 		expect:    17,
+	}, {
+		desc:      "With escaped quotes and backslashes",
+		paramData: []byte(`gen = \"Female\" \\"`),
+		expect:    20,
+	}, {
+		desc:      "Ending with an escaped quote only",
+		paramData: []byte(`high_school\"`),
+		expect:    -1,
 	},
 }
 
@@ -0,0 +1,103 @@
+package json
+
+import (
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Unescape decodes the escape sequences in a raw string value, as handed out without its quotes
+// by `GetByKeyPath` and the iterators, e.g. `bachelors\ngraduate` becomes two lines.
+// A `\u` escape of an unpaired surrogate decodes to U+FFFD.
+func Unescape(raw []byte) ([]byte, error) {
+	idx := 0
+	for idx < len(raw) && raw[idx] != '\\' {
+		idx++
+	}
+	// Nothing to decode, which is the common case.
+	if idx == len(raw) {
+		return raw, nil
+	}
+
+	res := make([]byte, idx, len(raw))
+	copy(res, raw[:idx])
+
+	for idx < len(raw) {
+		if raw[idx] != '\\' {
+			res = append(res, raw[idx])
+			idx++
+			continue
+		}
+
+		idx++
+		if idx >= len(raw) {
+			return nil, InvalidJson
+		}
+
+		switch raw[idx] {
+		case '"', '\\', '/':
+			res = append(res, raw[idx])
+		case 'b':
+			res = append(res, '\b')
+		case 'f':
+			res = append(res, '\f')
+		case 'n':
+			res = append(res, '\n')
+		case 'r':
+			res = append(res, '\r')
+		case 't':
+			res = append(res, '\t')
+		case 'u':
+			r, ok := decodeHex4(raw[idx+1:])
+			if !ok {
+				return nil, InvalidJson
+			}
+			idx += 4
+
+			if utf16.IsSurrogate(r) {
+				// The low half of a surrogate pair has to follow right away as another `\u` escape.
+				if idx+2 < len(raw) && raw[idx+1] == '\\' && raw[idx+2] == 'u' {
+					if low, ok := decodeHex4(raw[idx+3:]); ok {
+						if pair := utf16.DecodeRune(r, low); pair != utf8.RuneError {
+							r = pair
+							idx += 6
+						}
+					}
+				}
+				if utf16.IsSurrogate(r) {
+					r = utf8.RuneError
+				}
+			}
+
+			res = utf8.AppendRune(res, r)
+		default:
+			return nil, InvalidJson
+		}
+		idx++
+	}
+
+	return res, nil
+}
+
+// Add non-exported stuffs below.
+
+func decodeHex4(data []byte) (rune, bool) {
+	if len(data) < 4 {
+		return 0, false
+	}
+
+	var r rune
+	for _, c := range data[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true
+}
@@ -0,0 +1,57 @@
+package json
+
+import (
+	"testing"
+)
+
+// Test cases for `Unescape`
+
+var UnescapeTests = []struct {
+	desc      string
+	paramData []byte
+	expect    string
+	err       error
+}{
+	{
+		desc:      "Nothing to decode",
+		paramData: []byte(`high_school`),
+		expect:    "high_school",
+	}, {
+		desc:      "Multi-valued param value as in the segment file",
+		paramData: []byte(`bachelors\ngraduate\nhigh_school`),
+		expect:    "bachelors\ngraduate\nhigh_school",
+	}, {
+		desc:      "All the single character escapes",
+		paramData: []byte(`\"\\\/\b\f\n\r\t`),
+		expect:    "\"\\/\b\f\n\r\t",
+	}, {
+		desc:      "Unicode escapes, including a surrogate pair",
+		paramData: []byte(`caf\u00e9 \ud83d\ude00`),
+		expect:    "café 😀",
+	}, {
+		desc:      "Unpaired surrogate",
+		paramData: []byte(`\ud83d!`),
+		expect:    "\uFFFD!",
+	}, {
+		desc:      "Unknown escape",
+		paramData: []byte(`\x41`),
+		err:       InvalidJson,
+	}, {
+		desc:      "Truncated unicode escape",
+		paramData: []byte(`\u00e`),
+		err:       InvalidJson,
+	}, {
+		desc:      "Trailing backslash",
+		paramData: []byte(`leonard\`),
+		err:       InvalidJson,
+	},
+}
+
+func TestUnescape(t *testing.T) {
+	for _, test := range UnescapeTests {
+		res, err := Unescape(test.paramData)
+		if err != test.err || string(res) != test.expect {
+			t.Errorf("Unescape(%s) returned %q, expected %q, and err is %v, expected err %v", test.paramData, res, test.expect, err, test.err)
+		}
+	}
+}